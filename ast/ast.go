@@ -1,6 +1,9 @@
 package ast
 
-import "lo/token"
+import (
+	"lo/token"
+	"math/big"
+)
 
 // Node is the interface for all AST nodes
 type Node interface {
@@ -34,12 +37,28 @@ type ListExpression struct {
 func (le *ListExpression) expressionNode()      {}
 func (le *ListExpression) TokenLiteral() string { return le.Token.Literal }
 
-// Identifier represents an identifier node
+// Identifier represents an identifier node. The resolver fills in where
+// its binding lives before the program runs.
 type Identifier struct {
 	Token token.Token // The token.IDENT token
 	Value string
+
+	Binding Binding
+	Depth   int // The number of scopes out a Local binding is
+	Slot    int // The slot of a Local, or the index of a Builtin
 }
 
+// Binding is the kind of binding an identifier refers to
+type Binding int
+
+const (
+	// Global identifiers, and any the resolver hasn't seen, are looked up
+	// by name when they're evaluated
+	Global Binding = iota
+	Local
+	Builtin
+)
+
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
@@ -61,6 +80,24 @@ type FloatLiteral struct {
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
 
+// BigIntLiteral represents an integer literal too large for an IntLiteral
+type BigIntLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntLiteral) expressionNode()      {}
+func (bl *BigIntLiteral) TokenLiteral() string { return bl.Token.Literal }
+
+// RatioLiteral represents a ratio literal node, such as 1/3
+type RatioLiteral struct {
+	Token token.Token
+	Value *big.Rat
+}
+
+func (rl *RatioLiteral) expressionNode()      {}
+func (rl *RatioLiteral) TokenLiteral() string { return rl.Token.Literal }
+
 // ListLiteral represents a list literal node
 type ListLiteral struct {
 	Token       token.Token // The [ token
@@ -78,3 +115,32 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// MapLiteral represents a map literal node. Keys and Values are parallel,
+// in the order the pairs were written.
+type MapLiteral struct {
+	Token  token.Token // The { token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (ml *MapLiteral) expressionNode()      {}
+func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
+
+// SetLiteral represents a set literal node
+type SetLiteral struct {
+	Token       token.Token // The #{ token
+	Expressions []Expression
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// KeywordLiteral represents a keyword literal node
+type KeywordLiteral struct {
+	Token token.Token // The token.KEYWORD token
+	Value string      // The name, without the leading colon
+}
+
+func (kl *KeywordLiteral) expressionNode()      {}
+func (kl *KeywordLiteral) TokenLiteral() string { return kl.Token.Literal }
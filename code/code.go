@@ -0,0 +1,223 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"lo/token"
+	"sort"
+)
+
+// Instructions is a flat sequence of encoded opcodes and their operands
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode identifies a single VM instruction
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+	OpTrue
+	OpFalse
+	OpNull
+	OpJump
+	OpJumpIfFalse
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpList
+	OpMap
+	OpSet
+	OpCall
+	OpTailCall
+	OpReturnValue
+	OpClosure
+	OpError
+	OpPushScope
+	OpPopScope
+	OpTry
+	OpEndTry
+	OpCatch
+	OpThrow
+	OpMacroexpand
+	OpCase
+	OpJumpIfBound
+	OpDestructure
+	OpMatch
+	OpNoMatch
+	OpNoCase
+	OpAssignGlobal
+)
+
+// Definition describes the name and operand layout of an opcode
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant:     {"OpConstant", []int{2}},
+	OpPop:          {"OpPop", []int{}},
+	OpDup:          {"OpDup", []int{}},
+	OpTrue:         {"OpTrue", []int{}},
+	OpFalse:        {"OpFalse", []int{}},
+	OpNull:         {"OpNull", []int{}},
+	OpJump:         {"OpJump", []int{2}},
+	OpJumpIfFalse:  {"OpJumpIfFalse", []int{2}},
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{1, 2}},
+	OpSetLocal:     {"OpSetLocal", []int{1, 2}},
+	OpGetBuiltin:   {"OpGetBuiltin", []int{2}},
+	OpList:         {"OpList", []int{2}},
+	OpMap:          {"OpMap", []int{2}},
+	OpSet:          {"OpSet", []int{2}},
+	OpCall:         {"OpCall", []int{2}},
+	OpTailCall:     {"OpTailCall", []int{2}},
+	OpReturnValue:  {"OpReturnValue", []int{}},
+	OpClosure:      {"OpClosure", []int{2}},
+	OpError:        {"OpError", []int{2}},
+	OpPushScope:    {"OpPushScope", []int{2}},
+	OpPopScope:     {"OpPopScope", []int{}},
+	OpTry:          {"OpTry", []int{2}},
+	OpEndTry:       {"OpEndTry", []int{}},
+	OpCatch:        {"OpCatch", []int{2, 2}},
+	OpThrow:        {"OpThrow", []int{}},
+	OpMacroexpand:  {"OpMacroexpand", []int{1}},
+	OpCase:         {"OpCase", []int{2, 2}},
+	OpJumpIfBound:  {"OpJumpIfBound", []int{2, 2}},
+	OpDestructure:  {"OpDestructure", []int{2}},
+	OpMatch:        {"OpMatch", []int{2, 2}},
+	OpNoMatch:      {"OpNoMatch", []int{}},
+	OpNoCase:       {"OpNoCase", []int{}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+}
+
+// Lookup returns the definition for the given opcode byte
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an opcode and its operands into an instruction
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction, returning them
+// along with the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// Position ties the instruction at Offset to the token it was compiled from
+type Position struct {
+	Offset int
+	Token  token.Token
+}
+
+// SourceMap lists the positions of the instructions that can raise an
+// error, in order of offset
+type SourceMap []Position
+
+// Lookup returns the token of the instruction containing ip
+func (sm SourceMap) Lookup(ip int) token.Token {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > ip })
+	if i == 0 {
+		return token.Token{}
+	}
+	return sm[i-1].Token
+}
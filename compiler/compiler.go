@@ -0,0 +1,1168 @@
+package compiler
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/code"
+	"lo/eval"
+	"lo/object"
+	"lo/token"
+)
+
+// Bytecode is the output of the compiler and the input of the VM
+type Bytecode struct {
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	Constants    []object.Object
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function body being compiled
+type CompilationScope struct {
+	instructions    code.Instructions
+	sourceMap       code.SourceMap
+	lastInstruction EmittedInstruction
+
+	// loop is the innermost loop being compiled in this function, which a
+	// recur jumps back to. Outside of one, recur calls the function again.
+	loop *loopTarget
+}
+
+// loopTarget is where a recur in a loop rebinds the loop's names and jumps
+type loopTarget struct {
+	start int
+	table *SymbolTable
+	slots []int
+
+	// pushes are the OpPushScope instructions emitted by each recur, sized
+	// once the loop's block is complete
+	pushes []int
+}
+
+type Compiler struct {
+	constants []object.Object
+	names     map[string]int
+
+	// symbolTable is nil while compiling top-level forms, where every
+	// binding is a global
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants: []object.Object{},
+		names:     map[string]int{},
+		scopes:    []CompilationScope{{instructions: code.Instructions{}}},
+	}
+}
+
+// NewWithState creates a compiler that appends to an existing constant
+// pool. Closures stored in globals refer to constants by index, so every
+// compilation sharing an Environment must also share its constants.
+func NewWithState(constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Constants:    c.constants,
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		if len(node.Expressions) == 0 {
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+		for _, exp := range node.Expressions {
+			if err := c.Compile(exp); err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+		}
+
+	case *ast.ListExpression:
+		return c.compileList(node, false)
+
+	case *ast.IntLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.BigIntLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.BigInt{Value: node.Value}))
+
+	case *ast.RatioLiteral:
+		c.emit(code.OpConstant, c.addConstant(object.NewRatio(node.Value)))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.KeywordLiteral:
+		c.emit(code.OpConstant, c.addConstant(object.InternKeyword(node.Value)))
+
+	case *ast.Identifier:
+		c.compileIdentifier(node)
+
+	case *ast.ListLiteral:
+		for _, exp := range node.Expressions {
+			if err := c.Compile(exp); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpList, len(node.Expressions))
+
+	case *ast.MapLiteral:
+		for i := range node.Keys {
+			if err := c.Compile(node.Keys[i]); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node.Token, code.OpMap, len(node.Keys)*2)
+
+	case *ast.SetLiteral:
+		for _, exp := range node.Expressions {
+			if err := c.Compile(exp); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node.Token, code.OpSet, len(node.Expressions))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// compileTail compiles exp in tail position, where calls replace the
+// current frame instead of pushing a new one
+func (c *Compiler) compileTail(exp ast.Expression) error {
+	if le, ok := exp.(*ast.ListExpression); ok {
+		return c.compileList(le, true)
+	}
+	return c.Compile(exp)
+}
+
+func (c *Compiler) compileList(le *ast.ListExpression, tail bool) error {
+	if len(le.Expressions) == 0 {
+		c.emitError(le.Token, "empty list")
+		return nil
+	}
+
+	first := le.Expressions[0]
+	if ident, ok := first.(*ast.Identifier); ok {
+		switch ident.Value {
+		case "def":
+			return c.compileDef(le)
+		case "defn":
+			return c.compileDefn(le)
+		case "set!":
+			return c.compileSet(le)
+		case "\\":
+			return c.compileLambda(le)
+		case "if":
+			return c.compileIf(le, tail)
+		case "and":
+			return c.compileAnd(le, tail)
+		case "or":
+			return c.compileOr(le, tail)
+		case "let":
+			return c.compileLet(le, tail)
+		case "letfn":
+			return c.compileLetfn(le, tail)
+		case "do":
+			return c.compileBlock(le.Expressions[1:], tail)
+		case "cond":
+			return c.compileCond(le, tail)
+		case "when":
+			return c.compileWhen(le, tail, true)
+		case "unless":
+			return c.compileWhen(le, tail, false)
+		case "case":
+			return c.compileCase(le, tail)
+		case "match":
+			return c.compileMatch(le, tail)
+		case "loop":
+			return c.compileLoop(le, tail)
+		case "recur":
+			return c.compileRecur(le)
+		case "try":
+			return c.compileTry(le)
+		case "quote":
+			return c.compileQuote(le)
+		case "macroexpand", "macroexpand-1":
+			return c.compileMacroexpand(le)
+		}
+	}
+
+	if err := c.Compile(first); err != nil {
+		return err
+	}
+	for _, arg := range le.Expressions[1:] {
+		if err := c.Compile(arg); err != nil {
+			return err
+		}
+	}
+	if tail {
+		c.emitAt(le.Token, code.OpTailCall, len(le.Expressions)-1)
+	} else {
+		c.emitAt(le.Token, code.OpCall, len(le.Expressions)-1)
+	}
+	return nil
+}
+
+// compileIdentifier resolves names in the same order as the evaluator:
+// boolean and nil literals, then locals, then builtins, then globals
+func (c *Compiler) compileIdentifier(ident *ast.Identifier) {
+	switch ident.Value {
+	case "true":
+		c.emit(code.OpTrue)
+		return
+	case "false":
+		c.emit(code.OpFalse)
+		return
+	case "nil":
+		c.emit(code.OpNull)
+		return
+	}
+
+	if c.symbolTable != nil {
+		if symbol, depth, ok := c.symbolTable.Resolve(ident.Value); ok {
+			// a local defined by a def that hasn't run yet is empty, and
+			// the VM names it from the identifier's token
+			c.emitAt(ident.Token, code.OpGetLocal, depth, symbol.Index)
+			return
+		}
+	}
+
+	if i, ok := eval.LookupBuiltin(ident.Value); ok {
+		c.emit(code.OpGetBuiltin, i)
+		return
+	}
+
+	c.emitAt(ident.Token, code.OpGetGlobal, c.addName(ident.Value))
+}
+
+// storeBinding stores the value on top of the stack into name, leaving the
+// value in place as the result of the defining form
+func (c *Compiler) storeBinding(name string) {
+	c.emit(code.OpDup)
+	if c.symbolTable == nil {
+		c.emit(code.OpSetGlobal, c.addName(name))
+		return
+	}
+	symbol := c.symbolTable.DefineOnce(name)
+	c.emit(code.OpSetLocal, 0, symbol.Index)
+}
+
+func (c *Compiler) compileDef(le *ast.ListExpression) error {
+	if len(le.Expressions) != 3 {
+		c.emitError(le.Token, "wrong number of arguments to def, got "+fmt.Sprint(len(le.Expressions)-1)+", expected 2")
+		return nil
+	}
+
+	ident, ok := le.Expressions[1].(*ast.Identifier)
+	if !ok {
+		c.emitError(le.Token, "first argument to def must be an identifier")
+		return nil
+	}
+
+	if err := c.Compile(le.Expressions[2]); err != nil {
+		return err
+	}
+	c.storeBinding(ident.Value)
+	return nil
+}
+
+// compileSet stores into the slot of a local, or has the VM check that a
+// global is already bound before storing into it
+func (c *Compiler) compileSet(le *ast.ListExpression) error {
+	ident, err := eval.ParseSet(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	var symbol Symbol
+	var depth int
+	local := false
+	if c.symbolTable != nil {
+		symbol, depth, local = c.symbolTable.Resolve(ident.Value)
+	}
+	if _, builtin := eval.LookupBuiltin(ident.Value); builtin && !local {
+		c.emitRaise(le.Token, eval.Unsettable(ident.Value))
+		return nil
+	}
+
+	if err := c.Compile(le.Expressions[2]); err != nil {
+		return err
+	}
+	c.emit(code.OpDup)
+	if local {
+		c.emit(code.OpSetLocal, depth, symbol.Index)
+		return nil
+	}
+	c.emitAt(le.Token, code.OpAssignGlobal, c.addName(ident.Value))
+	return nil
+}
+
+func (c *Compiler) compileDefn(le *ast.ListExpression) error {
+	if len(le.Expressions) < 3 {
+		c.emitError(le.Token, "wrong number of arguments to defn, got "+fmt.Sprint(len(le.Expressions)-1)+", expected 3")
+		return nil
+	}
+
+	ident, ok := le.Expressions[1].(*ast.Identifier)
+	if !ok {
+		c.emitError(le.Token, "first argument to defn must be an identifier")
+		return nil
+	}
+
+	arities, err := eval.ParseArities(le.Expressions[2:], "defn", "second argument to defn must be a list of identifiers")
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	if err := c.compileFunction(ident.Value, arities); err != nil {
+		return err
+	}
+	c.storeBinding(ident.Value)
+	return nil
+}
+
+func (c *Compiler) compileLambda(le *ast.ListExpression) error {
+	if len(le.Expressions) < 2 {
+		c.emitError(le.Token, "wrong number of arguments to lambda, got "+fmt.Sprint(len(le.Expressions)-1)+", expected 2")
+		return nil
+	}
+
+	arities, err := eval.ParseArities(le.Expressions[1:], "lambda", "first argument to lambda must be a list of identifiers")
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	return c.compileFunction("lambda", arities)
+}
+
+// compileFunction emits a closure over the function called name with the
+// given arities, or a CompiledFunction of its own for each if there's more
+// than one
+func (c *Compiler) compileFunction(name string, arities []*eval.Arity) error {
+	fns := []*object.CompiledFunction{}
+	for _, a := range arities {
+		fn, err := c.compileArity(name, a.Params, a.Body)
+		if err != nil {
+			return err
+		}
+		fns = append(fns, fn)
+	}
+
+	fn := fns[0]
+	if len(fns) > 1 {
+		fn = &object.CompiledFunction{Name: name, Arities: fns}
+	}
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+// compileArity compiles one parameter list and the body it runs
+func (c *Compiler) compileArity(name string, params *eval.Params, body []ast.Expression) (*object.CompiledFunction, error) {
+	c.enterScope()
+
+	slots := []int{}
+	for _, p := range params.Patterns {
+		slots = append(slots, c.defineSlot(p))
+	}
+	// def inside a body binds in the call's scope, wherever it appears, so
+	// closures created earlier in the body can still see it
+	for _, n := range eval.DefinedNames(body) {
+		c.symbolTable.DefineOnce(n)
+	}
+
+	// A recur in the body starts it again with new values for the
+	// parameters, like a loop around the whole body. The values it passes
+	// are all bound, so it skips the defaults but destructures them again.
+	target := &loopTarget{start: len(c.currentInstructions()), table: c.symbolTable, slots: slots}
+	c.scopes[c.scopeIndex].loop = target
+
+	if err := c.compileParameters(params, slots); err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		c.emit(code.OpNull)
+	}
+	for i, exp := range body {
+		if i == len(body)-1 {
+			if err := c.compileTail(exp); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if err := c.Compile(exp); err != nil {
+			return nil, err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpReturnValue)
+
+	numLocals := c.symbolTable.numDefinitions
+	for _, pos := range target.pushes {
+		c.changeOperand(pos, numLocals)
+	}
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	return &object.CompiledFunction{
+		Name:         name,
+		Instructions: instructions,
+		SourceMap:    sourceMap,
+		NumLocals:    numLocals,
+		Signature:    params.Signature,
+	}, nil
+}
+
+// compileParameters compiles the prologue that binds the parameters in
+// order: each optional or keyword parameter left unbound by the call gets
+// its default, or nil, and each slot bound to a pattern is destructured
+func (c *Compiler) compileParameters(params *eval.Params, slots []int) error {
+	sig := params.Signature
+	for i, p := range params.Patterns {
+		if i >= sig.Required && !(sig.Rest && i == sig.Required+sig.Optional) {
+			jumpPos := c.emit(code.OpJumpIfBound, slots[i], 9999)
+			if params.Defaults[i] == nil {
+				c.emit(code.OpNull)
+			} else if err := c.Compile(params.Defaults[i]); err != nil {
+				return err
+			}
+			c.emit(code.OpSetLocal, 0, slots[i])
+			c.changeOperand(jumpPos, slots[i], len(c.currentInstructions()))
+		}
+
+		if p.Kind != object.NamePattern {
+			c.emit(code.OpGetLocal, 0, slots[i])
+			if err := c.compileDestructure(p, c.defineNames(p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defineSlot defines the local a pattern's whole value is kept in: the
+// pattern's name, or a slot no name can refer to
+func (c *Compiler) defineSlot(p *object.Pattern) int {
+	if p.Kind == object.NamePattern {
+		return c.symbolTable.Define(p.Name.Value).Index
+	}
+	return c.symbolTable.Define("").Index
+}
+
+// defineNames defines a local for each name p binds
+func (c *Compiler) defineNames(p *object.Pattern) []int {
+	names, _ := p.Bindings()
+	slots := make([]int, len(names))
+	for i, name := range names {
+		slots[i] = c.symbolTable.Define(name.Value).Index
+	}
+	return slots
+}
+
+// destructures reports whether any of patterns takes its value apart
+func destructures(patterns []*object.Pattern) bool {
+	for _, p := range patterns {
+		if p.Kind != object.NamePattern {
+			return true
+		}
+	}
+	return false
+}
+
+// compileBind binds the value on top of the stack to p
+func (c *Compiler) compileBind(p *object.Pattern) error {
+	if p.Kind == object.NamePattern {
+		c.emit(code.OpSetLocal, 0, c.defineSlot(p))
+		return nil
+	}
+	return c.compileDestructure(p, c.defineNames(p))
+}
+
+// compileDestructure takes the value on top of the stack apart with p,
+// storing the value of each name it binds in slots, then gives each name
+// left unbound its :or default
+func (c *Compiler) compileDestructure(p *object.Pattern, slots []int) error {
+	c.emitAt(p.Token, code.OpDestructure, c.addConstant(p))
+	for i := len(slots) - 1; i >= 0; i-- {
+		c.emit(code.OpSetLocal, 0, slots[i])
+	}
+
+	_, defaults := p.Bindings()
+	for i, def := range defaults {
+		if def == nil {
+			continue
+		}
+		jumpPos := c.emit(code.OpJumpIfBound, slots[i], 9999)
+		if err := c.Compile(def); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, 0, slots[i])
+		c.changeOperand(jumpPos, slots[i], len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileIf(le *ast.ListExpression, tail bool) error {
+	if len(le.Expressions) != 4 {
+		c.emitError(le.Token, "wrong number of arguments to if, got "+fmt.Sprint(len(le.Expressions)-1)+", expected 3")
+		return nil
+	}
+
+	if err := c.Compile(le.Expressions[1]); err != nil {
+		return err
+	}
+	jumpIfFalsePos := c.emit(code.OpJumpIfFalse, 9999)
+
+	if err := c.compileBranch(le.Expressions[2], tail); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpIfFalsePos, len(c.currentInstructions()))
+
+	if err := c.compileBranch(le.Expressions[3], tail); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileSequence compiles exps to leave the value of the last on the stack
+func (c *Compiler) compileSequence(exps []ast.Expression) error {
+	if len(exps) == 0 {
+		c.emit(code.OpNull)
+	}
+	for i, exp := range exps {
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+		if i < len(exps)-1 {
+			c.emit(code.OpPop)
+		}
+	}
+	return nil
+}
+
+// compileBlock compiles exps like compileSequence, with the last in tail
+// position if the block is
+func (c *Compiler) compileBlock(exps []ast.Expression, tail bool) error {
+	if !tail || len(exps) == 0 {
+		return c.compileSequence(exps)
+	}
+	for _, exp := range exps[:len(exps)-1] {
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	return c.compileTail(exps[len(exps)-1])
+}
+
+// compileLet binds each pattern in turn in a block of its own, so later values
+// can refer to earlier names and shadow them
+func (c *Compiler) compileLet(le *ast.ListExpression, tail bool) error {
+	form, err := eval.ParseBindings(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	pushPos := c.enterBlock()
+	for _, n := range eval.DefinedNames(append(append([]ast.Expression{}, form.Values...), form.Body...)) {
+		c.symbolTable.DefineOnce(n)
+	}
+	for i, pattern := range form.Patterns {
+		if err := c.Compile(form.Values[i]); err != nil {
+			return err
+		}
+		if err := c.compileBind(pattern); err != nil {
+			return err
+		}
+	}
+	if err := c.compileBlock(form.Body, tail); err != nil {
+		return err
+	}
+	c.leaveBlock(pushPos)
+	return nil
+}
+
+// compileLetfn binds each function in a block of its own, which they all
+// close over, so they can call each other
+func (c *Compiler) compileLetfn(le *ast.ListExpression, tail bool) error {
+	form, err := eval.ParseLetfn(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	pushPos := c.enterBlock()
+	for _, n := range eval.DefinedNames(form.Body) {
+		c.symbolTable.DefineOnce(n)
+	}
+	slots := []int{}
+	for _, name := range form.Names {
+		slots = append(slots, c.symbolTable.Define(name.Value).Index)
+	}
+	for i, name := range form.Names {
+		if err := c.compileFunction(name.Value, form.Arities[i]); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, 0, slots[i])
+	}
+	if err := c.compileBlock(form.Body, tail); err != nil {
+		return err
+	}
+	c.leaveBlock(pushPos)
+	return nil
+}
+
+// compileLoop binds its patterns in a block like let. Each recur replaces the
+// block with a fresh one holding the new values, so closures made in one
+// iteration keep that iteration's bindings.
+func (c *Compiler) compileLoop(le *ast.ListExpression, tail bool) error {
+	form, err := eval.ParseBindings(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	pushPos := c.enterBlock()
+	for _, n := range eval.DefinedNames(append(append([]ast.Expression{}, form.Values...), form.Body...)) {
+		c.symbolTable.DefineOnce(n)
+	}
+	slots := []int{}
+	names := [][]int{}
+	for i, pattern := range form.Patterns {
+		if err := c.Compile(form.Values[i]); err != nil {
+			return err
+		}
+		slot := c.defineSlot(pattern)
+		c.emit(code.OpSetLocal, 0, slot)
+		slots = append(slots, slot)
+		names = append(names, nil)
+
+		if pattern.Kind != object.NamePattern {
+			names[i] = c.defineNames(pattern)
+			c.emit(code.OpGetLocal, 0, slot)
+			if err := c.compileDestructure(pattern, names[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// recur stores the whole values and starts here, destructuring any
+	// patterns again before the body
+	start := len(c.currentInstructions())
+	if destructures(form.Patterns) {
+		jumpPos := c.emit(code.OpJump, 9999)
+		start = len(c.currentInstructions())
+		for i, pattern := range form.Patterns {
+			if names[i] == nil {
+				continue
+			}
+			c.emit(code.OpGetLocal, 0, slots[i])
+			if err := c.compileDestructure(pattern, names[i]); err != nil {
+				return err
+			}
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	target := &loopTarget{start: start, table: c.symbolTable, slots: slots}
+	outer := scope.loop
+	scope.loop = target
+	if err := c.compileBlock(form.Body, tail); err != nil {
+		return err
+	}
+	scope.loop = outer
+
+	for _, pos := range target.pushes {
+		c.changeOperand(pos, c.symbolTable.numDefinitions)
+	}
+	c.leaveBlock(pushPos)
+	return nil
+}
+
+// compileRecur compiles a recur, which ExpandMacros has checked is in tail
+// position with the right number of values. The innermost loop or
+// function's blocks are replaced by a fresh one holding the new values.
+func (c *Compiler) compileRecur(le *ast.ListExpression) error {
+	target := c.scopes[c.scopeIndex].loop
+	if target == nil {
+		c.emitError(le.Token, "recur used outside of loop or function")
+		return nil
+	}
+
+	for _, arg := range le.Expressions[1:] {
+		if err := c.Compile(arg); err != nil {
+			return err
+		}
+	}
+
+	for table := c.symbolTable; table != target.table; table = table.Outer {
+		c.emit(code.OpPopScope)
+	}
+	c.emit(code.OpPopScope)
+	target.pushes = append(target.pushes, c.emit(code.OpPushScope, 9999))
+	for i := len(target.slots) - 1; i >= 0; i-- {
+		c.emit(code.OpSetLocal, 0, target.slots[i])
+	}
+	c.emit(code.OpJump, target.start)
+	return nil
+}
+
+func (c *Compiler) compileCond(le *ast.ListExpression, tail bool) error {
+	if err := eval.CheckCond(le); err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	endJumps := []int{}
+	for i := 1; i < len(le.Expressions); i += 2 {
+		if err := c.Compile(le.Expressions[i]); err != nil {
+			return err
+		}
+		jumpIfFalsePos := c.emit(code.OpJumpIfFalse, 9999)
+		if err := c.compileBranch(le.Expressions[i+1], tail); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(jumpIfFalsePos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpNull)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileWhen compiles when, or unless with want false, as an if whose
+// other branch is nil
+func (c *Compiler) compileWhen(le *ast.ListExpression, tail bool, want bool) error {
+	if err := eval.CheckWhen(le); err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	if err := c.Compile(le.Expressions[1]); err != nil {
+		return err
+	}
+	jumpIfFalsePos := c.emit(code.OpJumpIfFalse, 9999)
+
+	if want {
+		if err := c.compileBlock(le.Expressions[2:], tail); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpIfFalsePos, len(c.currentInstructions()))
+	if want {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlock(le.Expressions[2:], tail); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileCase keeps the value being dispatched on the stack while each
+// OpCase compares it with a clause's constants, popping it once a clause
+// is chosen
+func (c *Compiler) compileCase(le *ast.ListExpression, tail bool) error {
+	form, err := eval.ParseCase(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	if err := c.Compile(form.Expr); err != nil {
+		return err
+	}
+
+	endJumps := []int{}
+	for _, clause := range form.Clauses {
+		constIndex := c.addConstant(clause.Constants)
+		casePos := c.emit(code.OpCase, constIndex, 9999)
+		c.emit(code.OpPop)
+		if err := c.compileBranch(clause.Result, tail); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(casePos, constIndex, len(c.currentInstructions()))
+	}
+
+	if form.Default != nil {
+		c.emit(code.OpPop)
+		if err := c.compileBranch(form.Default, tail); err != nil {
+			return err
+		}
+	} else {
+		c.emitAt(le.Token, code.OpNoCase)
+	}
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileMatch tests the value against each clause's pattern with OpMatch,
+// which leaves the value on the stack for the next clause, topped by the
+// values of the pattern's names if it matches. Each clause binds its names
+// in a block of its own.
+func (c *Compiler) compileMatch(le *ast.ListExpression, tail bool) error {
+	form, err := eval.ParseMatch(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	if err := c.Compile(form.Expr); err != nil {
+		return err
+	}
+
+	endJumps := []int{}
+	for _, clause := range form.Clauses {
+		constIndex := c.addConstant(clause.Pattern)
+		matchPos := c.emitAt(le.Token, code.OpMatch, constIndex, 9999)
+
+		pushPos := c.enterBlock()
+		exps := []ast.Expression{clause.Result}
+		if clause.Guard != nil {
+			exps = append(exps, clause.Guard)
+		}
+		for _, n := range eval.DefinedNames(exps) {
+			c.symbolTable.DefineOnce(n)
+		}
+		slots := c.defineNames(clause.Pattern)
+		for i := len(slots) - 1; i >= 0; i-- {
+			c.emit(code.OpSetLocal, 0, slots[i])
+		}
+
+		guardPos := -1
+		if clause.Guard != nil {
+			if err := c.Compile(clause.Guard); err != nil {
+				return err
+			}
+			guardPos = c.emit(code.OpJumpIfFalse, 9999)
+		}
+		c.emit(code.OpPop)
+		if err := c.compileBranch(clause.Result, tail); err != nil {
+			return err
+		}
+		c.leaveBlock(pushPos)
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		if guardPos >= 0 {
+			c.changeOperand(guardPos, len(c.currentInstructions()))
+			c.emit(code.OpPopScope)
+		}
+		c.changeOperand(matchPos, constIndex, len(c.currentInstructions()))
+	}
+	c.emitAt(le.Token, code.OpNoMatch)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileAnd leaves the first falsy operand on the stack, skipping the
+// rest, or the last operand if all are truthy
+func (c *Compiler) compileAnd(le *ast.ListExpression, tail bool) error {
+	operands := le.Expressions[1:]
+	if len(operands) == 0 {
+		c.emit(code.OpTrue)
+		return nil
+	}
+
+	jumps := []int{}
+	for _, exp := range operands[:len(operands)-1] {
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+		c.emit(code.OpDup)
+		jumps = append(jumps, c.emit(code.OpJumpIfFalse, 9999))
+		c.emit(code.OpPop)
+	}
+	if err := c.compileBranch(operands[len(operands)-1], tail); err != nil {
+		return err
+	}
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileOr leaves the first truthy operand on the stack, skipping the
+// rest, or the last operand if none are truthy
+func (c *Compiler) compileOr(le *ast.ListExpression, tail bool) error {
+	operands := le.Expressions[1:]
+	if len(operands) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	jumps := []int{}
+	for _, exp := range operands[:len(operands)-1] {
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+		c.emit(code.OpDup)
+		jumpIfFalsePos := c.emit(code.OpJumpIfFalse, 9999)
+		jumps = append(jumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(jumpIfFalsePos, len(c.currentInstructions()))
+		c.emit(code.OpPop)
+	}
+	if err := c.compileBranch(operands[len(operands)-1], tail); err != nil {
+		return err
+	}
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileBranch(exp ast.Expression, tail bool) error {
+	if tail {
+		return c.compileTail(exp)
+	}
+	return c.Compile(exp)
+}
+
+func (c *Compiler) compileTry(le *ast.ListExpression) error {
+	form, err := eval.ParseTry(le)
+	if err != nil {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+
+	if form.Finally == nil {
+		return c.compileTryCatch(le, form)
+	}
+
+	// The finally body is compiled twice: once after the protected code
+	// completes, and once in a handler that re-raises after running it
+	tryPos := c.emit(code.OpTry, 9999)
+	if err := c.compileTryCatch(le, form); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	if err := c.compileSequence(form.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	if err := c.compileSequence(form.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
+	c.emitAt(le.Token, code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileTryCatch(le *ast.ListExpression, form *eval.TryForm) error {
+	if len(form.Catches) == 0 {
+		return c.compileSequence(form.Body)
+	}
+
+	tryPos := c.emit(code.OpTry, 9999)
+	if err := c.compileSequence(form.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	endJumps := []int{c.emit(code.OpJump, 9999)}
+
+	// The raised error is on the stack here. Each clause either binds it
+	// and runs its body, or jumps to the next clause.
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	for _, clause := range form.Catches {
+		kindIndex := c.addConstant(&object.String{Value: clause.Kind})
+		catchPos := c.emit(code.OpCatch, kindIndex, 9999)
+
+		pushPos := c.enterBlock()
+		symbol := c.symbolTable.Define(clause.Name.Value)
+		for _, n := range eval.DefinedNames(clause.Body) {
+			c.symbolTable.DefineOnce(n)
+		}
+		c.emit(code.OpSetLocal, 0, symbol.Index)
+		if err := c.compileSequence(clause.Body); err != nil {
+			return err
+		}
+		c.leaveBlock(pushPos)
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		c.changeOperand(catchPos, kindIndex, len(c.currentInstructions()))
+	}
+	c.emitAt(le.Token, code.OpThrow)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileQuote makes the quoted code a constant, so every evaluation of
+// the form yields the same data
+func (c *Compiler) compileQuote(le *ast.ListExpression) error {
+	if len(le.Expressions) != 2 {
+		c.emitError(le.Token, "wrong number of arguments to quote, got "+fmt.Sprint(len(le.Expressions)-1)+", expected 1")
+		return nil
+	}
+
+	quoted := eval.Quote(le.Expressions[1])
+	if err, ok := quoted.(*object.Error); ok {
+		c.emitRaise(le.Token, err)
+		return nil
+	}
+	c.emit(code.OpConstant, c.addConstant(quoted))
+	return nil
+}
+
+func (c *Compiler) compileMacroexpand(le *ast.ListExpression) error {
+	name := le.Expressions[0].(*ast.Identifier).Value
+	if len(le.Expressions) != 2 {
+		c.emitError(le.Token, "wrong number of arguments to "+name+", got "+fmt.Sprint(len(le.Expressions)-1)+", expected 1")
+		return nil
+	}
+
+	if err := c.Compile(le.Expressions[1]); err != nil {
+		return err
+	}
+
+	once := 0
+	if name == "macroexpand-1" {
+		once = 1
+	}
+	c.emitAt(le.Token, code.OpMacroexpand, once)
+	return nil
+}
+
+// emitError compiles a malformed form to raise the same syntax error the
+// evaluator raises for it
+func (c *Compiler) emitError(tok token.Token, msg string) {
+	c.emitRaise(tok, &object.Error{Kind: object.SYNTAX_ERROR, Message: msg})
+}
+
+// emitRaise raises a fresh copy of err each time the instruction runs
+func (c *Compiler) emitRaise(tok token.Token, err *object.Error) {
+	c.emitAt(tok, code.OpError, c.addConstant(err))
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// addName interns a global name in the constant pool
+func (c *Compiler) addName(name string) int {
+	if i, ok := c.names[name]; ok {
+		return i
+	}
+	i := c.addConstant(&object.String{Value: name})
+	c.names[name] = i
+	return i
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+	c.scopes[c.scopeIndex].lastInstruction = EmittedInstruction{Opcode: op, Position: pos}
+	return pos
+}
+
+// emitAt emits an instruction that can raise an error, recording tok as
+// its position
+func (c *Compiler) emitAt(tok token.Token, op code.Opcode, operands ...int) int {
+	scope := &c.scopes[c.scopeIndex]
+	scope.sourceMap = append(scope.sourceMap, code.Position{Offset: len(scope.instructions), Token: tok})
+	return c.emit(op, operands...)
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operands...)
+	copy(c.currentInstructions()[opPos:], newInstruction)
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// enterBlock starts a lexical block within the current function, whose
+// locals live in a Scope of their own pushed by OpPushScope
+func (c *Compiler) enterBlock() int {
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	return c.emit(code.OpPushScope, 9999)
+}
+
+// leaveBlock ends the block started at pushPos, sizing its Scope now that
+// all of its locals are known
+func (c *Compiler) leaveBlock(pushPos int) {
+	c.changeOperand(pushPos, c.symbolTable.numDefinitions)
+	c.symbolTable = c.symbolTable.Outer
+	c.emit(code.OpPopScope)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
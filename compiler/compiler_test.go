@@ -0,0 +1,767 @@
+package compiler
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/code"
+	"lo/lexer"
+	"lo/object"
+	"lo/parser"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(+ 1 2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(if true 10 20)",
+			expectedConstants: []interface{}{10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpIfFalse, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpConstant, 1),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAndOr(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(and 1 2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpDup),
+				// 0004
+				code.Make(code.OpJumpIfFalse, 11),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpConstant, 1),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(or 1 2)",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpDup),
+				// 0004
+				code.Make(code.OpJumpIfFalse, 10),
+				// 0007
+				code.Make(code.OpJump, 14),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpConstant, 1),
+				// 0014
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:                "(and)",
+			expectedConstants:    []interface{}{},
+			expectedInstructions: []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpPop)},
+		},
+		{
+			input:                "(or)",
+			expectedConstants:    []interface{}{},
+			expectedInstructions: []code.Instructions{code.Make(code.OpNull), code.Make(code.OpPop)},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCase(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "(case 1 (2 3) 4 5)",
+			expectedConstants: []interface{}{
+				1,
+				object.NewList([]object.Object{&object.Integer{Value: 2}, &object.Integer{Value: 3}}),
+				4,
+				5,
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpCase, 1, 15),
+				// 0008
+				code.Make(code.OpPop),
+				// 0009
+				code.Make(code.OpConstant, 2),
+				// 0012
+				code.Make(code.OpJump, 19),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpConstant, 3),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(case 1 2 3)",
+			expectedConstants: []interface{}{
+				1,
+				object.NewList([]object.Object{&object.Integer{Value: 2}}),
+				3,
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpCase, 1, 15),
+				// 0008
+				code.Make(code.OpPop),
+				// 0009
+				code.Make(code.OpConstant, 2),
+				// 0012
+				code.Make(code.OpJump, 16),
+				// 0015
+				code.Make(code.OpNoCase),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	a := &ast.Identifier{Value: "a"}
+	b := &ast.Identifier{Value: "b"}
+	tests := []compilerTestCase{
+		{
+			input: "(let [[a b] [1 2]] b)",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				&object.Pattern{Kind: object.ListPattern, Elements: []*object.Pattern{
+					{Kind: object.NamePattern, Name: a},
+					{Kind: object.NamePattern, Name: b},
+				}},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpPushScope, 2),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpList, 2),
+				code.Make(code.OpDestructure, 2),
+				code.Make(code.OpSetLocal, 0, 1),
+				code.Make(code.OpSetLocal, 0, 0),
+				code.Make(code.OpGetLocal, 0, 1),
+				code.Make(code.OpPopScope),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "(match 1 n n)",
+			expectedConstants: []interface{}{
+				1,
+				&object.Pattern{Kind: object.NamePattern, Name: &ast.Identifier{Value: "n"}},
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpMatch, 1, 24),
+				// 0008
+				code.Make(code.OpPushScope, 1),
+				// 0011
+				code.Make(code.OpSetLocal, 0, 0),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpGetLocal, 0, 0),
+				// 0020
+				code.Make(code.OpPopScope),
+				// 0021
+				code.Make(code.OpJump, 25),
+				// 0024
+				code.Make(code.OpNoMatch),
+				// 0025
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLetfn(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "(letfn [(f [] (g)) (g [] 1)] (f))",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1, 1),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpPushScope, 2),
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpSetLocal, 0, 0),
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpSetLocal, 0, 1),
+				code.Make(code.OpGetLocal, 0, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPopScope),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalDefinitions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(def x 1) x",
+			expectedConstants: []interface{}{1, "x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSetBang(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "(def x 1) (set! x 2)",
+			expectedConstants: []interface{}{1, "x", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpDup),
+				code.Make(code.OpAssignGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(let [x 1] (set! x 2))",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpPushScope, 1),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetLocal, 0, 0),
+				code.Make(code.OpPopScope),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestListLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[]",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpList, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1 2]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpList, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMapLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "{1 2 3 4}",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpMap, 4),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSetLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "#{1 2}",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSet, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "(\\ [x] x)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(defn f [a] (def b a) (\\ [] b))",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0, 0),
+					code.Make(code.OpDup),
+					code.Make(code.OpSetLocal, 0, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpClosure, 0),
+					code.Make(code.OpReturnValue),
+				},
+				"f",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpDup),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(\\ [x (y 1)] y)",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpJumpIfBound, 1, 12),
+					// 0005
+					code.Make(code.OpConstant, 0),
+					// 0008
+					code.Make(code.OpSetLocal, 0, 1),
+					// 0012
+					code.Make(code.OpGetLocal, 0, 1),
+					// 0016
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "(\\ [f] (f 1) (f 2))",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "(\\ [f] (if (f) (f) 1))",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0, 0),
+					// 0004
+					code.Make(code.OpCall, 0),
+					// 0007
+					code.Make(code.OpJumpIfFalse, 20),
+					// 0010
+					code.Make(code.OpGetLocal, 0, 0),
+					// 0014
+					code.Make(code.OpTailCall, 0),
+					// 0017
+					code.Make(code.OpJump, 23),
+					// 0020
+					code.Make(code.OpConstant, 0),
+					// 0023
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTry(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `(try 1 (catch "type-error" e e))`,
+			expectedConstants: []interface{}{1, "type-error"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 31),
+				// 0010
+				code.Make(code.OpCatch, 1, 30),
+				// 0015
+				code.Make(code.OpPushScope, 1),
+				// 0018
+				code.Make(code.OpSetLocal, 0, 0),
+				// 0022
+				code.Make(code.OpGetLocal, 0, 0),
+				// 0026
+				code.Make(code.OpPopScope),
+				// 0027
+				code.Make(code.OpJump, 31),
+				// 0030
+				code.Make(code.OpThrow),
+				// 0031
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `(try 1 (finally 2))`,
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 14),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpJump, 19),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpThrow),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestQuote(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "'a",
+			expectedConstants: []interface{}{&object.Symbol{Name: "a"}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "(macroexpand-1 '(m 1))",
+			expectedConstants: []interface{}{&object.Form{}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMacroexpand, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMalformedForms(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "()",
+			expectedConstants: []interface{}{&object.Error{Kind: object.SYNTAX_ERROR, Message: "empty list"}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpError, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSourceMap(t *testing.T) {
+	program := parse("(def x 1)\n(f\n  y)")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		// OpGetGlobal f
+		{10, 2, 2},
+		// OpGetGlobal y
+		{13, 3, 3},
+		// OpCall
+		{16, 2, 1},
+		{17, 2, 1},
+	}
+
+	for _, tt := range tests {
+		tok := bytecode.SourceMap.Lookup(tt.offset)
+		if tok.Line != tt.line || tok.Column != tt.column {
+			t.Errorf("wrong position at %d. got=%d:%d, want=%d:%d", tt.offset, tok.Line, tok.Column, tt.line, tt.column)
+		}
+	}
+}
+
+// Helpers
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input, "test")
+	p := parser.New(l)
+	return p.Parse()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed for %q: %s", tt.input, err)
+		}
+
+		err = testConstants(tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("testConstants failed for %q: %s", tt.input, err)
+		}
+	}
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+	concatted := concatInstructions(expected)
+
+	if len(actual) != len(concatted) {
+		return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
+	}
+
+	for i, ins := range concatted {
+		if actual[i] != ins {
+			return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q", i, concatted, actual)
+		}
+	}
+
+	return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				return fmt.Errorf("constant %d - wrong integer. got=%s", i, actual[i].Inspect())
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				return fmt.Errorf("constant %d - wrong string. got=%s", i, actual[i].Inspect())
+			}
+		case *object.Error:
+			err, ok := actual[i].(*object.Error)
+			if !ok || err.Message != constant.Message || err.Kind != constant.Kind {
+				return fmt.Errorf("constant %d - wrong error. got=%s", i, actual[i].Inspect())
+			}
+		case *object.Symbol:
+			sym, ok := actual[i].(*object.Symbol)
+			if !ok || sym.Name != constant.Name {
+				return fmt.Errorf("constant %d - wrong symbol. got=%s", i, actual[i].Inspect())
+			}
+		case *object.Form:
+			if _, ok := actual[i].(*object.Form); !ok {
+				return fmt.Errorf("constant %d - not a form: %T", i, actual[i])
+			}
+		case *object.List:
+			list, ok := actual[i].(*object.List)
+			if !ok || list.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong list. got=%s", i, actual[i].Inspect())
+			}
+		case *object.Pattern:
+			pattern, ok := actual[i].(*object.Pattern)
+			if !ok || pattern.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong pattern. got=%s", i, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+			}
+			if err := testInstructions(constant, fn.Instructions); err != nil {
+				return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+			}
+		}
+	}
+
+	return nil
+}
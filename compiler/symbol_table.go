@@ -0,0 +1,58 @@
+package compiler
+
+// Symbol is a local binding resolved to a slot in a function's scope
+type Symbol struct {
+	Name  string
+	Index int
+}
+
+// SymbolTable tracks the locals of one function body. Names that aren't
+// found in any enclosing table are globals, looked up by name at runtime.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	return &SymbolTable{store: s}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define allocates a new slot for name, shadowing any previous binding
+// of the same name in this table
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineOnce returns the existing slot for name in this table, allocating
+// one only if the name isn't bound here yet
+func (s *SymbolTable) DefineOnce(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+	return s.Define(name)
+}
+
+// Resolve finds name in this table or an enclosing one, returning the
+// number of scopes between the reference and the binding
+func (s *SymbolTable) Resolve(name string) (Symbol, int, bool) {
+	depth := 0
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, depth, true
+		}
+		depth++
+	}
+	return Symbol{}, 0, false
+}
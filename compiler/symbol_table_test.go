@@ -0,0 +1,54 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	outer := NewSymbolTable()
+	a := outer.Define("a")
+	b := outer.Define("b")
+	if a.Index != 0 || b.Index != 1 {
+		t.Errorf("wrong indexes. a=%d, b=%d", a.Index, b.Index)
+	}
+
+	again := outer.Define("a")
+	if again.Index != 2 {
+		t.Errorf("Define should allocate a new slot. got=%d", again.Index)
+	}
+
+	once := outer.DefineOnce("a")
+	if once.Index != 2 {
+		t.Errorf("DefineOnce should reuse the slot. got=%d", once.Index)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	outer := NewSymbolTable()
+	outer.Define("a")
+	outer.Define("b")
+
+	inner := NewEnclosedSymbolTable(outer)
+	inner.Define("b")
+
+	tests := []struct {
+		name  string
+		index int
+		depth int
+	}{
+		{"a", 0, 1},
+		{"b", 0, 0},
+	}
+
+	for _, tt := range tests {
+		symbol, depth, ok := inner.Resolve(tt.name)
+		if !ok {
+			t.Fatalf("name %s not resolvable", tt.name)
+		}
+		if symbol.Index != tt.index || depth != tt.depth {
+			t.Errorf("%s resolved to (%d, %d), want (%d, %d)", tt.name, depth, symbol.Index, tt.depth, tt.index)
+		}
+	}
+
+	if _, _, ok := inner.Resolve("c"); ok {
+		t.Errorf("c should not resolve")
+	}
+}
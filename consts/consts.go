@@ -4,3 +4,4 @@ import "lo/object"
 
 var TrueBool = object.Boolean{Value: true}
 var FalseBool = object.Boolean{Value: false}
+var Nil = object.Nil{}
@@ -0,0 +1,87 @@
+package eval
+
+import (
+	"fmt"
+	"lo/object"
+)
+
+func atomArg(name string, arg object.Object) (*object.Atom, object.Object) {
+	a, ok := arg.(*object.Atom)
+	if !ok {
+		return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("first argument to %s must be an ATOM, got %s", name, typeName(arg))}
+	}
+	return a, nil
+}
+
+// atom makes a new atom holding its argument
+func atom(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("atom", len(args), "1")
+	}
+	return object.NewAtom(args[0])
+}
+
+func deref(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("deref", len(args), "1")
+	}
+
+	a, err := atomArg("deref", args[0])
+	if err != nil {
+		return err
+	}
+	return a.Deref()
+}
+
+// reset sets an atom's value, returning the new value
+func reset(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("reset!", len(args), "2")
+	}
+
+	a, err := atomArg("reset!", args[0])
+	if err != nil {
+		return err
+	}
+	a.Reset(args[1])
+	return args[1]
+}
+
+// swap sets an atom's value to the result of calling f on it, followed by
+// any extra arguments, returning the new value. If another goroutine
+// changes the atom while f runs, f is called again on the new value.
+func swap(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) < 2 {
+		return arityError("swap!", len(args), "at least 2")
+	}
+
+	a, err := atomArg("swap!", args[0])
+	if err != nil {
+		return err
+	}
+
+	for {
+		old := a.Deref()
+		val := apply(args[1], append([]object.Object{old}, args[2:]...)...)
+		if isError(val) {
+			return val
+		}
+		if a.CompareAndSet(old, val) {
+			return val
+		}
+	}
+}
+
+// compareAndSet sets an atom's value if it's equal to an expected one,
+// returning whether it did
+func compareAndSet(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return arityError("compare-and-set!", len(args), "3")
+	}
+
+	a, err := atomArg("compare-and-set!", args[0])
+	if err != nil {
+		return err
+	}
+	return nativeBool(a.CompareAndSet(args[1], args[2]))
+}
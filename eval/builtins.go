@@ -3,156 +3,359 @@ package eval
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 
+	"lo/consts"
 	"lo/object"
 )
 
-var builtinFunctions = map[string]object.BuiltinFunction{
-	"+":       add,
-	"-":       subtract,
-	"*":       multiply,
-	"/":       divide,
-	"str":     str,
-	"print":   print,
-	"println": println,
+// Builtins is the ordered table of builtin functions. The compiler refers
+// to builtins by their index in this table, so the tree-walker and the VM
+// share the exact same implementations.
+var Builtins = []*object.Builtin{
+	{Name: "+", Fn: add},
+	{Name: "-", Fn: subtract},
+	{Name: "*", Fn: multiply},
+	{Name: "/", Fn: divide},
+	{Name: "quot", Fn: integerDivision("quot", quot)},
+	{Name: "rem", Fn: integerDivision("rem", rem)},
+	{Name: "mod", Fn: integerDivision("mod", mod)},
+	{Name: "str", Fn: str},
+	{Name: "print", Fn: print},
+	{Name: "println", Fn: println},
+	{Name: "throw", Fn: throw},
+	{Name: "error-kind", Fn: errorKind},
+	{Name: "error-message", Fn: errorMessage},
+	{Name: "error-payload", Fn: errorPayload},
+	{Name: "list", Fn: list},
+	{Name: "concat", Fn: concat},
+	{Name: "vec", Fn: vec},
+	{Name: "get", Fn: get},
+	{Name: "assoc", Fn: assoc},
+	{Name: "dissoc", Fn: dissoc},
+	{Name: "keys", Fn: keys},
+	{Name: "vals", Fn: vals},
+	{Name: "contains?", Fn: contains},
+	{Name: "merge", Fn: merge},
+	{Name: "update", HigherOrder: update},
+	{Name: "set", Fn: set},
+	{Name: "union", Fn: union},
+	{Name: "intersection", Fn: intersection},
+	{Name: "difference", Fn: difference},
+	{Name: "subset?", Fn: isSubset},
+	{Name: "superset?", Fn: isSuperset},
+	{Name: "disj", Fn: disj},
+	{Name: "keyword", Fn: keyword},
+	{Name: "symbol", Fn: symbol},
+	{Name: "gensym", Fn: gensym},
+	{Name: "name", Fn: getName},
+	{Name: "keyword?", Fn: isKeyword},
+	{Name: "symbol?", Fn: isSymbol},
+	{Name: "nil?", Fn: isNil},
+	{Name: "some?", Fn: isSome},
+	{Name: "=", Fn: equals},
+	{Name: "not=", Fn: notEquals},
+	{Name: "<", Fn: ordering("<", func(c int) bool { return c < 0 })},
+	{Name: ">", Fn: ordering(">", func(c int) bool { return c > 0 })},
+	{Name: "<=", Fn: ordering("<=", func(c int) bool { return c <= 0 })},
+	{Name: ">=", Fn: ordering(">=", func(c int) bool { return c >= 0 })},
+	{Name: "not", Fn: not},
+	{Name: "atom", Fn: atom},
+	{Name: "deref", Fn: deref},
+	{Name: "reset!", Fn: reset},
+	{Name: "swap!", HigherOrder: swap},
+	{Name: "compare-and-set!", Fn: compareAndSet},
+	{Name: "first", Fn: first},
+	{Name: "rest", Fn: rest},
+	{Name: "cons", Fn: cons},
+	{Name: "conj", Fn: conj},
+	{Name: "nth", Fn: nth},
+	{Name: "count", Fn: count},
+	{Name: "empty?", Fn: isEmpty},
+	{Name: "reverse", Fn: reverse},
+	{Name: "take", Fn: take},
+	{Name: "drop", Fn: drop},
+	{Name: "range", Fn: numberRange},
+	{Name: "map", HigherOrder: mapSeq},
+	{Name: "filter", HigherOrder: filter},
+	{Name: "reduce", HigherOrder: reduce},
+	{Name: "some", HigherOrder: some},
+	{Name: "every?", HigherOrder: every},
+	{Name: "sort", HigherOrder: sortSeq},
+	{Name: "sort-by", HigherOrder: sortBy},
+	{Name: "group-by", HigherOrder: groupBy},
+	{Name: "partition", Fn: partition},
+	{Name: "zip", Fn: zip},
+	{Name: "flatten", Fn: flatten},
+	{Name: "lazy-seq", HigherOrder: lazySeq},
+	{Name: "iterate", HigherOrder: iterate},
+	{Name: "repeat", Fn: repeat},
+	{Name: "cycle", Fn: cycle},
+	{Name: "read-lines", Fn: readLines},
+	{Name: "subs", Fn: subs},
+	{Name: "upper-case", Fn: stringFunction("upper-case", strings.ToUpper)},
+	{Name: "lower-case", Fn: stringFunction("lower-case", strings.ToLower)},
+	{Name: "trim", Fn: stringFunction("trim", strings.TrimSpace)},
+	{Name: "split", Fn: split},
+	{Name: "join", Fn: join},
+	{Name: "replace", Fn: replace},
+	{Name: "starts-with?", Fn: stringPredicate("starts-with?", strings.HasPrefix)},
+	{Name: "ends-with?", Fn: stringPredicate("ends-with?", strings.HasSuffix)},
+	{Name: "includes?", Fn: stringPredicate("includes?", strings.Contains)},
+	{Name: "index-of", Fn: indexOf},
+	{Name: "pad-left", Fn: padLeft},
+	{Name: "repeat-str", Fn: repeatStr},
+	{Name: "chars", Fn: chars},
 }
 
-func add(args ...object.Object) object.Object {
-	var result object.Object = &object.Integer{Value: 0}
+var builtinIndex = map[string]int{}
 
-	for _, arg := range args {
-		result = subAdd(result, arg)
+func init() {
+	for i, b := range Builtins {
+		builtinIndex[b.Name] = i
 	}
-	return result
 }
 
-func subAdd(total, arg object.Object) object.Object {
-	switch total := total.(type) {
-	case *object.Integer:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Integer{Value: total.Value + arg.Value}
-		case *object.Float:
-			return &object.Float{Value: float64(total.Value) + arg.Value}
-		}
-	case *object.Float:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Float{Value: total.Value + float64(arg.Value)}
-		case *object.Float:
-			return &object.Float{Value: total.Value + arg.Value}
+// LookupBuiltin returns the index of the named builtin in Builtins
+func LookupBuiltin(name string) (int, bool) {
+	i, ok := builtinIndex[name]
+	return i, ok
+}
+
+func operandError(op string, total, arg object.Object) object.Object {
+	return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("unsupported operand types for %s: %s and %s", op, typeName(total), typeName(arg))}
+}
+
+func unaryOperandError(op string, arg object.Object) object.Object {
+	return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("unsupported operand type for %s: %s", op, typeName(arg))}
+}
+
+func arityError(name string, got int, expected string) *object.Error {
+	return &object.Error{Kind: object.ARITY_ERROR, Message: fmt.Sprintf("wrong number of arguments to %s, got %d, expected %s", name, got, expected)}
+}
+
+func nativeBool(b bool) object.Object {
+	if b {
+		return &consts.TrueBool
+	}
+	return &consts.FalseBool
+}
+
+func typeName(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return "NIL"
+	}
+	return obj.Type()
+}
+
+// realizeAll realizes the lazy sequences in args before they're printed,
+// returning the first error that raises
+func realizeAll(args []object.Object) object.Object {
+	for _, arg := range args {
+		if err := Realize(arg); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func subtract(args ...object.Object) object.Object {
-	var result object.Object = args[0]
+func str(args ...object.Object) object.Object {
+	if err := realizeAll(args); err != nil {
+		return err
+	}
 
-	for _, arg := range args[1:] {
-		result = sub(result, arg)
+	var s strings.Builder
+	for _, arg := range args {
+		s.WriteString(arg.Inspect())
 	}
-	return result
+	return &object.String{Value: s.String()}
 }
 
-func sub(total, arg object.Object) object.Object {
-	switch total := total.(type) {
-	case *object.Integer:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Integer{Value: total.Value - arg.Value}
-		case *object.Float:
-			return &object.Float{Value: float64(total.Value) - arg.Value}
-		}
-	case *object.Float:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Float{Value: total.Value - float64(arg.Value)}
-		case *object.Float:
-			return &object.Float{Value: total.Value - arg.Value}
-		}
+func print(args ...object.Object) object.Object {
+	if err := realizeAll(args); err != nil {
+		return err
 	}
-	return nil
+
+	for _, arg := range args {
+		fmt.Print(arg.Inspect())
+	}
+	return &consts.Nil
 }
 
-func multiply(args ...object.Object) object.Object {
-	var result object.Object = &object.Integer{Value: 1}
+func println(args ...object.Object) object.Object {
+	if err := realizeAll(args); err != nil {
+		return err
+	}
 
 	for _, arg := range args {
-		result = mul(result, arg)
+		fmt.Print(arg.Inspect())
 	}
-	return result
+	fmt.Println()
+	return &consts.Nil
 }
 
-func mul(total, arg object.Object) object.Object {
-	switch total := total.(type) {
-	case *object.Integer:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Integer{Value: total.Value * arg.Value}
-		case *object.Float:
-			return &object.Float{Value: float64(total.Value) * arg.Value}
+// throw raises its argument as the payload of an error, optionally
+// preceded by a kind for catch clauses to match. Throwing a caught error
+// raises it again with the same kind and payload.
+func throw(args ...object.Object) object.Object {
+	if len(args) == 0 || len(args) > 2 {
+		return &object.Error{Kind: object.ARITY_ERROR, Message: fmt.Sprintf("wrong number of arguments to throw, got %d, expected 1 or 2", len(args))}
+	}
+
+	payload := args[len(args)-1]
+	kind := object.THROWN_ERROR
+	if len(args) == 2 {
+		switch k := args[0].(type) {
+		case *object.String:
+			kind = k.Value
+		case *object.Keyword:
+			kind = k.Name
+		default:
+			return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("error kind must be a STRING or KEYWORD, got %s", typeName(args[0]))}
 		}
-	case *object.Float:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Float{Value: total.Value * float64(arg.Value)}
-		case *object.Float:
-			return &object.Float{Value: total.Value * arg.Value}
+	}
+
+	if caught, ok := payload.(*object.Error); ok {
+		if len(args) == 1 {
+			kind = caught.Kind
 		}
+		return &object.Error{Kind: kind, Message: caught.Message, Payload: caught.Payload}
 	}
-	return nil
+
+	return &object.Error{Kind: kind, Message: payload.Inspect(), Payload: payload}
 }
 
-func divide(args ...object.Object) object.Object {
-	var result object.Object = args[0]
+func errorArg(name string, args []object.Object) (*object.Error, object.Object) {
+	if len(args) != 1 {
+		return nil, &object.Error{Kind: object.ARITY_ERROR, Message: fmt.Sprintf("wrong number of arguments to %s, got %d, expected 1", name, len(args))}
+	}
 
-	for _, arg := range args[1:] {
-		result = div(result, arg)
+	err, ok := args[0].(*object.Error)
+	if !ok {
+		return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("argument to %s must be an ERROR, got %s", name, typeName(args[0]))}
 	}
-	return result
+	return err, nil
 }
 
-func div(total, arg object.Object) object.Object {
-	switch total := total.(type) {
-	case *object.Integer:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Integer{Value: total.Value / arg.Value}
-		case *object.Float:
-			return &object.Float{Value: float64(total.Value) / arg.Value}
-		}
-	case *object.Float:
-		switch arg := arg.(type) {
-		case *object.Integer:
-			return &object.Float{Value: total.Value / float64(arg.Value)}
-		case *object.Float:
-			return &object.Float{Value: total.Value / arg.Value}
+func errorKind(args ...object.Object) object.Object {
+	err, fail := errorArg("error-kind", args)
+	if fail != nil {
+		return fail
+	}
+	return &object.String{Value: err.Kind}
+}
+
+func errorMessage(args ...object.Object) object.Object {
+	err, fail := errorArg("error-message", args)
+	if fail != nil {
+		return fail
+	}
+	return &object.String{Value: err.Message}
+}
+
+func errorPayload(args ...object.Object) object.Object {
+	err, fail := errorArg("error-payload", args)
+	if fail != nil {
+		return fail
+	}
+	if err.Payload == nil {
+		return &consts.Nil
+	}
+	return err.Payload
+}
+
+// nameOf returns the name of a keyword or symbol, or the value of a string
+func nameOf(fn string, args []object.Object) (string, object.Object) {
+	if len(args) != 1 {
+		return "", arityError(fn, len(args), "1")
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Keyword:
+		return arg.Name, nil
+	case *object.Symbol:
+		return arg.Name, nil
+	case *object.String:
+		return arg.Value, nil
+	}
+	return "", &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("argument to %s must be a KEYWORD, SYMBOL or STRING, got %s", fn, typeName(args[0]))}
+}
+
+func keyword(args ...object.Object) object.Object {
+	n, err := nameOf("keyword", args)
+	if err != nil {
+		return err
+	}
+	return object.InternKeyword(n)
+}
+
+func symbol(args ...object.Object) object.Object {
+	n, err := nameOf("symbol", args)
+	if err != nil {
+		return err
+	}
+	return &object.Symbol{Name: n}
+}
+
+// gensyms counts the symbols gensym has made, to number the next
+var gensyms atomic.Int64
+
+// gensym returns a new symbol, named with its optional prefix and a number
+// no other call gives, for a macro to bind in its expansion without
+// capturing a name used by the code it's called with
+func gensym(args ...object.Object) object.Object {
+	prefix := "G__"
+	switch len(args) {
+	case 0:
+	case 1:
+		s, err := stringArg("gensym", args[0])
+		if err != nil {
+			return err
 		}
+		prefix = s
+	default:
+		return arityError("gensym", len(args), "0 or 1")
 	}
-	return nil
+	return &object.Symbol{Name: fmt.Sprintf("%s%d", prefix, gensyms.Add(1))}
 }
 
-func str(args ...object.Object) object.Object {
-	var s strings.Builder
+func getName(args ...object.Object) object.Object {
+	n, err := nameOf("name", args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: n}
+}
 
-	for _, arg := range args {
-		s.WriteString(arg.Inspect())
+func isKeyword(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("keyword?", len(args), "1")
 	}
-	return &object.String{Value: s.String()}
+	_, ok := args[0].(*object.Keyword)
+	return nativeBool(ok)
 }
 
-func print(args ...object.Object) object.Object {
-	for _, arg := range args {
-		fmt.Printf(arg.Inspect())
+func isSymbol(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("symbol?", len(args), "1")
 	}
-	return nil
+	_, ok := args[0].(*object.Symbol)
+	return nativeBool(ok)
 }
 
-func println(args ...object.Object) object.Object {
-	for _, arg := range args {
-		fmt.Printf(arg.Inspect())
+func isNil(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("nil?", len(args), "1")
 	}
-	fmt.Println()
-	return nil
+	_, ok := args[0].(*object.Nil)
+	return nativeBool(ok)
+}
+
+// isSome reports whether its argument is anything but nil, false included
+func isSome(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("some?", len(args), "1")
+	}
+	_, ok := args[0].(*object.Nil)
+	return nativeBool(!ok)
 }
@@ -1,7 +1,10 @@
-package eval
+package eval_test
 
 import (
+	"sync"
 	"testing"
+
+	"lo/object"
 )
 
 func TestAdd(t *testing.T) {
@@ -15,7 +18,7 @@ func TestAdd(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -31,7 +34,7 @@ func TestSubtract(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -47,7 +50,7 @@ func TestMultiply(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -55,16 +58,89 @@ func TestMultiply(t *testing.T) {
 func TestDivide(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected string
 	}{
-		{"(/ 1 2)", 0},
-		{"(/ 1 2 3)", 0},
-		{"(/ 1 2 3 4)", 0},
+		{"(/ 1 2)", "RATIO 1/2"},
+		{"(/ 1 2 3)", "RATIO 1/6"},
+		{"(/ 1 2 3 4)", "RATIO 1/24"},
+		{"(/ 4 2)", "INTEGER 2"},
+		{"(/ 6 4)", "RATIO 3/2"},
+		{"(/ 1 0)", "ERROR: division by zero\n    at test:1:1"},
+		// With one argument - negates and / takes the reciprocal
+		{"(- 5)", "INTEGER -5"},
+		{"(- -9223372036854775808)", "INTEGER 9223372036854775808"},
+		{"(- 1/2)", "RATIO -1/2"},
+		{"(- 2.5)", "FLOAT -2.500000"},
+		{"(/ 2)", "RATIO 1/2"},
+		{"(/ -4)", "RATIO -1/4"},
+		{"(/ 1)", "INTEGER 1"},
+		{"(/ 2/3)", "RATIO 3/2"},
+		{"(/ 4.0)", "FLOAT 0.250000"},
+		{"(/ 0)", "ERROR: division by zero\n    at test:1:1"},
+		{"(- \"a\")", "ERROR: unsupported operand type for -: STRING\n    at test:1:1"},
+		{"(/ :a)", "ERROR: unsupported operand type for /: KEYWORD\n    at test:1:1"},
+		{"(nth [1] 99999999999999999999)", "ERROR: index 99999999999999999999 out of range for nth\n    at test:1:1"},
+		{"(try (take 99999999999999999999 [1]) (catch :index-error e (error-message e)))", "STRING index 99999999999999999999 out of range for take"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestNumericTower(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(+ 9223372036854775807 1)", "INTEGER 9223372036854775808"},
+		{"(* 9223372036854775807 2)", "INTEGER 18446744073709551614"},
+		{"(- -9223372036854775807 2)", "INTEGER -9223372036854775809"},
+		{"(* -9223372036854775808 -1)", "INTEGER 9223372036854775808"},
+		{"(- (+ 9223372036854775807 1) 1)", "INTEGER 9223372036854775807"},
+		{"(/ (* 9223372036854775807 2) 2)", "INTEGER 9223372036854775807"},
+		{"(/ -9223372036854775808 -1)", "INTEGER 9223372036854775808"},
+		{"(= (+ 9223372036854775807 1) (+ 9223372036854775807 1))", "BOOLEAN true"},
+		{"(get {(+ 9223372036854775807 1) :big} (* 4611686018427387904 2))", "KEYWORD :big"},
+		{"(+ (/ 1 3) (/ 2 3))", "INTEGER 1"},
+		{"(- (/ 1 2) (/ 1 3))", "RATIO 1/6"},
+		{"(* (/ 2 3) 3)", "INTEGER 2"},
+		{"(/ (/ 1 2) (/ 1 4))", "INTEGER 2"},
+		{"(/ -2 4)", "RATIO -1/2"},
+		{"(+ (/ 1 2) 1.5)", "FLOAT 2.000000"},
+		{"(/ 1.0 0)", "FLOAT +Inf"},
+		{"(= (/ 1 2) (/ 2 4))", "BOOLEAN true"},
+		{"(< (/ 1 3) (/ 1 2) 1 1.5 (+ 9223372036854775807 1))", "BOOLEAN true"},
+		{"(> (/ 1 3) 0 -18446744073709551614)", "BOOLEAN true"},
+		{"(match (/ 1 2) (RATIO r) (* r 4))", "INTEGER 2"},
+		{"(quot 7 2)", "INTEGER 3"},
+		{"(quot -7 2)", "INTEGER -3"},
+		{"(rem 7 2)", "INTEGER 1"},
+		{"(rem -7 2)", "INTEGER -1"},
+		{"(rem 7 -2)", "INTEGER 1"},
+		{"(mod -7 2)", "INTEGER 1"},
+		{"(mod 7 -2)", "INTEGER -1"},
+		{"(mod 6 -2)", "INTEGER 0"},
+		{"(quot -9223372036854775808 -1)", "INTEGER 9223372036854775808"},
+		{"(mod (* 9223372036854775807 3) 10)", "INTEGER 1"},
+		{"(quot 1.5 1)", "FLOAT 1.000000"},
+		{"(mod -1.5 1)", "FLOAT 0.500000"},
+		{"(quot 1 0)", "ERROR: division by zero\n    at test:1:1"},
+		{"(mod 1.5 0)", "ERROR: division by zero\n    at test:1:1"},
+		{"(rem (/ 1 2) 1)", "ERROR: unsupported operand types for rem: RATIO and INTEGER\n    at test:1:1"},
+		{"(quot 1)", "ERROR: wrong number of arguments to quot, got 1, expected 2\n    at test:1:1"},
+		{`(+ 1 "a")`, "ERROR: unsupported operand types for +: INTEGER and STRING\n    at test:1:1"},
+		{`(try (/ 1 0) (catch "divide-by-zero" e (error-message e)))`, "STRING division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
 	}
 }
 
@@ -79,7 +155,576 @@ func TestStr(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testStringObject(t, evaluated, tt.expected)
 	}
 }
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(= 1 1)", "BOOLEAN true"},
+		{"(= 1 2)", "BOOLEAN false"},
+		{"(= 1 1 1)", "BOOLEAN true"},
+		{"(= 1 1 2)", "BOOLEAN false"},
+		{"(= 1)", "BOOLEAN true"},
+		{"(= 1 1.0)", "BOOLEAN true"},
+		{"(= 1.0 1)", "BOOLEAN true"},
+		{"(= 1 1.5)", "BOOLEAN false"},
+		{"(= 1/2 0.5)", "BOOLEAN true"},
+		{"(= 0.5 (/ 1 2) 0.5)", "BOOLEAN true"},
+		{"(= (+ 9223372036854775807 1) 9223372036854775808.0)", "BOOLEAN true"},
+		{"(= [1 2.0] [1.0 2])", "BOOLEAN true"},
+		{"(not= 1 1.0)", "BOOLEAN false"},
+		{"(= 2 \"2\")", "BOOLEAN false"},
+		{"(= 1.0 :a)", "BOOLEAN false"},
+		{"(= (/ 0.0 0.0) (/ 0.0 0.0))", "BOOLEAN false"},
+		// Equal numbers are the same map key
+		{"(get {1 :a} (/ 2 2))", "KEYWORD :a"},
+		{"(count #{1 (/ 3 3) (- (+ 9223372036854775807 1) 9223372036854775807)})", "INTEGER 1"},
+		{"(= 1.5 1.5)", "BOOLEAN true"},
+		{`(= "a" "a")`, "BOOLEAN true"},
+		{`(= "a" :a)`, "BOOLEAN false"},
+		{"(= :a :a)", "BOOLEAN true"},
+		{"(= 'a 'a)", "BOOLEAN true"},
+		{"(= nil nil)", "BOOLEAN true"},
+		{"(= nil false)", "BOOLEAN false"},
+		{"(= [1 [2 3]] [1 [2 3]])", "BOOLEAN true"},
+		{"(= [1 2] [1 2 3])", "BOOLEAN false"},
+		{"(= [1 2] '(1 2))", "BOOLEAN true"},
+		{"(= {:a 1 :b [2]} {:b [2] :a 1})", "BOOLEAN true"},
+		{"(= {:a 1} {:a 2})", "BOOLEAN false"},
+		{"(= {:a 1} {:b 1})", "BOOLEAN false"},
+		{"(= + +)", "BOOLEAN true"},
+		{"(= (\\ [] 1) (\\ [] 1))", "BOOLEAN false"},
+		{"(not= 1 2)", "BOOLEAN true"},
+		{"(not= [1] [1])", "BOOLEAN false"},
+		{"(=)", "ERROR: wrong number of arguments to =, got 0, expected at least 1\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(< 1 2)", "BOOLEAN true"},
+		{"(< 2 1)", "BOOLEAN false"},
+		{"(< 1 2 3)", "BOOLEAN true"},
+		{"(< 1 3 2)", "BOOLEAN false"},
+		{"(< 1 1)", "BOOLEAN false"},
+		{"(<= 1 1 2)", "BOOLEAN true"},
+		{"(> 3 2 1)", "BOOLEAN true"},
+		{"(>= 3 3 4)", "BOOLEAN false"},
+		{"(< 1 1.5)", "BOOLEAN true"},
+		{"(>= 2.0 2)", "BOOLEAN true"},
+		{"(< 5)", "BOOLEAN true"},
+		{`(< "apple" "banana")`, "BOOLEAN true"},
+		{`(> "a" "b")`, "BOOLEAN false"},
+		{`(< 1 "a")`, "ERROR: cannot compare INTEGER and STRING with <\n    at test:1:1"},
+		{`(> 1 2 "a")`, "ERROR: cannot compare INTEGER and STRING with >\n    at test:1:1"},
+		{"(<)", "ERROR: wrong number of arguments to <, got 0, expected at least 1\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestNot(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(not false)", "BOOLEAN true"},
+		{"(not nil)", "BOOLEAN true"},
+		{"(not 0)", "BOOLEAN false"},
+		{"(not [])", "BOOLEAN false"},
+		{"(not)", "ERROR: wrong number of arguments to not, got 0, expected 1\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestAtoms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(atom 1)", "ATOM (atom 1)"},
+		{"(deref (atom [1 2]))", "LIST [1 2]"},
+		{"(def a (atom 1)) @a", "INTEGER 1"},
+		{"(def a (atom 1)) (reset! a 5) @a", "INTEGER 5"},
+		{"(def a (atom 1)) (reset! a 5)", "INTEGER 5"},
+		{"(def a (atom 1)) (swap! a (\\ [n] (+ n 1)))", "INTEGER 2"},
+		{"(def a (atom 1)) (swap! a + 2 3) @a", "INTEGER 6"},
+		{"(def a (atom {})) (swap! a assoc :k 1) @a", "MAP {:k 1}"},
+		{"(def a (atom 1)) [(compare-and-set! a 1 2) @a]", "LIST [true 2]"},
+		{"(def a (atom 1)) [(compare-and-set! a 3 4) @a]", "LIST [false 1]"},
+		{"(def a (atom [1])) (compare-and-set! a [1] [2])", "BOOLEAN true"},
+		{"(def a (atom [1])) (def s (lazy-seq (do (deref a) [1]))) [(compare-and-set! a s 2) @a]", "LIST [true 2]"},
+		{"(def a (atom [1])) (def s (lazy-seq (do (reset! a [1]) [1]))) [(compare-and-set! a s 2) @a]", "LIST [true 2]"},
+		{"(def a (atom [1])) (def s (lazy-seq (do (reset! a [3]) [1]))) [(compare-and-set! a s 2) @a]", "LIST [false [3]]"},
+		{"(def a (atom 1)) (reset! a a) (str a)", "STRING (atom (atom ...))"},
+		{"(def a (atom 1)) (reset! a [a 1]) a", "ATOM (atom [(atom ...) 1])"},
+		{"(def a (atom 1)) [a a]", "LIST [(atom 1) (atom 1)]"},
+		{"(defn counter [] (let [n (atom 0)] (\\ [] (swap! n + 1)))) (def c (counter)) (c) (c)", "INTEGER 2"},
+		{"(def a (atom 1)) (swap! a (\\ [n] (foo)))", "ERROR: identifier not found: foo\n    at lambda (test:1:35)\n    at test:1:18"},
+		{"(atom)", "ERROR: wrong number of arguments to atom, got 0, expected 1\n    at test:1:1"},
+		{"(swap! (atom 1))", "ERROR: wrong number of arguments to swap!, got 1, expected at least 2\n    at test:1:1"},
+		{"(deref 1)", "ERROR: first argument to deref must be an ATOM, got INTEGER\n    at test:1:1"},
+		{"@[1]", "ERROR: first argument to deref must be an ATOM, got LIST\n    at test:1:1"},
+		{"(reset! nil 1)", "ERROR: first argument to reset! must be an ATOM, got NIL\n    at test:1:1"},
+		{"(compare-and-set! 1 2 3)", "ERROR: first argument to compare-and-set! must be an ATOM, got INTEGER\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestAtomsAreConcurrent(t *testing.T) {
+	counter := object.NewAtom(&object.Integer{Value: 0})
+	globals := map[string]object.Object{"counter": counter}
+	input := "(loop [i 0] (when (< i 100) (swap! counter + 1) (recur (+ i 1))))"
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testEvalWith(t, input, globals)
+		}()
+	}
+	wg.Wait()
+
+	// testEvalWith runs each program on both back ends
+	testIntegerObject(t, counter.Deref(), 8*2*100)
+}
+
+func TestRealizedSeqsAreConcurrent(t *testing.T) {
+	seq := object.IteratorSeq(object.NewList([]object.Object{
+		&object.Integer{Value: 1}, &object.Integer{Value: 2}, &object.Integer{Value: 3},
+	}).Iterator())
+	globals := map[string]object.Object{"s": seq}
+	if result := testEvalWith(t, "(count s)", globals); inspect(result) != "INTEGER 3" {
+		t.Fatalf("wrong count, got %s", inspect(result))
+	}
+	input := "(loop [i 0 acc 0] (if (< i 100) (recur (+ i 1) (+ acc (reduce + s) (match s [a & r] a))) acc))"
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := testEvalWith(t, input, globals); inspect(result) != "INTEGER 700" {
+				t.Errorf("wrong result, got %s", inspect(result))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSequences(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(first [1 2 3])", "INTEGER 1"},
+		{"(first [])", "NIL nil"},
+		{"(first nil)", "NIL nil"},
+		{"(first '(a b))", "SYMBOL a"},
+		{`(first "héllo")`, "STRING h"},
+		{"(first {:a 1})", "LIST [:a 1]"},
+		{"(rest [1 2 3])", "LIST [2 3]"},
+		{"(rest [])", "LIST []"},
+		{"(cons 0 [1 2])", "LIST [0 1 2]"},
+		{"(cons 'do '((f) (g)))", "FORM (do (f) (g))"},
+		{"(cons 1 nil)", "LIST [1]"},
+		{"(conj [1 2] 3 4)", "LIST [1 2 3 4]"},
+		{"(conj '(1 2) 3 4)", "FORM (4 3 1 2)"},
+		{"(conj nil 1)", "LIST [1]"},
+		{"(conj {:a 1} [:b 2] [:a 3])", "MAP {:a 3 :b 2}"},
+		{"(let [xs [1 2]] (conj xs 3) xs)", "LIST [1 2]"},
+		{"(nth [1 2 3] 1)", "INTEGER 2"},
+		{"(nth [1 2 3] 3 :none)", "KEYWORD :none"},
+		{`(nth "héllo" 1)`, "STRING é"},
+		{"(count [1 2 3])", "INTEGER 3"},
+		{"(count {:a 1 :b 2})", "INTEGER 2"},
+		{`(count "héllo")`, "INTEGER 5"},
+		{"(count nil)", "INTEGER 0"},
+		{"(empty? [])", "BOOLEAN true"},
+		{"(empty? [nil])", "BOOLEAN false"},
+		{"(concat [1] nil '(2) [3])", "FORM (1 2 3)"},
+		{"(reverse [1 2 3])", "LIST [3 2 1]"},
+		{"(take 2 [1 2 3])", "LIST [1 2]"},
+		{"(take 5 [1 2 3])", "LIST [1 2 3]"},
+		{"(take -1 [1 2 3])", "LIST []"},
+		{"(drop 2 [1 2 3])", "LIST [3]"},
+		{"(drop 5 [1 2 3])", "LIST []"},
+		{"(range 4)", "LIST [0 1 2 3]"},
+		{"(range 2 5)", "LIST [2 3 4]"},
+		{"(range 10 0 -3)", "LIST [10 7 4 1]"},
+		{"(range 0 1 1/3)", "LIST [0 1/3 2/3]"},
+		{"(range 0)", "LIST []"},
+		{"(map (\\ [x] (* x x)) [1 2 3])", "LIST [1 4 9]"},
+		{"(map + [1 2 3] [10 20])", "LIST [11 22]"},
+		{"(map :a [{:a 1} {:a 2}])", "LIST [1 2]"},
+		{"(map first {:a 1 :b 2})", "LIST [:a :b]"},
+		{"(filter (\\ [x] (> x 1)) [1 2 3])", "LIST [2 3]"},
+		{"(filter some? [1 nil false 2])", "LIST [1 false 2]"},
+		{"(reduce + [1 2 3 4])", "INTEGER 10"},
+		{"(reduce + 10 [1 2 3 4])", "INTEGER 20"},
+		{"(reduce + [])", "INTEGER 0"},
+		{"(reduce conj [] '(1 2))", "LIST [1 2]"},
+		{"(reduce (\\ [m [k v]] (assoc m v k)) {} {:a 1 :b 2})", "MAP {1 :a 2 :b}"},
+		{"(some (\\ [x] (and (> x 1) (* x 10))) [1 2 3])", "INTEGER 20"},
+		{"(some nil? [1 2])", "NIL nil"},
+		{"(every? (\\ [x] (> x 0)) [1 2 3])", "BOOLEAN true"},
+		{"(every? (\\ [x] (> x 1)) [1 2 3])", "BOOLEAN false"},
+		{"(every? nil? [])", "BOOLEAN true"},
+		{"(sort [3 1/2 2.5 1])", "LIST [1/2 1 2.500000 3]"},
+		{`(sort ["b" "c" "a"])`, "LIST [a b c]"},
+		{"(sort > [3 1 2])", "LIST [3 2 1]"},
+		{"(sort (\\ [a b] (- b a)) [3 1 2])", "LIST [3 2 1]"},
+		{"(sort-by :age [{:n 1 :age 30} {:n 2 :age 20} {:n 3 :age 30}])", "LIST [{:n 2 :age 20} {:n 1 :age 30} {:n 3 :age 30}]"},
+		{"(sort-by count > [[1] [1 2 3] [1 2]])", "LIST [[1 2 3] [1 2] [1]]"},
+		{"(group-by (\\ [x] (mod x 3)) (range 7))", "MAP {0 [0 3 6] 1 [1 4] 2 [2 5]}"},
+		{"(partition 2 [1 2 3 4 5])", "LIST [[1 2] [3 4]]"},
+		{"(partition 3 1 [1 2 3 4])", "LIST [[1 2 3] [2 3 4]]"},
+		{"(zip [1 2 3] [:a :b])", "LIST [[1 :a] [2 :b]]"},
+		{"(zip)", "LIST []"},
+		{"(flatten [1 [2 [3 '(4)]] [] 5])", "LIST [1 2 3 4 5]"},
+		{"(flatten [{:a 1}])", "LIST [{:a 1}]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestSequenceErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(first 1)", "ERROR: argument to first must be a sequence, got INTEGER\n    at test:1:1"},
+		{"(nth [1 2] 2)", "ERROR: index 2 out of range for sequence of length 2\n    at test:1:1"},
+		{"(nth [1 2] :a)", "ERROR: index argument to nth must be an INTEGER, got KEYWORD\n    at test:1:1"},
+		{"(take 1)", "ERROR: wrong number of arguments to take, got 1, expected 2\n    at test:1:1"},
+		{"(conj 1 2)", "ERROR: first argument to conj must be a LIST, FORM, LAZY_SEQ, MAP, SET or NIL, got INTEGER\n    at test:1:1"},
+		{"(conj {} [1])", "ERROR: conj onto a MAP takes [key value] entries, got [1]\n    at test:1:1"},
+		{"(range 0 10 0)", "ERROR: range step must not be zero\n    at test:1:1"},
+		{"(range :a)", "ERROR: arguments to range must be numbers, got KEYWORD\n    at test:1:1"},
+		{"(map 1 [1])", "ERROR: not a function, got INTEGER\n    at test:1:1"},
+		{"(map (\\ [x] (+ x :a)) [1])", "ERROR: unsupported operand types for +: INTEGER and KEYWORD\n    at lambda (test:1:13)\n    at test:1:1"},
+		{"(reduce (\\ [a b] a) [])", "ERROR: wrong number of arguments to lambda, got 0, expected 2\n    at test:1:1"},
+		{`(sort [1 "a"])`, "ERROR: cannot compare STRING and INTEGER with sort\n    at test:1:1"},
+		{"(group-by (\\ [x] [x]) [1 2 1])", "MAP {[1] [1 1] [2] [2]}"},
+		{"(group-by (\\ [x] [(* x 1.5)]) [1])", "ERROR: unusable as map key: LIST\n    at test:1:1"},
+		{"(partition 0 [1])", "ERROR: partition size and step must be positive\n    at test:1:1"},
+		{`(try (nth [] 0) (catch "index-error" e :caught))`, "KEYWORD :caught"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestLazySequences(t *testing.T) {
+	nat := "(defn nat [n] (lazy-seq (cons n (nat (+ n 1))))) "
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{nat + "(take 3 (nat 0))", "LAZY_SEQ (0 1 2)"},
+		{nat + "(first (drop 1000 (nat 0)))", "INTEGER 1000"},
+		{nat + "(nth (nat 0) 5)", "INTEGER 5"},
+		{nat + "(first (rest (rest (nat 0))))", "INTEGER 2"},
+		{nat + "(empty? (nat 0))", "BOOLEAN false"},
+		{"(empty? (lazy-seq nil))", "BOOLEAN true"},
+		{"(count (lazy-seq [1 2 3]))", "INTEGER 3"},
+		{"(lazy-seq)", "LAZY_SEQ ()"},
+		{"(take 4 (iterate (\\ [x] (* x 2)) 1))", "LAZY_SEQ (1 2 4 8)"},
+		{"(take 3 (repeat :a))", "LAZY_SEQ (:a :a :a)"},
+		{"(repeat 3 :a)", "LAZY_SEQ (:a :a :a)"},
+		{"(repeat -1 :a)", "LAZY_SEQ ()"},
+		{"(first (repeat 1000000000000 :a))", "KEYWORD :a"},
+		{"(take 5 (cycle [1 2]))", "LAZY_SEQ (1 2 1 2 1)"},
+		{"(take 5 (cycle []))", "LAZY_SEQ ()"},
+		{nat + "(take 3 (map (\\ [x] (* x x)) (nat 1)))", "LAZY_SEQ (1 4 9)"},
+		{nat + "(map + [10 20] (nat 1))", "LAZY_SEQ (11 22)"},
+		{nat + "(take 3 (filter (\\ [x] (= 0 (mod x 5))) (nat 1)))", "LAZY_SEQ (5 10 15)"},
+		{nat + "(take 4 (concat [:a] (nat 0)))", "LAZY_SEQ (:a 0 1 2)"},
+		{nat + "(take 2 (zip (nat 0) [:a :b :c]))", "LAZY_SEQ ([0 :a] [1 :b])"},
+		{nat + "(take 3 (cons :x (nat 0)))", "LAZY_SEQ (:x 0 1)"},
+		{nat + "(take 3 (conj (nat 0) :x :y))", "LAZY_SEQ (:y :x 0)"},
+		{nat + "(reduce + (take 100 (nat 1)))", "INTEGER 5050"},
+		{nat + "(some (\\ [x] (and (> x 10) x)) (nat 0))", "INTEGER 11"},
+		{nat + "(every? (\\ [x] (< x 10)) (nat 0))", "BOOLEAN false"},
+		{nat + "(vec (take 3 (nat 0)))", "LIST [0 1 2]"},
+		{nat + "(sort > (take 3 (nat 0)))", "LIST [2 1 0]"},
+		{nat + "(= (take 3 (nat 0)) [0 1 2])", "BOOLEAN true"},
+		{nat + "(= '(0 1) (take 2 (nat 0)))", "BOOLEAN true"},
+		{nat + "(= (take 3 (nat 0)) (take 2 (nat 0)))", "BOOLEAN false"},
+		{nat + "(let [[a b & more] (nat 10)] [a b (first more)])", "LIST [10 11 12]"},
+		{"(let [[a b & more :as all] (lazy-seq [1])] [a b more (count all)])", "LIST [1 nil [] 1]"},
+		{nat + "(loop [[x & xs] (nat 0) acc 0] (if (> x 4) acc (recur xs (+ acc x))))", "INTEGER 10"},
+		{nat + "(match (take 1 (nat 0)) (LAZY_SEQ s) (first s))", "INTEGER 0"},
+		{"(match (repeat 2 1) [a b] (+ a b) _ :nomatch)", "INTEGER 2"},
+		{"(match (repeat 3 1) [a b] :two [a b c] :three)", "KEYWORD :three"},
+		{"(match (lazy-seq nil) [] :empty _ :other)", "KEYWORD :empty"},
+		{nat + "(match (nat 0) [a b] :two [a b & more] [a b (take 2 more)])", "LIST [0 1 (2 3)]"},
+		{nat + "(match (map (\\ [x] (* x 10)) (take 2 (nat 1))) [a & r :as all] [a r (count all)])", "LIST [10 (20) 2]"},
+		{nat + "(match (filter (\\ [x] (> x 5)) (take 7 (nat 0))) [x] x)", "INTEGER 6"},
+		{nat + "(match (take 2 (nat 0)) [a & r] (match r [b & r] (match r [] [a b])))", "LIST [0 1]"},
+		{nat + "(loop [xs (take 3 (nat 1)) acc 0] (match xs [] acc [x & r] (recur r (+ acc x))))", "INTEGER 6"},
+		{"(defn fib [a b] (lazy-seq (cons a (fib b (+ a b))))) (nth (fib 0 1) 100)", "INTEGER 354224848179261915075"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestLaziness(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Only the elements needed are computed, each at most once
+		{"(let [c (atom 0) s (map (\\ [x] (swap! c (\\ [n] (+ n 1)))) (iterate (\\ [x] x) 0))] (first (rest s)) @c)", "INTEGER 2"},
+		{"(let [c (atom 0) s (map (\\ [x] (swap! c (\\ [n] (+ n 1)))) (iterate (\\ [x] x) 0))] (vec (take 3 s)) (vec (take 3 s)) @c)", "INTEGER 3"},
+		{"(let [c (atom 0) s (lazy-seq (swap! c (\\ [n] (+ n 1))) [1])] (count s) (count s) @c)", "INTEGER 1"},
+		{"(let [c (atom 0)] (lazy-seq (reset! c 1) nil) @c)", "INTEGER 0"},
+		{"(let [c (atom 0) s (map (\\ [x] (swap! c (\\ [n] (+ n 1)))) (iterate (\\ [x] x) 0))] (match s [a b] :two _ :more) @c)", "INTEGER 3"},
+		// Errors surface where the element is realized
+		{"(match (map (\\ [x] (/ 1 x)) (lazy-seq [1 0])) [a] :one [a b] :two)", "ERROR: division by zero\n    at lambda (test:1:20)\n    at test:1:1"},
+		{"(def s (map (\\ [x] (/ 1 x)) (iterate (\\ [x] (- x 1)) 2))) (nth s 1)", "INTEGER 1"},
+		{"(def s (map (\\ [x] (/ 1 x)) (iterate (\\ [x] (- x 1)) 2))) (count (take 5 s))", "ERROR: division by zero\n    at lambda (test:1:20)\n    at test:1:59"},
+		{"(first (lazy-seq 1))", "ERROR: lazy-seq body must return a sequence, got INTEGER\n    at test:1:1"},
+		{"(try (vec (take 3 (map (\\ [x] (throw x)) (repeat :boom)))) (catch e (error-payload e)))", "KEYWORD :boom"},
+		// Printing a sequence realizes it, raising the first error
+		{"(def s (map (\\ [x] (/ 1 x)) (iterate (\\ [x] (- x 1)) 1))) (println (take 2 s))", "ERROR: division by zero\n    at lambda (test:1:20)\n    at test:1:59"},
+		{"(def s (map (\\ [x] (/ 1 x)) (iterate (\\ [x] (- x 1)) 1))) (str [(take 2 s)])", "ERROR: division by zero\n    at lambda (test:1:20)\n    at test:1:59"},
+		{"(def s (map (\\ [x] (/ 1 x)) (iterate (\\ [x] (- x 1)) 1))) (try (str (take 2 s)) (catch e (error-kind e)))", "STRING divide-by-zero"},
+		{"(def s (map (\\ [x] (/ 1 x)) (iterate (\\ [x] (- x 1)) 1))) (vec (take 2 (concat (take 2 s) [5])))", "ERROR: division by zero\n    at lambda (test:1:20)\n    at test:1:59"},
+		{"(str (take 3 (iterate (\\ [x] (* x 2)) 1)))", "STRING (1 2 4)"},
+		// A sequence that needs itself to be realized is an error, not a deadlock
+		{"(def s (lazy-seq (cons 1 (rest s)))) (first s)", "ERROR: lazy sequence needs itself to be realized\n    at lambda (test:1:26)\n    at test:1:38"},
+		{"(def s (lazy-seq (cons 1 (rest s)))) (try (first s) (catch e (error-message e)))", "STRING lazy sequence needs itself to be realized"},
+		{"(def s (lazy-seq (cons 1 (rest s)))) (try (first s) (catch e (error-kind e)))", "STRING depth-error"},
+		{`(def s (lazy-seq (cons 1 (rest s)))) (try (first s) (catch "depth-error" e :depth))`, "KEYWORD :depth"},
+		// A failed element raises its error again each time it's realized
+		{"(def s (map (\\ [x] (/ 1 x)) (repeat 0))) (try (first s) (catch e nil)) (first s)", "ERROR: division by zero\n    at lambda (test:1:20)\n    at test:1:72"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestPersistentCollections(t *testing.T) {
+	bigList := "(def v (reduce conj [] (range 33000))) "
+	bigMap := "(def m (reduce (\\ [m i] (assoc m i (* i i))) {} (range 5000))) "
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Lists deeper than one level of the trie
+		{bigList + "[(count v) (nth v 0) (nth v 31) (nth v 32) (nth v 1024) (nth v 32767) (nth v 32768) (nth v 32999)]", "LIST [33000 0 31 32 1024 32767 32768 32999]"},
+		{bigList + "(= v (vec (range 33000)))", "BOOLEAN true"},
+		{bigList + "(reduce + v)", "INTEGER 544483500"},
+		{bigList + "(nth (assoc v 20000 :x) 20000)", "KEYWORD :x"},
+		// Old versions are unchanged by updates made from them
+		{"(let [a [1 2] b (conj a 3) c (conj a 4)] [a b c])", "LIST [[1 2] [1 2 3] [1 2 4]]"},
+		{"(let [a (vec (range 40)) b (assoc a 3 :x) c (conj a :y)] [(nth a 3) (nth b 3) (count a) (count c) (nth c 40)])", "LIST [3 :x 40 41 :y]"},
+		{"(let [a (vec (range 2000)) b (assoc a 1500 :x)] [(nth a 1500) (nth b 1500) (= (assoc b 1500 1500) a)])", "LIST [1500 :x true]"},
+		{"(let [m {:a 1} n (assoc m :b 2) o (dissoc n :a)] [m n o])", "LIST [{:a 1} {:a 1 :b 2} {:b 2}]"},
+		{bigMap + "(let [n (assoc m 7 :x)] [(get m 7) (get n 7)])", "LIST [49 :x]"},
+		{"(assoc [1 2] 0 :a 2 :c)", "LIST [:a 2 :c]"},
+		// rest and drop share the trie of the List they're given
+		{bigList + "(loop [xs v acc 0] (if (empty? xs) acc (recur (rest xs) (+ acc (first xs)))))", "INTEGER 544483500"},
+		{bigList + "(let [d (drop 32990 v)] [d (count d) (nth d 9) (= d (vec (range 32990 33000)))])", "LIST [[32990 32991 32992 32993 32994 32995 32996 32997 32998 32999] 10 32999 true]"},
+		{"(let [a (vec (range 40)) b (drop 30 a)] [(conj b :x) (assoc b 1 :y) (assoc b 10 :z) (rest b) a])", "LIST [[30 31 32 33 34 35 36 37 38 39 :x] [30 :y 32 33 34 35 36 37 38 39] [30 31 32 33 34 35 36 37 38 39 :z] [31 32 33 34 35 36 37 38 39] [0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25 26 27 28 29 30 31 32 33 34 35 36 37 38 39]]"},
+		{"(let [b (drop 1 [1 2 3])] [(conj b 4 5) (first b) (reverse b) (match b [x y] (+ x y))])", "LIST [[2 3 4 5] 2 [3 2] 5]"},
+		{"[(rest []) (drop 5 [1 2]) (drop -1 [1 2]) (conj (drop 2 [1 2]) 3)]", "LIST [[] [] [1 2] [3]]"},
+		// Maps keep the order their keys were added in
+		{bigMap + "[(count m) (get m 0) (get m 4999) (get m 5000) (take 3 (keys m))]", "LIST [5000 0 24990001 nil [0 1 2]]"},
+		{"(assoc {:a 1 :b 2} :a 3)", "MAP {:a 3 :b 2}"},
+		{"(assoc (dissoc {:a 1 :b 2} :a) :a 3)", "MAP {:b 2 :a 3}"},
+		{bigMap + "(let [n (reduce dissoc m (range 0 5000 2))] [(count n) (take 3 (keys n)) (get n 2) (get n 3) (count m)])", "LIST [2500 [1 3 5] nil 9 5000]"},
+		{bigMap + "(count (reduce dissoc m (range 5000)))", "INTEGER 0"},
+		{"(= (reduce (\\ [m i] (assoc m i i)) {} (range 100)) (reduce (\\ [m i] (assoc m i i)) {} (reverse (range 100))))", "BOOLEAN true"},
+		{"(assoc [1 2] 3 :x)", "ERROR: index 3 out of range for assoc on a list of length 2\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#{1 2 3}", "SET #{1 2 3}"},
+		{"#{}", "SET #{}"},
+		{"#{1 :a \"b\" nil 1 :a}", "SET #{1 :a b nil}"},
+		{"(let [x 5] #{x (+ x 1)})", "SET #{5 6}"},
+		{"(set [3 1 3 2 1])", "SET #{3 1 2}"},
+		{"(set \"hello\")", "SET #{h e l o}"},
+		{"(= #{1 2 3} #{3 2 1})", "BOOLEAN true"},
+		{"(= #{1 2} #{1 2 3})", "BOOLEAN false"},
+		{"(= #{1} [1])", "BOOLEAN false"},
+		{"(contains? #{1 2} 2)", "BOOLEAN true"},
+		{"(contains? #{1 2} 3)", "BOOLEAN false"},
+		{"(contains? #{1 2} \"1\")", "BOOLEAN false"},
+		{"(count #{1 2 2 3})", "INTEGER 3"},
+		{"(conj #{1 2} 2 3)", "SET #{1 2 3}"},
+		{"(disj #{1 2 3} 2 4)", "SET #{1 3}"},
+		{"(union #{1 2} #{2 3} #{4})", "SET #{1 2 3 4}"},
+		{"(union)", "SET #{}"},
+		{"(intersection #{1 2 3 4} #{4 3 5} #{3 4})", "SET #{3 4}"},
+		{"(difference #{1 2 3 4} #{2} #{4 5})", "SET #{1 3}"},
+		{"(subset? #{1 2} #{1 2 3})", "BOOLEAN true"},
+		{"(subset? #{1 4} #{1 2 3})", "BOOLEAN false"},
+		{"(superset? #{1 2 3} #{3})", "BOOLEAN true"},
+		{"(superset? #{1} #{1 2})", "BOOLEAN false"},
+		{"(vec (map (\\ [x] (* x 10)) #{1 2}))", "LIST [10 20]"},
+		{"(let [s #{1 2} t (conj s 3) u (disj s 1)] [s t u])", "LIST [#{1 2} #{1 2 3} #{2}]"},
+		{"(first (rest '#{a b}))", "SYMBOL b"},
+		{"(let [x 1] `#{~x y})", "SET #{1 y}"},
+		{"(defmacro members [s] (count s)) (members #{1 2 3})", "INTEGER 3"},
+		{"(match #{1} (SET s) (count s))", "INTEGER 1"},
+		{"(defn f [n] #{n (if (> n 0) (recur (- n 1)) 0)}) 1", "ERROR: recur must be in tail position\n    at test:1:29"},
+		{"#{[1 2] [1 2]}", "SET #{[1 2]}"},
+		{"(set [[1 2] [3 4] [1 2]])", "SET #{[1 2] [3 4]}"},
+		{"(contains? #{[1 [2]]} [1 [2]])", "BOOLEAN true"},
+		{"(contains? #{[1 2]} [2 1])", "BOOLEAN false"},
+		{`(count #{["a" "bc"] ["ab" "c"] [12] [1 2]})`, "INTEGER 4"},
+		{"(contains? #{#{1 2}} #{2 1})", "BOOLEAN true"},
+		{"(get {{:a 1 :b [2]} :x} {:b [2] :a 1})", "KEYWORD :x"},
+		{"(get {{:a 1} :x} {:a 2})", "NIL nil"},
+		{"(count #{{:a #{1 2}} {:a #{2 1}} {:a #{1}}})", "INTEGER 2"},
+		{"(count #{[] {} #{}})", "INTEGER 3"},
+		{"#{'(1 2) [1 2]}", "SET #{(1 2)}"},
+		{"(contains? #{[1 2]} '(1 2))", "BOOLEAN true"},
+		{"(contains? #{'(1 2)} (lazy-seq [1 2]))", "BOOLEAN true"},
+		{"{(lazy-seq [1]) 1}", "MAP {(1) 1}"},
+		{"(get {[1] :a} (map (\\ [x] (+ x 1)) (lazy-seq [0])))", "KEYWORD :a"},
+		{"(get {1 :int} 1.0)", "NIL nil"},
+		{"(get {1 :int} 1.0 :none)", "KEYWORD :none"},
+		{"(get {[1] :a} [(\\ [] 1)])", "NIL nil"},
+		{"(contains? #{1} 1.0)", "BOOLEAN false"},
+		{"(contains? {1 2} (\\ [] 1))", "BOOLEAN false"},
+		{"(disj #{1} 1.0)", "SET #{1}"},
+		{"(dissoc {1 2} 1.5)", "MAP {1 2}"},
+		{"(conj #{} 1.5)", "ERROR: unusable as set member: FLOAT\n    at test:1:1"},
+		{"(assoc {} [1.5] 1)", "ERROR: unusable as map key: LIST\n    at test:1:1"},
+		{"#{[1.5]}", "ERROR: unusable as set member: LIST\n    at test:1:1"},
+		{"#{{:a (\\ [] 1)}}", "ERROR: unusable as set member: MAP\n    at test:1:1"},
+		{"(union #{1} [2])", "ERROR: arguments to union must be SETs, got LIST\n    at test:1:1"},
+		{"(disj [1] 1)", "ERROR: first argument to disj must be a SET, got LIST\n    at test:1:1"},
+		{"(contains? [1] 0)", "ERROR: first argument to contains? must be a MAP or SET, got LIST\n    at test:1:1"},
+		{"(intersection)", "ERROR: wrong number of arguments to intersection, got 0, expected at least 1\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(count "héllo wörld")`, "INTEGER 11"},
+		{`(count "")`, "INTEGER 0"},
+		{`(subs "héllo" 1 3)`, "STRING él"},
+		{`(subs "日本語" 1)`, "STRING 本語"},
+		{`(subs "abc" 3)`, "STRING "},
+		{`(upper-case "héllo")`, "STRING HÉLLO"},
+		{`(lower-case "ÀB")`, "STRING àb"},
+		{`(trim "  hi \n")`, "STRING hi"},
+		{`(split "a,b,,c" ",")`, "LIST [a b  c]"},
+		{`(split "añb" "")`, "LIST [a ñ b]"},
+		{`(join ", " [1 :a "b"])`, "STRING 1, :a, b"},
+		{`(join ["x" "y"])`, "STRING xy"},
+		{`(join "-" (take 3 (iterate (\ [x] (+ x 1)) 0)))`, "STRING 0-1-2"},
+		{`(replace "a-b-c" "-" "+")`, "STRING a+b+c"},
+		{`(starts-with? "hello" "he")`, "BOOLEAN true"},
+		{`(ends-with? "hello" "he")`, "BOOLEAN false"},
+		{`(includes? "hello" "ll")`, "BOOLEAN true"},
+		{`(index-of "añbñ" "ñ")`, "INTEGER 1"},
+		{`(index-of "añbñ" "ñ" 2)`, "INTEGER 3"},
+		{`(index-of "añbñ" "z")`, "NIL nil"},
+		{`(pad-left "7" 3 "0")`, "STRING 007"},
+		{`(pad-left "ñ" 3)`, "STRING   ñ"},
+		{`(pad-left "long" 2)`, "STRING long"},
+		{`(repeat-str "ab" 3)`, "STRING ababab"},
+		{`(repeat-str "ab" 0)`, "STRING "},
+		{`(chars "añ")`, "LIST [a ñ]"},
+		{`(nth "añb" 1)`, "STRING ñ"},
+		{`(subs "héllo" 2 9)`, "ERROR: index 9 out of range for subs on a string of length 5\n    at test:1:1"},
+		{`(subs "héllo" 3 2)`, "ERROR: end index 2 is before start index 3\n    at test:1:1"},
+		{`(subs "héllo" 3 -1)`, "ERROR: end index -1 is before start index 3\n    at test:1:1"},
+		{`(subs "héllo" 2 2)`, "STRING "},
+		{`(subs "abc" -1)`, "ERROR: index -1 out of range for subs on a string of length 3\n    at test:1:1"},
+		{`(index-of "abc" "a" 4)`, "ERROR: index 4 out of range for index-of on a string of length 3\n    at test:1:1"},
+		{`(repeat-str "ab" -1)`, "ERROR: count -1 out of range for repeat-str\n    at test:1:1"},
+		{`(pad-left "a" 100000000000)`, "ERROR: width 100000000000 out of range for pad-left\n    at test:1:1"},
+		{`(try (subs "abc" 5) (catch e (error-kind e)))`, "STRING index-error"},
+		{`(pad-left "a" 3 "xy")`, "ERROR: padding for pad-left must be a single character, got \"xy\"\n    at test:1:1"},
+		{`(upper-case :a)`, "ERROR: argument to upper-case must be a STRING, got KEYWORD\n    at test:1:1"},
+		{`(split "a" 1)`, "ERROR: argument to split must be a STRING, got INTEGER\n    at test:1:1"},
+		{`(subs "abc" "1")`, "ERROR: index argument to subs must be an INTEGER, got STRING\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
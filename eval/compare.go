@@ -0,0 +1,94 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"lo/object"
+)
+
+// equals reports whether all its arguments are equal to each other
+func equals(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("=", len(args), "at least 1")
+	}
+
+	for _, arg := range args[1:] {
+		if !object.Equal(args[0], arg) {
+			return nativeBool(false)
+		}
+	}
+	return nativeBool(true)
+}
+
+func notEquals(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("not=", len(args), "at least 1")
+	}
+	return nativeBool(!object.IsTruthy(equals(args...)))
+}
+
+func not(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("not", len(args), "1")
+	}
+	return nativeBool(!object.IsTruthy(args[0]))
+}
+
+// ordering returns a builtin that reports whether each argument stands in
+// relation to the next, as decided by ok on the result of compare
+func ordering(op string, ok func(c int) bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) == 0 {
+			return arityError(op, len(args), "at least 1")
+		}
+
+		result := true
+		for i := 1; i < len(args); i++ {
+			c, err := compare(op, args[i-1], args[i])
+			if err != nil {
+				return err
+			}
+			result = result && ok(c)
+		}
+		return nativeBool(result)
+	}
+}
+
+// compare orders two numbers, mixing kinds of number freely, or two
+// strings
+func compare(op string, a, b object.Object) (int, object.Object) {
+	ra, rb := rankOf(a), rankOf(b)
+	switch {
+	case ra != notNumber && rb != notNumber:
+		return compareMixed(a, b), nil
+	case ra == notNumber && rb == notNumber:
+		if a, ok := a.(*object.String); ok {
+			if b, ok := b.(*object.String); ok {
+				return strings.Compare(a.Value, b.Value), nil
+			}
+		}
+	}
+	return 0, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("cannot compare %s and %s with %s", typeName(a), typeName(b), op)}
+}
+
+// compareMixed orders two numbers at the higher of their ranks
+func compareMixed(a, b object.Object) int {
+	switch max(rankOf(a), rankOf(b)) {
+	case integerRank:
+		return compareNumbers(a.(*object.Integer).Value, b.(*object.Integer).Value)
+	case floatRank:
+		return compareNumbers(toFloat(a), toFloat(b))
+	}
+	return toRat(a).Cmp(toRat(b))
+}
+
+func compareNumbers[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
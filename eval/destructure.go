@@ -0,0 +1,306 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/consts"
+	"lo/object"
+)
+
+// ParsePattern parses the target of a binding: a name, a list pattern
+// [a [b c] & more :as all] or a map pattern {a :a :keys [x y] :or {x 0}
+// :as m}. invalid is the message for a target that is none of these.
+func ParsePattern(exp ast.Expression, invalid string) (*object.Pattern, *object.Error) {
+	parse := func(exp ast.Expression) (*object.Pattern, *object.Error) {
+		return ParsePattern(exp, invalid)
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return namePattern(exp), nil
+	case *ast.ListLiteral:
+		return parseListPattern(exp, parse)
+	case *ast.MapLiteral:
+		return parseMapPattern(exp, parse)
+	}
+	return nil, patternError(invalid)
+}
+
+// patternParser parses the patterns nested in a list or map pattern
+type patternParser func(exp ast.Expression) (*object.Pattern, *object.Error)
+
+func namePattern(ident *ast.Identifier) *object.Pattern {
+	return &object.Pattern{Kind: object.NamePattern, Token: ident.Token, Name: ident}
+}
+
+func parseListPattern(ll *ast.ListLiteral, parse patternParser) (*object.Pattern, *object.Error) {
+	p := &object.Pattern{Kind: object.ListPattern, Token: ll.Token}
+
+	exps := ll.Expressions
+	for i := 0; i < len(exps); i++ {
+		if kw, ok := exps[i].(*ast.KeywordLiteral); ok && kw.Value == "as" {
+			name, ok := next(exps, i).(*ast.Identifier)
+			if !ok {
+				return nil, patternError(":as in a pattern must be followed by a name")
+			}
+			p.Name = name
+			i++
+			continue
+		}
+		if p.Name != nil {
+			return nil, patternError(":as must come last in a list pattern")
+		}
+
+		if ident, ok := exps[i].(*ast.Identifier); ok && ident.Value == "&" {
+			if p.Rest != nil {
+				return nil, patternError("& can only appear once in a list pattern")
+			}
+			if next(exps, i) == nil {
+				return nil, patternError("& in a list pattern must be followed by a pattern")
+			}
+			rest, err := parse(exps[i+1])
+			if err != nil {
+				return nil, err
+			}
+			p.Rest = rest
+			i++
+			continue
+		}
+		if p.Rest != nil {
+			return nil, patternError("only :as can follow the rest of a list pattern")
+		}
+
+		elem, err := parse(exps[i])
+		if err != nil {
+			return nil, err
+		}
+		p.Elements = append(p.Elements, elem)
+	}
+	return p, nil
+}
+
+func parseMapPattern(ml *ast.MapLiteral, parse patternParser) (*object.Pattern, *object.Error) {
+	p := &object.Pattern{Kind: object.MapPattern, Token: ml.Token, Defaults: map[string]ast.Expression{}}
+
+	for i, target := range ml.Keys {
+		value := ml.Values[i]
+		if kw, ok := target.(*ast.KeywordLiteral); ok {
+			switch kw.Value {
+			case "keys":
+				names, ok := value.(*ast.ListLiteral)
+				if !ok {
+					return nil, patternError(":keys in a map pattern must be a list of names")
+				}
+				for _, exp := range names.Expressions {
+					name, ok := exp.(*ast.Identifier)
+					if !ok {
+						return nil, patternError(":keys in a map pattern must be a list of names")
+					}
+					p.Keys = append(p.Keys, object.InternKeyword(name.Value))
+					p.Values = append(p.Values, namePattern(name))
+				}
+				continue
+			case "as":
+				name, ok := value.(*ast.Identifier)
+				if !ok {
+					return nil, patternError(":as in a pattern must be followed by a name")
+				}
+				p.Name = name
+				continue
+			case "or":
+				defaults, ok := value.(*ast.MapLiteral)
+				if !ok {
+					return nil, patternError(":or in a map pattern must map names to defaults")
+				}
+				for j, exp := range defaults.Keys {
+					name, ok := exp.(*ast.Identifier)
+					if !ok {
+						return nil, patternError(":or in a map pattern must map names to defaults")
+					}
+					p.Defaults[name.Value] = defaults.Values[j]
+				}
+				continue
+			}
+		}
+
+		sub, err := parse(target)
+		if err != nil {
+			return nil, err
+		}
+		key := Quote(value)
+		if !object.IsHashable(key) {
+			return nil, patternError("keys in a map pattern must be constants usable as map keys")
+		}
+		p.Keys = append(p.Keys, key.(object.Hashable))
+		p.Values = append(p.Values, sub)
+	}
+	return p, nil
+}
+
+// next returns the expression after exps[i], or nil at the end
+func next(exps []ast.Expression, i int) ast.Expression {
+	if i+1 < len(exps) {
+		return exps[i+1]
+	}
+	return nil
+}
+
+func patternError(msg string) *object.Error {
+	return &object.Error{Kind: object.SYNTAX_ERROR, Message: msg}
+}
+
+// Destructure takes val apart with p, returning a value for each of the
+// names p binds, in the order of p.Bindings. nil destructures as an empty
+// list or map, so missing pieces are nil, except that a name with an :or
+// default is left Go nil for the caller to evaluate its default. A value
+// of the wrong shape is an error located at the pattern it didn't fit.
+func Destructure(p *object.Pattern, val object.Object) ([]object.Object, *object.Error) {
+	vals := []object.Object{}
+	if err := destructure(p, val, &vals); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// destructureLazy destructures a LazySeq with a list pattern, realizing
+// only the elements the pattern names and binding any rest pattern to the
+// rest of the LazySeq
+func destructureLazy(p *object.Pattern, seq *object.LazySeq, vals *[]object.Object) *object.Error {
+	whole := seq
+	for _, elem := range p.Elements {
+		var v object.Object = &consts.Nil
+		if seq != nil {
+			v, seq = seq.Realize()
+			if v == nil {
+				v = &consts.Nil
+			} else if isError(v) {
+				return v.(*object.Error)
+			}
+		}
+		if err := destructure(elem, v, vals); err != nil {
+			return err
+		}
+	}
+	if p.Rest != nil {
+		var rest object.Object = object.NewList([]object.Object{})
+		if seq != nil {
+			rest = seq
+		}
+		if err := destructure(p.Rest, rest, vals); err != nil {
+			return err
+		}
+	}
+
+	if p.Name != nil {
+		*vals = append(*vals, whole)
+	}
+	return nil
+}
+
+func destructure(p *object.Pattern, val object.Object, vals *[]object.Object) *object.Error {
+	switch p.Kind {
+	case object.NamePattern:
+		*vals = append(*vals, val)
+		return nil
+
+	case object.ListPattern:
+		var elements []object.Object
+		switch val := val.(type) {
+		case *object.List:
+			elements = val.Elements()
+		case *object.Form:
+			elements = val.Elements
+		case *object.Nil:
+		case *object.LazySeq:
+			return destructureLazy(p, val, vals)
+		default:
+			return shapeError(p, val, "list")
+		}
+
+		for i, elem := range p.Elements {
+			var v object.Object = &consts.Nil
+			if i < len(elements) {
+				v = elements[i]
+			}
+			if err := destructure(elem, v, vals); err != nil {
+				return err
+			}
+		}
+		if p.Rest != nil {
+			rest := []object.Object{}
+			if len(elements) > len(p.Elements) {
+				rest = append(rest, elements[len(p.Elements):]...)
+			}
+			if err := destructure(p.Rest, object.NewList(rest), vals); err != nil {
+				return err
+			}
+		}
+
+	case object.MapPattern:
+		m, ok := val.(*object.Map)
+		if _, isNil := val.(*object.Nil); !ok && !isNil {
+			return shapeError(p, val, "map")
+		}
+
+		for i, key := range p.Keys {
+			var v object.Object
+			if m != nil {
+				v, _ = m.Get(key)
+			}
+			sub := p.Values[i]
+			if v == nil && (sub.Kind != object.NamePattern || p.Defaults[sub.Name.Value] == nil) {
+				v = &consts.Nil
+			}
+			if err := destructure(sub, v, vals); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Name != nil {
+		*vals = append(*vals, val)
+	}
+	return nil
+}
+
+func shapeError(p *object.Pattern, val object.Object, kind string) *object.Error {
+	err := &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("cannot destructure %s with a %s pattern %s", typeName(val), kind, p.Inspect())}
+	err.Locate(p.Token)
+	return err
+}
+
+// bindPattern destructures val with p into env, then evaluates the :or
+// default of each name left unbound, in order, in env
+func bindPattern(p *object.Pattern, val object.Object, env *object.Environment) object.Object {
+	if p.Kind == object.NamePattern {
+		bindName(p.Name, val, env)
+		return nil
+	}
+
+	vals, err := Destructure(p, val)
+	if err != nil {
+		return err
+	}
+	names, defaults := p.Bindings()
+	for i, name := range names {
+		if vals[i] != nil {
+			bindName(name, vals[i], env)
+		}
+	}
+	for i, name := range names {
+		if vals[i] != nil {
+			continue
+		}
+		val := Eval(defaults[i], env)
+		if isError(val) {
+			return val
+		}
+		bindName(name, val, env)
+	}
+	return nil
+}
+
+// bindName binds a name in the slot the resolver gave it in env
+func bindName(name *ast.Identifier, val object.Object, env *object.Environment) {
+	env.SetLocal(0, name.Slot, val)
+}
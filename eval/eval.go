@@ -7,6 +7,8 @@ import (
 	"lo/object"
 )
 
+// Eval evaluates node in env. Programs must have been through
+// ExpandMacros, which resolves where each identifier's binding lives.
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
@@ -14,7 +16,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return result
 
 	case *ast.ListExpression:
-		return evalList(node, env)
+		return evalList(node, env, false)
 
 	case *ast.IntLiteral:
 		return &object.Integer{Value: node.Value}
@@ -22,31 +24,88 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FloatLiteral:
 		return &object.Float{Value: node.Value}
 
+	case *ast.BigIntLiteral:
+		return &object.BigInt{Value: node.Value}
+
+	case *ast.RatioLiteral:
+		return object.NewRatio(node.Value)
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.KeywordLiteral:
+		return object.InternKeyword(node.Value)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.ListLiteral:
 		return evalListLiteral(node, env)
+	case *ast.MapLiteral:
+		return evalMapLiteral(node, env)
+	case *ast.SetLiteral:
+		return evalSetLiteral(node, env)
 	}
 
 	return nil
 }
 
 func evalProgram(exps []ast.Expression, env *object.Environment) object.Object {
-	var result object.Object
+	var result object.Object = &consts.Nil
 
 	for _, exp := range exps {
 		result = Eval(exp, env)
+		if isError(result) {
+			return result
+		}
 	}
 
 	return result
 }
 
-func evalList(le *ast.ListExpression, env *object.Environment) object.Object {
+// tailCall is returned in place of a value when a call to a lo function is
+// in tail position. callFunction unwinds it in a loop instead of recursing,
+// so tail-recursive functions run in constant Go stack space. Its arguments
+// are already bound, so arity errors are raised at the call.
+type tailCall struct {
+	fn    *object.Function
+	slots []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// recurCall is returned by a recur form to the loop or function it's in
+// the tail position of, which rebinds its names to args and starts over.
+// ExpandMacros has checked that there is one.
+type recurCall struct {
+	args []object.Object
+}
+
+func (rc *recurCall) Type() object.ObjectType { return "RECUR" }
+func (rc *recurCall) Inspect() string         { return "recur" }
+
+// evalTail evaluates node in tail position, where a call to a lo function
+// may be handed back to applyFunction as a tailCall
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	if le, ok := node.(*ast.ListExpression); ok {
+		return evalList(le, env, true)
+	}
+	return Eval(node, env)
+}
+
+// evalList evaluates a form, recording the form as the error's position if
+// it's where an error was raised or where it surfaced from a call
+func evalList(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	result := evalForm(le, env, tail)
+	if isError(result) {
+		result.(*object.Error).Locate(le.Token)
+	}
+	return result
+}
+
+func evalForm(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
 	if len(le.Expressions) == 0 {
-		return &object.Error{Message: "empty list"}
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "empty list"}
 	}
 
 	var f object.Object
@@ -58,51 +117,195 @@ func evalList(le *ast.ListExpression, env *object.Environment) object.Object {
 			return doDef(le, env)
 		case "defn":
 			return evalDefn(le, env)
+		case "set!":
+			return evalSet(le, env)
 		case "\\":
 			return evalLambda(le, env)
 		case "if":
-			return evalIf(le, env)
+			return evalIf(le, env, tail)
+		case "and":
+			return evalLogical(le, env, tail, false)
+		case "or":
+			return evalLogical(le, env, tail, true)
+		case "let":
+			return evalLet(le, env, tail)
+		case "letfn":
+			return evalLetfn(le, env, tail)
+		case "do":
+			return evalDo(le, env, tail)
+		case "cond":
+			return evalCond(le, env, tail)
+		case "when":
+			return evalWhen(le, env, tail, true)
+		case "unless":
+			return evalWhen(le, env, tail, false)
+		case "case":
+			return evalCase(le, env, tail)
+		case "match":
+			return evalMatch(le, env, tail)
+		case "loop":
+			return evalLoop(le, env, tail)
+		case "recur":
+			return evalRecur(le, env)
+		case "try":
+			return evalTry(le, env)
+		case "quote":
+			return evalQuote(le)
+		case "macroexpand", "macroexpand-1":
+			return evalMacroexpand(le, env)
 		default:
 			f = evalIdentifier(ident, env)
 		}
 	} else {
 		f = Eval(first, env)
 	}
-
-	if f.Type() != object.FUNCTION_OBJ && f.Type() != object.BUILTIN_OBJ {
-
-		return &object.Error{Message: "first element is not a function"}
+	if isError(f) {
+		return f
 	}
 
 	args := []object.Object{}
 	for _, arg := range le.Expressions[1:] {
-		args = append(args, Eval(arg, env))
+		evaluated := Eval(arg, env)
+		if isError(evaluated) {
+			return evaluated
+		}
+		args = append(args, evaluated)
 	}
 
+	if !isCallable(f) {
+		return &object.Error{Kind: object.TYPE_ERROR, Message: "first element is not a function"}
+	}
+
+	if fn, ok := f.(*object.Function); ok && tail {
+		fn, slots, err := bindArguments(fn, args)
+		if err != nil {
+			return err
+		}
+		return &tailCall{fn: fn, slots: slots}
+	}
 	return applyFunction(f, args, env)
 }
 
 func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
-	if fn.Type() != object.BUILTIN_OBJ && fn.Type() != object.FUNCTION_OBJ {
-		return &object.Error{Message: fmt.Sprintf("not a function, got %s", fn.Type())}
+	switch f := fn.(type) {
+	case *object.Function:
+		f, slots, err := bindArguments(f, args)
+		if err != nil {
+			return err
+		}
+		return callFunction(f, slots)
+	case *object.Closure:
+		return f.Apply(f, args...)
+	case *object.Builtin:
+		return f.Call(apply, args...)
+	case *object.Keyword:
+		return CallKeyword(f, args)
 	}
+	return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("not a function, got %s", typeName(fn))}
+}
 
-	switch fn := fn.(type) {
-	case *object.Function:
-		extendedEnv := object.NewEnclosedEnvironment(fn.Env)
-		for i, param := range fn.Parameters {
-			extendedEnv.Set(param.Value, args[i])
+// bindArguments chooses the arity of f that takes args, and assigns them to
+// its parameter slots
+func bindArguments(f *object.Function, args []object.Object) (*object.Function, []object.Object, *object.Error) {
+	f, err := f.Arity(len(args))
+	if err != nil {
+		return nil, nil, err
+	}
+	slots, err := f.Signature.Bind(f.Name, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, slots, nil
+}
+
+// MaxCallDepth bounds how deeply function calls can nest on either back
+// end, so that runaway recursion raises an error instead of exhausting the
+// Go stack or memory. Tail calls and recur don't nest.
+const MaxCallDepth = 10000
+
+// TooDeep is the error raised by a call nested deeper than MaxCallDepth
+func TooDeep() *object.Error {
+	return &object.Error{Kind: object.DEPTH_ERROR, Message: fmt.Sprintf("maximum call depth of %d exceeded", MaxCallDepth)}
+}
+
+// callFunction runs the body of f with its parameters bound to slots,
+// following any tail calls and recurs it ends in. It counts the call as in
+// progress in f's global environment, which is how the calls made by lazy
+// sequences as they're realized count where they're realized rather than
+// where they were made.
+func callFunction(f *object.Function, slots []object.Object) object.Object {
+	defer f.Env.EndCall()
+	if f.Env.BeginCall() > MaxCallDepth {
+		return TooDeep()
+	}
+
+	for {
+		env, err := bindParameters(f, slots)
+		if err != nil {
+			return err
 		}
 
-		var result object.Object
-		for _, exp := range fn.Body {
-			result = Eval(exp, extendedEnv)
+		result := evalBody(f.Body, env)
+		switch r := result.(type) {
+		case *recurCall:
+			slots = r.args
+			continue
+		case *tailCall:
+			f, slots = r.fn, r.slots
+			continue
+		}
+
+		if isError(result) {
+			result.(*object.Error).Unwind(f.Name)
 		}
 		return result
-	case *object.Builtin:
-		return fn.Fn(args...)
 	}
-	return nil
+}
+
+// isCallable reports whether obj can be called: functions, builtins, and
+// keywords, which look themselves up in a map
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Closure, *object.Builtin, *object.Keyword:
+		return true
+	}
+	return false
+}
+
+// apply is the Applier the tree-walker hands to higher-order builtins
+func apply(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, nil)
+}
+
+// evalSequence evaluates exps in order, returning the value of the last
+func evalSequence(exps []ast.Expression, env *object.Environment) object.Object {
+	var result object.Object = &consts.Nil
+
+	for _, exp := range exps {
+		result = Eval(exp, env)
+		if isError(result) {
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBody evaluates a function body, with its last expression in tail
+// position
+func evalBody(body []ast.Expression, env *object.Environment) object.Object {
+	if len(body) == 0 {
+		return &consts.Nil
+	}
+
+	for _, exp := range body[:len(body)-1] {
+		result := Eval(exp, env)
+		if isError(result) {
+			return result
+		}
+	}
+
+	return evalTail(body[len(body)-1], env)
 }
 
 func evalListLiteral(ll *ast.ListLiteral, env *object.Environment) object.Object {
@@ -110,109 +313,224 @@ func evalListLiteral(ll *ast.ListLiteral, env *object.Environment) object.Object
 
 	for _, exp := range ll.Expressions {
 		evaluated := Eval(exp, env)
+		if isError(evaluated) {
+			return evaluated
+		}
 		elements = append(elements, evaluated)
 	}
-	return &object.List{Elements: elements}
+	return object.NewList(elements)
 }
 
 func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
+	var val object.Object
+	ok := true
+
+	switch ident.Binding {
+	case ast.Local:
+		val, ok = env.GetLocal(ident.Depth, ident.Slot)
+	case ast.Builtin:
+		return Builtins[ident.Slot]
+	default:
+		switch ident.Value {
+		case "true":
+			return &consts.TrueBool
+		case "false":
+			return &consts.FalseBool
+		case "nil":
+			return &consts.Nil
+		}
+		val, ok = env.Get(ident.Value)
+	}
 
-	switch ident.Value {
-	case "true":
-		return &consts.TrueBool
-	case "false":
-		return &consts.FalseBool
+	if !ok {
+		err := &object.Error{Kind: object.NAME_ERROR, Message: "identifier not found: " + ident.Value}
+		err.Locate(ident.Token)
+		return err
 	}
 
-	if b, ok := builtinFunctions[ident.Value]; ok {
-		return &object.Builtin{Fn: b}
+	return val
+}
+
+// ParseSet checks the shape of a (set! name value) form, returning the
+// name it assigns
+func ParseSet(le *ast.ListExpression) (*ast.Identifier, *object.Error) {
+	if len(le.Expressions) != 3 {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to set!, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 2"}
 	}
 
-	val, ok := env.Get(ident.Value)
+	ident, ok := le.Expressions[1].(*ast.Identifier)
 	if !ok {
-		return &object.Error{Message: "identifier not found: " + ident.Value}
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "first argument to set! must be an identifier"}
+	}
+
+	if ident.Value == "true" || ident.Value == "false" || ident.Value == "nil" {
+		return nil, Unsettable(ident.Value)
+	}
+	return ident, nil
+}
+
+// Unsettable is the error for a set! of a builtin that no local shadows
+func Unsettable(name string) *object.Error {
+	return &object.Error{Kind: object.NAME_ERROR, Message: "cannot set! builtin: " + name}
+}
+
+// Unassignable is the error for a set! of a name with no binding
+func Unassignable(name string) *object.Error {
+	return &object.Error{Kind: object.NAME_ERROR, Message: "cannot set! unbound identifier: " + name}
+}
+
+// evalSet changes the value of the nearest existing binding of a name
+func evalSet(le *ast.ListExpression, env *object.Environment) object.Object {
+	ident, err := ParseSet(le)
+	if err != nil {
+		return err
+	}
+	if ident.Binding == ast.Builtin {
+		return Unsettable(ident.Value)
 	}
 
+	val := Eval(le.Expressions[2], env)
+	if isError(val) {
+		return val
+	}
+	if ident.Binding == ast.Local {
+		env.SetLocal(ident.Depth, ident.Slot, val)
+	} else if !env.Assign(ident.Value, val) {
+		return Unassignable(ident.Value)
+	}
 	return val
 }
 
 func doDef(le *ast.ListExpression, env *object.Environment) object.Object {
 	if len(le.Expressions) != 3 {
-		return &object.Error{Message: "wrong number of arguments to def, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 2"}
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to def, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 2"}
 	}
 
 	ident, ok := le.Expressions[1].(*ast.Identifier)
 	if !ok {
-		return &object.Error{Message: "first argument to def must be an identifier"}
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "first argument to def must be an identifier"}
 	}
 
 	val := Eval(le.Expressions[2], env)
-	env.Set(ident.Value, val)
+	if isError(val) {
+		return val
+	}
+	define(ident, val, env)
 	return val
 }
 
-func evalDefn(le *ast.ListExpression, env *object.Environment) object.Object {
-	if len(le.Expressions) < 4 {
-		return &object.Error{Message: "wrong number of arguments to defn, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 3"}
+// define binds the name of a def or defn in the current scope, or in the
+// global environment at the top level
+func define(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	if ident.Binding == ast.Local {
+		env.SetLocal(ident.Depth, ident.Slot, val)
+		return
 	}
+	env.Set(ident.Value, val)
+}
 
-	ident, ok := le.Expressions[1].(*ast.Identifier)
-	if !ok {
-		return &object.Error{Message: "first argument to defn must be an identifier"}
+func evalDefn(le *ast.ListExpression, env *object.Environment) object.Object {
+	if len(le.Expressions) < 3 {
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to defn, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 3"}
 	}
 
-	paramsExpr, ok := le.Expressions[2].(*ast.ListLiteral)
+	ident, ok := le.Expressions[1].(*ast.Identifier)
 	if !ok {
-		return &object.Error{Message: "second argument to defn must be a list of identifiers"}
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "first argument to defn must be an identifier"}
 	}
 
-	params := []*ast.Identifier{}
-	for _, p := range paramsExpr.Expressions {
-		param, ok := p.(*ast.Identifier)
-		if !ok {
-			return &object.Error{Message: "parameters to defn must be identifiers"}
-		}
-		params = append(params, param)
+	arities, err := ParseArities(le.Expressions[2:], "defn", "second argument to defn must be a list of identifiers")
+	if err != nil {
+		return err
 	}
 
-	body := le.Expressions[3:]
-	fn := &object.Function{Name: ident.Value, Parameters: params, Body: body, Env: env}
-	env.Set(ident.Value, fn)
+	fn := newFunction(ident.Value, arities, env)
+	define(ident, fn, env)
 	return fn
 }
 
 func evalLambda(le *ast.ListExpression, env *object.Environment) object.Object {
-	if len(le.Expressions) < 3 {
-		return &object.Error{Message: "wrong number of arguments to lambda, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 2"}
+	if len(le.Expressions) < 2 {
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to lambda, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 2"}
 	}
 
-	paramsExpr, ok := le.Expressions[1].(*ast.ListLiteral)
-	if !ok {
-		return &object.Error{Message: "first argument to lambda must be a list of identifiers"}
+	arities, err := ParseArities(le.Expressions[1:], "lambda", "first argument to lambda must be a list of identifiers")
+	if err != nil {
+		return err
 	}
 
-	params := []*ast.Identifier{}
-	for _, p := range paramsExpr.Expressions {
-		param, ok := p.(*ast.Identifier)
-		if !ok {
-			return &object.Error{Message: "parameters to lambda must be identifiers"}
-		}
-		params = append(params, param)
+	return newFunction("lambda", arities, env)
+}
+
+// newFunction makes the function called name with the given arities, or a
+// Function of its own for each if there's more than one
+func newFunction(name string, arities []*Arity, env *object.Environment) *object.Function {
+	if len(arities) == 1 {
+		return newArity(name, arities[0].Params, arities[0].Body, env)
 	}
 
-	body := le.Expressions[2:]
-	return &object.Function{Name: "lambda", Parameters: params, Body: body, Env: env}
+	fn := &object.Function{Name: name, Env: env}
+	for _, a := range arities {
+		fn.Arities = append(fn.Arities, newArity(name, a.Params, a.Body, env))
+	}
+	return fn
+}
+
+func newArity(name string, params *Params, body []ast.Expression, env *object.Environment) *object.Function {
+	return &object.Function{
+		Name:       name,
+		Parameters: params.Patterns,
+		Defaults:   params.Defaults,
+		Signature:  params.Signature,
+		Body:       body,
+		Env:        env,
+	}
 }
 
-func evalIf(le *ast.ListExpression, env *object.Environment) object.Object {
+func evalIf(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
 
 	if len(le.Expressions) != 4 {
-		return &object.Error{Message: "wrong number of arguments to if, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 3"}
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to if, got " + fmt.Sprint(len(le.Expressions)-1) + ", expected 3"}
 	}
 
+	branch := le.Expressions[3]
 	cond := Eval(le.Expressions[1], env)
-	if cond != &consts.FalseBool {
-		return Eval(le.Expressions[2], env)
+	if isError(cond) {
+		return cond
+	}
+	if object.IsTruthy(cond) {
+		branch = le.Expressions[2]
+	}
+	return evalBranch(branch, env, tail)
+}
+
+// evalLogical evaluates the operands of and or or from left to right,
+// stopping at the first whose truthiness is stopOn and returning it. If none
+// stops it, the last operand's value is returned.
+func evalLogical(le *ast.ListExpression, env *object.Environment, tail bool, stopOn bool) object.Object {
+	operands := le.Expressions[1:]
+	if len(operands) == 0 {
+		if stopOn {
+			return &consts.Nil
+		}
+		return &consts.TrueBool
+	}
+
+	for _, exp := range operands[:len(operands)-1] {
+		val := Eval(exp, env)
+		if isError(val) || object.IsTruthy(val) == stopOn {
+			return val
+		}
+	}
+
+	return evalBranch(operands[len(operands)-1], env, tail)
+}
+
+// isError reports whether obj is an error in flight. Errors bound by a
+// catch clause are ordinary values.
+func isError(obj object.Object) bool {
+	if err, ok := obj.(*object.Error); ok {
+		return !err.Caught
 	}
-	return Eval(le.Expressions[3], env)
+	return false
 }
@@ -1,9 +1,14 @@
-package eval
+package eval_test
 
 import (
+	"lo/ast"
+	"lo/compiler"
+	"lo/eval"
 	"lo/lexer"
 	"lo/object"
 	"lo/parser"
+	"lo/vm"
+	"runtime"
 	"testing"
 )
 
@@ -17,48 +22,80 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
 
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-5", "INTEGER -5"},
+		{"(- 10 -5)", "INTEGER 15"},
+		{"0xff", "INTEGER 255"},
+		{"0b1010", "INTEGER 10"},
+		{"1_000", "INTEGER 1000"},
+		{"1.5", "FLOAT 1.500000"},
+		{"(* 2 1e3)", "FLOAT 2000.000000"},
+		{"1/3", "RATIO 1/3"},
+		{"4/2", "INTEGER 2"},
+		{"(+ 1/3 2/3)", "INTEGER 1"},
+		{"(= 1/2 (/ 1 2))", "BOOLEAN true"},
+		{"99999999999999999999", "INTEGER 99999999999999999999"},
+		{"(- 99999999999999999999 99999999999999999998)", "INTEGER 1"},
+		{"'[1/2 0x10 1.5 99999999999999999999]", "LIST [1/2 16 1.500000 99999999999999999999]"},
+		{"(match 1/2 1/2 :half _ :other)", "KEYWORD :half"},
+		{"(defmacro m [] (* 99999999999999999999 1/3)) (m)", "INTEGER 33333333333333333333"},
+		{"(defmacro m [] 1/4) (* (m) 2)", "RATIO 1/2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
 func TestMath(t *testing.T) {
 	input := "(+ 1 2)"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	testIntegerObject(t, evaluated, 3)
 }
 
 func TestNestedAddition(t *testing.T) {
 	input := "(+ (+ 1 2) 3)"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	testIntegerObject(t, evaluated, 6)
 }
 
 func TestMultipleAddition(t *testing.T) {
 	input := "(+ 1 2 3 4)"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	testIntegerObject(t, evaluated, 10)
 }
 
 func TestList(t *testing.T) {
 	input := "[1 2 3 4]"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	arr, ok := evaluated.(*object.List)
 	if !ok {
 		t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
-	if len(arr.Elements) != 4 {
-		t.Errorf("array has wrong number of elements. got=%d", len(arr.Elements))
+	if len(arr.Elements()) != 4 {
+		t.Errorf("array has wrong number of elements. got=%d", len(arr.Elements()))
 	}
 
-	for i, el := range arr.Elements {
+	for i, el := range arr.Elements() {
 		testIntegerObject(t, el, int64(i+1))
 	}
 }
 
 func TestDef(t *testing.T) {
 	input := "(def x 5)"
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 
 	val, ok := evaluated.(*object.Integer)
 	if !ok {
@@ -70,16 +107,1312 @@ func TestDef(t *testing.T) {
 	}
 }
 
+func TestIf(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(if true 1 2)", 1},
+		{"(if false 1 2)", 2},
+		{"(if 0 1 2)", 1},
+		{"(if (if false true false) 1 2)", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestNil(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"nil", "NIL nil"},
+		{"", "NIL nil"},
+		{"[nil 1]", "LIST [nil 1]"},
+		{"{nil 1}", "MAP {nil 1}"},
+		{"(get {nil 1} nil)", "INTEGER 1"},
+		{"(println)", "NIL nil"},
+		{"(try 1 (catch e))", "INTEGER 1"},
+		{"(try (foo) (catch e))", "NIL nil"},
+		{"(try (foo) (catch e (error-payload e)))", "NIL nil"},
+		{"(try (throw nil) (catch e (error-message e)))", "STRING nil"},
+		{"'nil", "NIL nil"},
+		{"(defmacro m [] nil) (m)", "NIL nil"},
+		{"(nil? nil)", "BOOLEAN true"},
+		{"(nil? false)", "BOOLEAN false"},
+		{"(nil? (get {} 1))", "BOOLEAN true"},
+		{"(some? nil)", "BOOLEAN false"},
+		{"(some? false)", "BOOLEAN true"},
+		{"(some? 0)", "BOOLEAN true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestTruthiness(t *testing.T) {
+	globals := map[string]object.Object{
+		"fresh-false": &object.Builtin{Name: "fresh-false", Fn: func(args ...object.Object) object.Object {
+			return &object.Boolean{Value: false}
+		}},
+	}
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(if nil 1 2)", 2},
+		{"(if false 1 2)", 2},
+		{"(if (fresh-false) 1 2)", 2},
+		{"(if (get {} 1) 1 2)", 2},
+		{"(if 0 1 2)", 1},
+		{"(if \"\" 1 2)", 1},
+		{"(if [] 1 2)", 1},
+		{"(if {} 1 2)", 1},
+		{"(if :a 1 2)", 1},
+		{"(if true 1 2)", 1},
+		{"(defn f [x] (if x 1 2)) (f (fresh-false))", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWith(t, tt.input, globals)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestAndOr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(and)", "BOOLEAN true"},
+		{"(or)", "NIL nil"},
+		{"(and 1)", "INTEGER 1"},
+		{"(or 1)", "INTEGER 1"},
+		{"(and 1 2 3)", "INTEGER 3"},
+		{"(and 1 nil 3)", "NIL nil"},
+		{"(and 1 false 3)", "BOOLEAN false"},
+		{"(or nil false 3 4)", "INTEGER 3"},
+		{"(or nil false)", "BOOLEAN false"},
+		{"(or false nil)", "NIL nil"},
+		{"(and false (foo))", "BOOLEAN false"},
+		{"(or 1 (foo))", "INTEGER 1"},
+		{"(def x 0) (and nil (def x 1)) x", "INTEGER 0"},
+		{"(def x 0) (or nil (def x 1)) x", "INTEGER 1"},
+		{"(defn f [a b] (or (and a :both) b)) [(f 1 2) (f nil 2)]", "LIST [:both 2]"},
+		{"(if (and (< 1 2) (> 3 2)) :yes :no)", "KEYWORD :yes"},
+		{"(and 1 (foo))", "ERROR: identifier not found: foo\n    at test:1:9"},
+		{"(or nil (foo))", "ERROR: identifier not found: foo\n    at test:1:10"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestLet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(let [x 1] x)", "INTEGER 1"},
+		{"(let [x 1 y (+ x 1)] [x y])", "LIST [1 2]"},
+		{"(let [x 1 x (+ x 1)] x)", "INTEGER 2"},
+		{"(let [x 1 x 2 f (\\ [] x) x 3] [(f) x])", "LIST [2 3]"},
+		{"(let [] 1 2)", "INTEGER 2"},
+		{"(let [x 1])", "NIL nil"},
+		{"(def x 1) (let [x 2] x) x", "INTEGER 1"},
+		{"(let [x 1] (let [y 2] (+ x y)))", "INTEGER 3"},
+		{"(let [x 1] (def y 2) (+ x y))", "INTEGER 3"},
+		{"(let [x 1] (def x 5)) x", "ERROR: identifier not found: x\n    at test:1:23"},
+		{"(defn f [x] (let [y (* x 2)] (\\ [] (+ x y)))) ((f 2))", "INTEGER 6"},
+		{"(defn f [n] (let [m (- n 1)] (if (= m 0) :done (f m)))) (f 100000)", "KEYWORD :done"},
+		{"(let [x (try (foo) (catch e 1))] x)", "INTEGER 1"},
+		{"(let x 1)", "ERROR: first argument to let must be a list of bindings\n    at test:1:1"},
+		{"(let [x])", "ERROR: let bindings must contain an even number of forms\n    at test:1:1"},
+		{"(let [1 2] 3)", "ERROR: binding names in let must be identifiers or patterns\n    at test:1:1"},
+		{"(let)", "ERROR: wrong number of arguments to let, got 0, expected at least 1\n    at test:1:1"},
+		{"(let [x 1]\n  (foo))", "ERROR: identifier not found: foo\n    at test:2:4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestLetfn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(letfn [(f [x] (* x 2))] (f 3))", "INTEGER 6"},
+		{"(letfn [(ev? [n] (if (= n 0) true (od? (- n 1)))) (od? [n] (if (= n 0) false (ev? (- n 1))))] [(ev? 10) (od? 7)])", "LIST [true true]"},
+		{"(letfn [(ev? [n] (if (= n 0) true (od? (- n 1)))) (od? [n] (if (= n 0) false (ev? (- n 1))))] (ev? 100000))", "BOOLEAN true"},
+		{"(letfn [(f ([] (f 1)) ([x] (* x 10)))] (f))", "INTEGER 10"},
+		{"(letfn [(sum [n acc] (if (= n 0) acc (recur (- n 1) (+ acc n))))] (sum 4 0))", "INTEGER 10"},
+		{"(defn g [k] (letfn [(f [x] (+ x k))] (f 1))) (g 2)", "INTEGER 3"},
+		{"(def f 1) (letfn [(f [] 2)] (f)) f", "INTEGER 1"},
+		{"(letfn [] 1)", "INTEGER 1"},
+		{"(letfn [(f [] 1)])", "NIL nil"},
+		{"(letfn [(f [] 1)] f)", "FUNCTION (fn f [])"},
+		{"(loop [i 0] (letfn [(f [] i)] (if (< i 3) (recur (+ i 1)) (f))))", "INTEGER 3"},
+		{"(letfn [(f [] 1)] (f)) (f)", "ERROR: identifier not found: f\n    at test:1:25"},
+		{"(letfn [(f [] (foo))]\n(f))", "ERROR: identifier not found: foo\n    at f (test:1:16)\n    at test:2:1"},
+		{"(letfn)", "ERROR: wrong number of arguments to letfn, got 0, expected at least 1\n    at test:1:1"},
+		{"(letfn f 1)", "ERROR: first argument to letfn must be a list of functions\n    at test:1:1"},
+		{"(letfn [f] 1)", "ERROR: functions in letfn must be (name [params] body...)\n    at test:1:1"},
+		{"(letfn [(f)] 1)", "ERROR: functions in letfn must be (name [params] body...)\n    at test:1:1"},
+		{"(letfn [(1 [] 1)] 1)", "ERROR: functions in letfn must be (name [params] body...)\n    at test:1:1"},
+		{"(letfn [(f 1)] 1)", "ERROR: functions in letfn must be (name [params] body...)\n    at test:1:1"},
+		{"(letfn [(f [] (recur 1))] 1)", "ERROR: wrong number of arguments to recur, got 1, expected 0\n    at test:1:15"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestControlForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(do)", "NIL nil"},
+		{"(do 1 2 3)", "INTEGER 3"},
+		{"(do (def x 1) (+ x 1))", "INTEGER 2"},
+		{"(cond)", "NIL nil"},
+		{"(cond false 1 true 2)", "INTEGER 2"},
+		{"(cond nil 1 false 2)", "NIL nil"},
+		{"(cond false 1 :else 3)", "INTEGER 3"},
+		{"(cond 1 :a (foo) :b)", "KEYWORD :a"},
+		{"(defn sign [n] (cond (< n 0) :neg (> n 0) :pos :else :zero)) [(sign -5) (sign 5) (sign 0)]", "LIST [:neg :pos :zero]"},
+		{"(when true 1 2)", "INTEGER 2"},
+		{"(when false (foo))", "NIL nil"},
+		{"(when 1)", "NIL nil"},
+		{"(unless false 1 2)", "INTEGER 2"},
+		{"(unless true (foo))", "NIL nil"},
+		{"(case 2 1 :one 2 :two)", "KEYWORD :two"},
+		{"(case 3 1 :one 2 :two)", "ERROR: non-exhaustive case: no clause matches 3\n    at test:1:1"},
+		{"(defn f [x] (case x 1 :one))\n(f 5)", "ERROR: non-exhaustive case: no clause matches 5\n    at f (test:1:13)\n    at test:2:1"},
+		{`(try (case 5 1 :a) (catch "match-error" e :caught))`, "KEYWORD :caught"},
+		{"(case 3 1 :one nil)", "NIL nil"},
+		{"(case 3 1 :one :other)", "KEYWORD :other"},
+		{"(case 3 (1 3 5) :odd (2 4) :even)", "KEYWORD :odd"},
+		{`(case "b" "a" 1 "b" 2)`, "INTEGER 2"},
+		{"(case :k :j 1 :k 2)", "INTEGER 2"},
+		{"(case 'x x :sym :other)", "KEYWORD :sym"},
+		{"(case nil nil :nil :other)", "KEYWORD :nil"},
+		{"(case [1 2] [1 2] :vec :other)", "KEYWORD :vec"},
+		{"(case (+ 1 1) 2 (str \"two\"))", "STRING two"},
+		{"(defn f [n] (case n 0 :done (f (- n 1)))) (f 100000)", "KEYWORD :done"},
+		{"(defn f [n] (when (> n 0) (f (- n 1)))) (f 100000)", "NIL nil"},
+		{"(defn f [n] (do n (cond (= n 0) :done :else (f (- n 1))))) (f 100000)", "KEYWORD :done"},
+		{"(cond true)", "ERROR: cond requires an even number of forms\n    at test:1:1"},
+		{"(when)", "ERROR: wrong number of arguments to when, got 0, expected at least 1\n    at test:1:1"},
+		{"(unless)", "ERROR: wrong number of arguments to unless, got 0, expected at least 1\n    at test:1:1"},
+		{"(case)", "ERROR: wrong number of arguments to case, got 0, expected at least 1\n    at test:1:1"},
+		{"(case 1 {[1.5] 1} 2)", "ERROR: unusable as map key: LIST\n    at test:1:1"},
+		{"(case (foo) 1 2)", "ERROR: identifier not found: foo\n    at test:1:8"},
+		{"(case 1 1 :a 1 :b)", "ERROR: duplicate case constant: 1\n    at test:1:1"},
+		{"(case 1 (1 2) :a (3 2) :b)", "ERROR: duplicate case constant: 2\n    at test:1:1"},
+		{"(case 1 (1 1) :a)", "ERROR: duplicate case constant: 1\n    at test:1:1"},
+		{"(case 1 [1 2] :a [1 2] :b :c)", "ERROR: duplicate case constant: [1 2]\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(match 2 1 :one 2 :two _ :other)", "KEYWORD :two"},
+		{"(match 3 1 :one 2 :two _ :other)", "KEYWORD :other"},
+		{"(match 5 n (+ n 1))", "INTEGER 6"},
+		{"(match nil nil :nil _ :other)", "KEYWORD :nil"},
+		{"(match 'foo 'bar 1 'foo 2)", "INTEGER 2"},
+		{"(match [1 2] [a b] (+ a b))", "INTEGER 3"},
+		{"(match [1 2 3] [a b] :two [a b c] :three)", "KEYWORD :three"},
+		{"(match [1 2 3] [x & xs] xs)", "LIST [2 3]"},
+		{"(match [1 2] [a & r :as all] all)", "LIST [1 2]"},
+		{"(match '(1 2) [a b] b)", "INTEGER 2"},
+		{"(match [:neg 4] [:add a b] (+ a b) [:neg a] (- 0 a))", "INTEGER -4"},
+		{"(match {:type :circle :r 2} {:square :type} 0 {:circle :type r :r} (* r r))", "INTEGER 4"},
+		{"(match {:x 1} {:keys [x y]} :both {:keys [x]} x)", "INTEGER 1"},
+		{"(match [1 2] {:keys [x]} :map [x y] :list)", "KEYWORD :list"},
+		{"(match \"s\" (INTEGER n) :int (STRING s) s)", "STRING s"},
+		{"(match [1 \"a\"] [(INTEGER a) (INTEGER b)] :ints [(INTEGER a) b] b)", "STRING a"},
+		{"(match (\\ [] 1) (FUNCTION f) (f))", "INTEGER 1"},
+		{"[(match 5 n :when (> n 3) :big n :small) (match 2 n :when (> n 3) :big n :small)]", "LIST [:big :small]"},
+		{"(match [1 2] [a b] :when (= a b) :same [a b] :different)", "KEYWORD :different"},
+		{"(def n 1) (match 5 n n) n", "INTEGER 1"},
+		{"(def f (match 3 n (\\ [] n))) (f)", "INTEGER 3"},
+		{"(defn len [xs acc] (match xs [] acc [_ & r] (len r (+ acc 1)))) (len [1 2 3] 0)", "INTEGER 3"},
+		{"(loop [xs [1 2 3] acc 0] (match xs [] acc [x & r] (recur r (+ acc x))))", "INTEGER 6"},
+		{"(try (match 1 2 3) (catch \"match-error\" e (error-message e)))", "STRING non-exhaustive match: no pattern matches 1"},
+		{"(match 3 1 :one 2 :two)", "ERROR: non-exhaustive match: no pattern matches 3\n    at test:1:1"},
+		{"(defn f [x] (match x 1 :one))\n(f 2)", "ERROR: non-exhaustive match: no pattern matches 2\n    at f (test:1:13)\n    at test:2:1"},
+		{"(match 1 n :when (foo) n)", "ERROR: identifier not found: foo\n    at test:1:19"},
+		{"(match)", "ERROR: wrong number of arguments to match, got 0, expected at least 1\n    at test:1:1"},
+		{"(match 1 2)", "ERROR: match requires a result for every pattern\n    at test:1:1"},
+		{"(match 1 n :when (> n 0))", "ERROR: :when in match must be followed by a guard and a result\n    at test:1:1"},
+		{"(match 1 (foo x) 1)", "ERROR: patterns in match must be _, names, literals, lists, maps or (TYPE pattern)\n    at test:1:1"},
+		{"(match 1 {:keys [x] :or {x 1}} x)", "ERROR: :or can't be used in a match pattern\n    at test:1:1"},
+		{"(match [1 2] [a a] :same _ :diff)", "ERROR: a is bound more than once in a match pattern\n    at test:1:1"},
+		{"(match [1 [2]] [a [(INTEGER a)]] a)", "ERROR: a is bound more than once in a match pattern\n    at test:1:1"},
+		{"(match {:a 1} {:keys [a] :as a} a)", "ERROR: a is bound more than once in a match pattern\n    at test:1:1"},
+		{"(match [1 2] [a b] :two [a] :one)", "KEYWORD :two"},
+		{"(loop [x 1] (match (recur 2) _ 1))", "ERROR: recur must be in tail position\n    at test:1:20"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestLoopRecur(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(loop [i 0 acc 0] (if (> i 10) acc (recur (+ i 1) (+ acc i))))", "INTEGER 55"},
+		{"(loop [i 0] (if (< i 100000) (recur (+ i 1)) i))", "INTEGER 100000"},
+		{"(loop [] 1)", "INTEGER 1"},
+		{"(loop [x 1 y (+ x 1)] [x y])", "LIST [1 2]"},
+		{"(loop [i 3 out []] (cond (= i 0) out :else (recur (- i 1) (concat out [i]))))", "FORM (3 2 1)"},
+		{"(loop [i 0] (when (< i 5) (recur (+ i 1))))", "NIL nil"},
+		{"(loop [i 0] (case i 3 :done (recur (+ i 1))))", "KEYWORD :done"},
+		{"(loop [i 0] (let [j (+ i 1)] (if (< j 5) (recur j) j)))", "INTEGER 5"},
+		{"(loop [i 0] (and (< i 3) (recur (+ i 1))))", "BOOLEAN false"},
+		{"(loop [i 0] (do (def x i) (if (< i 3) (recur (+ i 1)) x)))", "INTEGER 3"},
+		{"(loop [i 0 fs {}] (if (< i 3) (recur (+ i 1) (assoc fs i (\\ [] i))) [((get fs 0)) ((get fs 2))]))", "LIST [0 2]"},
+		{"(defn sum [n acc] (if (= n 0) acc (recur (- n 1) (+ acc n)))) (sum 100000 0)", "INTEGER 5000050000"},
+		{"((\\ [n] (if (= n 0) :done (recur (- n 1)))) 100000)", "KEYWORD :done"},
+		{"(defn f [n] (loop [i n] (if (= i 0) :done (recur (- i 1))))) (f 100000)", "KEYWORD :done"},
+		{"(loop [i 0] (if (< i 3) (recur (+ i 1)) (loop [j i] (if (< j 6) (recur (+ j 1)) [i j]))))", "LIST [3 6]"},
+		{"(defn f [n] (loop [i 0] (if (< i n) (recur (+ i 1)) ((\\ [k] (if (= k 0) i (recur (- k 1)))) 10)))) (f 4)", "INTEGER 4"},
+		{"(defmacro m [n] (loop [i n acc 0] (if (= i 0) acc (recur (- i 1) (+ acc i))))) (m 4)", "INTEGER 10"},
+		{"(recur 1)", "ERROR: recur used outside of loop or function\n    at test:1:1"},
+		{"(loop [i 0] (+ 1 (recur i)))", "ERROR: recur must be in tail position\n    at test:1:18"},
+		{"(loop [i 0] (recur i) 1)", "ERROR: recur must be in tail position\n    at test:1:13"},
+		{"(loop [i 0] (if (recur i) 1 2))", "ERROR: recur must be in tail position\n    at test:1:17"},
+		{"(loop [i (recur 1)] i)", "ERROR: recur used outside of loop or function\n    at test:1:10"},
+		{"(defn f [x] (try (recur x) (catch e 1)))", "ERROR: recur must be in tail position\n    at test:1:18"},
+		{"(loop [i 0] (recur))", "ERROR: wrong number of arguments to recur, got 0, expected 1\n    at test:1:13"},
+		{"(defn f [a b] (recur 1))", "ERROR: wrong number of arguments to recur, got 1, expected 2\n    at test:1:15"},
+		{"(def x 1) (recur)", "ERROR: recur used outside of loop or function\n    at test:1:11"},
+		{"(loop [i] i)", "ERROR: loop bindings must contain an even number of forms\n    at test:1:1"},
+		{"(loop [i 0] (if (< i 3) (recur (+ i 1)) (foo)))", "ERROR: identifier not found: foo\n    at test:1:42"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(defn add [a b] (+ a b)) (add 1 2)", 3},
+		{"(defn f [] 1 2 3) (f)", 3},
+		{"((\\ [x] (* x x)) 4)", 16},
+		{"(def sq (\\ [x] (* x x))) (sq 5)", 25},
+		{"(defn fact [n] (if (if n false true) 1 (* n (fact (- n 1))))) 1", 1},
+		{"(defn f [x] (def y (* x 2)) (+ x y)) (f 3)", 9},
+		{"(def x 10) (defn f [x] x) (f 1)", 1},
+		{"(def x 10) (defn f [y] x) (f 1)", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defn f [a & more] [a more]) (f 1)", "LIST [1 []]"},
+		{"(defn f [a & more] [a more]) (f 1 2 3)", "LIST [1 [2 3]]"},
+		{"((\\ [& xs] xs))", "LIST []"},
+		{"(defn f [a (b 10)] (+ a b)) [(f 1) (f 1 2)]", "LIST [11 3]"},
+		{"(defn f [a (b (* a 2)) (c (+ a b))] [a b c]) [(f 1) (f 1 5) (f 1 5 0)]", "LIST [[1 2 3] [1 5 6] [1 5 0]]"},
+		{"(defn f [(a 1) & more] [a more]) [(f) (f 2 3)]", "LIST [[1 []] [2 [3]]]"},
+		{"(defn f [a (b nil)] b) (f 1 nil)", "NIL nil"},
+		{"(defn f [x &key (scale 1) offset] [(* x scale) offset]) (f 2)", "LIST [2 nil]"},
+		{"(defn f [x &key (scale 1) offset] [(* x scale) offset]) (f 2 :offset 5 :scale 3)", "LIST [6 5]"},
+		{"(defn f [&key (a 1) (b (+ a 1))] [a b]) [(f) (f :a 5) (f :b 0)]", "LIST [[1 2] [5 6] [1 0]]"},
+		{"(def y 10) (defn f [(x y)] x) (f)", "INTEGER 10"},
+		{"(defn f [n & acc] (if (= n 0) acc (recur (- n 1) (concat acc [n])))) (f 3)", "FORM (3 2 1)"},
+		{"(defn f [n (acc 0)] (if (= n 0) acc (recur (- n 1) (+ acc n)))) (f 100000)", "INTEGER 5000050000"},
+		{"(defn f [& xs] xs) (defn g [x] (f x x)) (g 1)", "LIST [1 1]"},
+		{"(defmacro my-when [test & body] `(if ~test (do ~@body) nil)) (my-when true 1 2)", "INTEGER 2"},
+		{"(update {:a 1} :a (\\ [x (y 10)] (+ x y)))", "MAP {:a 11}"},
+		{"(defn f [a b] a) (f 1)", "ERROR: wrong number of arguments to f, got 1, expected 2\n    at test:1:18"},
+		{"(defn f [a b] a) (f 1 2 3)", "ERROR: wrong number of arguments to f, got 3, expected 2\n    at test:1:18"},
+		{"(defn f [a (b 1)] a) (f)", "ERROR: wrong number of arguments to f, got 0, expected 1 to 2\n    at test:1:22"},
+		{"(defn f [a & b] a) (f)", "ERROR: wrong number of arguments to f, got 0, expected at least 1\n    at test:1:20"},
+		{"((\\ [x] x))", "ERROR: wrong number of arguments to lambda, got 0, expected 1\n    at test:1:1"},
+		{"(defn f [&key a] a) (f :b 1)", "ERROR: unknown keyword argument :b to f\n    at test:1:21"},
+		{"(defn f [&key a] a) (f :a)", "ERROR: keyword arguments to f must come in pairs\n    at test:1:21"},
+		{"(defn f [&key a] a) (f 1 2)", "ERROR: keyword argument names to f must be KEYWORDs, got INTEGER\n    at test:1:21"},
+		{"(defn f [a] a)\n(defn g [] (f))\n(g)", "ERROR: wrong number of arguments to f, got 0, expected 1\n    at g (test:2:12)\n    at test:3:1"},
+		{"(defn f [a] a)\n(defn g [] (do 1 (f)))\n(g)", "ERROR: wrong number of arguments to f, got 0, expected 1\n    at g (test:2:18)\n    at test:3:1"},
+		{"(defn f [(a (foo))] a)\n(f)", "ERROR: identifier not found: foo\n    at f (test:1:14)\n    at test:2:1"},
+		{"(update {:a 1} :a (\\ [] 1))", "ERROR: wrong number of arguments to lambda, got 1, expected 0\n    at test:1:1"},
+		{"(defmacro m [a] a) (m)", "ERROR: wrong number of arguments to macro m, got 0, expected 1\n    at test:1:20"},
+		{"(defn f [a &] a)", "ERROR: & in parameters to defn must be followed by one pattern\n    at test:1:1"},
+		{"(defn f [& a b] a)", "ERROR: & in parameters to defn must be followed by one pattern\n    at test:1:1"},
+		{"(defn f [(a 1) b] a)", "ERROR: required parameters to defn must come before optional ones\n    at test:1:1"},
+		{"(\\ [(a) b] a)", "ERROR: optional parameters to lambda must be (name default)\n    at test:1:1"},
+		{"(defn f [(a 1) &key b] a)", "ERROR: parameters to defn cannot have both optional and &key parameters\n    at test:1:1"},
+		{"(defn f [&key a & b] a)", "ERROR: parameters to defn cannot have both & and &key\n    at test:1:1"},
+		{"(defn f [&key a &key b] a)", "ERROR: &key can only appear once in parameters to defn\n    at test:1:1"},
+		{"(defn f [1] 1)", "ERROR: parameters to defn must be identifiers or patterns\n    at test:1:1"},
+		{"(\\ [x x] x)", "ERROR: x is bound more than once in parameters to lambda\n    at test:1:1"},
+		{"(defn f [x [y x]] x)", "ERROR: x is bound more than once in parameters to defn\n    at test:1:1"},
+		{"(defn f [x & x] x)", "ERROR: x is bound more than once in parameters to defn\n    at test:1:1"},
+		{"(defn f [x &key x] x)", "ERROR: x is bound more than once in parameters to defn\n    at test:1:1"},
+		{"(defmacro m [a a] a)", "ERROR: a is bound more than once in parameters to defmacro\n    at test:1:1"},
+		{"(defn f [_ [_ a]] a) (f 1 [2 3])", "INTEGER 3"},
+		{"(defn f [a & r] (recur 1))", "ERROR: wrong number of arguments to recur, got 1, expected 2\n    at test:1:17"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestShadowingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defn f [& rest] rest) (f 1 2)", "LIST [1 2]"},
+		{"(defn greet [name] (str \"hi \" name)) (greet \"bob\")", "STRING hi bob"},
+		{"(defn f [count] (+ count 1)) (f 1)", "INTEGER 2"},
+		{"(let [{:keys [name]} {:name \"x\"}] name)", "STRING x"},
+		{"(let [[first & rest] [1 2 3]] [first rest])", "LIST [1 [2 3]]"},
+		{"(defn f [map] (get map :a)) (f {:a 1})", "INTEGER 1"},
+		{"(match [1 2] [list set] (+ list set))", "INTEGER 3"},
+		{"(defn f [] (def keys 1) keys) (f)", "INTEGER 1"},
+		{"(let [count 0] (set! count 1) count)", "INTEGER 1"},
+		{"(let [count 1] (count [1 2]))", "ERROR: first element is not a function\n    at test:1:16"},
+		{"(let [x 1] count)", "BUILTIN builtin function"},
+		{"(defn f [] (set! count 1)) (f)", "ERROR: cannot set! builtin: count\n    at f (test:1:12)\n    at test:1:28"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestMultiArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defn f ([x] (f x 10)) ([x y] (+ x y))) [(f 1) (f 1 2)]", "LIST [11 3]"},
+		{"(defn f ([] 0) ([x] x) ([x & more] more)) [(f) (f 1) (f 1 2 3)]", "LIST [0 1 [2 3]]"},
+		{"(defn f ([& xs] :many) ([x] :one)) [(f) (f 1) (f 1 2)]", "LIST [:many :one :many]"},
+		{"(defn f ([x] x) ([x &key (y 2)] (+ x y))) [(f 1) (f 1 :y 5)]", "LIST [1 6]"},
+		{"((\\ ([] 1) ([x] x)) 5)", "INTEGER 5"},
+		{"(defn f ([n] (f n 0)) ([n acc] (if (= n 0) acc (recur (- n 1) (+ acc n))))) (f 100000)", "INTEGER 5000050000"},
+		{"(defn f ([[a b]] (+ a b)) ([a b] (* a b))) [(f [1 2]) (f 3 4)]", "LIST [3 12]"},
+		{"(defn f ([x] x) ([x y & r] y)) f", "FUNCTION (fn f [x] [x y & r])"},
+		{"(defn f [a (b 1) & r] a) f", "FUNCTION (fn f [a (b 1) & r])"},
+		{"(\\ ([] 1) ([{:keys [x]}] x))", "FUNCTION (fn lambda [] [{x :x}])"},
+		{"(defn f ([x] x) ([x y z] x)) (f 1 2)", "ERROR: wrong number of arguments to f, got 2, expected 1 or 3\n    at test:1:30"},
+		{"(defn f ([] 0) ([x] x) ([x y z & r] x)) (f 1 2)", "ERROR: wrong number of arguments to f, got 2, expected 0, 1 or at least 3\n    at test:1:41"},
+		{"(defn f ([x] x) ([x y (z 1)] x))\n(defn g [] (f))\n(g)", "ERROR: wrong number of arguments to f, got 0, expected 1 or 2 to 3\n    at g (test:2:12)\n    at test:3:1"},
+		{"(defn f ([n] (recur 1 2)) ([a b] a))", "ERROR: wrong number of arguments to recur, got 2, expected 1\n    at test:1:14"},
+		{"(defn f ([x] x) ([y] y))", "ERROR: defn has more than one arity taking 1 argument\n    at test:1:1"},
+		{"(defn f ([x] x) ([x (y 1) (z 2)] y))", "ERROR: defn has more than one arity taking 1 argument\n    at test:1:1"},
+		{"(\\ ([x y] x) ([a b] a))", "ERROR: lambda has more than one arity taking 2 arguments\n    at test:1:1"},
+		{"(defn f ([& x] x) ([&key y] y))", "ERROR: defn can only have one variadic arity\n    at test:1:1"},
+		{"(defn f ([x] x) 1)", "ERROR: arities of defn must be ([params] body...)\n    at test:1:1"},
+		{"(defn f ([x] x) (y))", "ERROR: arities of defn must be ([params] body...)\n    at test:1:1"},
+		{"(defn f 1)", "ERROR: second argument to defn must be a list of identifiers\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(let [[a b] [1 2]] [b a])", "LIST [2 1]"},
+		{"(let [[a [b c] & more] [1 [2 3] 4 5]] [a b c more])", "LIST [1 2 3 [4 5]]"},
+		{"(let [[a b & more] [1]] [a b more])", "LIST [1 nil []]"},
+		{"(let [[a b :as all] [1 2 3]] [a b all])", "LIST [1 2 [1 2 3]]"},
+		{"(let [[a b] nil] [a b])", "LIST [nil nil]"},
+		{"(let [[a b] '(1 2)] (+ a b))", "INTEGER 3"},
+		{"(let [{:keys [x y]} {:x 1 :y 2}] [x y])", "LIST [1 2]"},
+		{"(let [{a :a [b c] \"bc\"} {:a 1 \"bc\" [2 3]}] [a b c])", "LIST [1 2 3]"},
+		{"(let [{:keys [x y] :or {y (+ x 1)} :as m} {:x 1}] [x y m])", "LIST [1 2 {:x 1}]"},
+		{"(let [{:keys [x] :or {x 5}} {:x nil}] x)", "NIL nil"},
+		{"(let [{:keys [x y]} nil] [x y])", "LIST [nil nil]"},
+		{"(let [[a b] [1 2] c (+ a b)] c)", "INTEGER 3"},
+		{"(defn f [[a b] {:keys [c]}] [a b c]) (f [1 2] {:c 3})", "LIST [1 2 3]"},
+		{"(defn f [& [a b]] [a b]) (f 1 2)", "LIST [1 2]"},
+		{"(defn f [([a b] [1 2])] (+ a b)) [(f) (f [3 4])]", "LIST [3 7]"},
+		{"((\\ [{:keys [title]}] title) {:title \"lo\"})", "STRING lo"},
+		{"(defn f [[x & xs] (acc 0)] (if (nil? x) acc (recur xs (+ acc x)))) (f [1 2 3])", "INTEGER 6"},
+		{"(loop [[x & xs] [1 2 3] acc []] (if (nil? x) acc (recur xs (concat acc [(* x x)]))))", "FORM (1 4 9)"},
+		{"(loop [{:keys [n] :or {n 3}} {} acc []] (if (= n 0) acc (recur {:n (- n 1)} (concat acc [n]))))", "FORM (3 2 1)"},
+		{"(defmacro m [[a b]] `(+ ~a ~b)) (m (1 2))", "INTEGER 3"},
+		{"(let [[a b] 1] a)", "ERROR: cannot destructure INTEGER with a list pattern [a b]\n    at test:1:7"},
+		{"(let [{:keys [a]} [1]] a)", "ERROR: cannot destructure LIST with a map pattern {a :a}\n    at test:1:7"},
+		{"(let [[a [b]] [1 2]] a)", "ERROR: cannot destructure INTEGER with a list pattern [b]\n    at test:1:10"},
+		{"(defn f [[a]] a)\n(f 1)", "ERROR: cannot destructure INTEGER with a list pattern [a]\n    at f (test:1:10)\n    at test:2:1"},
+		{"(loop [[a] [1]] (recur 2))", "ERROR: cannot destructure INTEGER with a list pattern [a]\n    at test:1:8"},
+		{"(let [[a 1] [1]] a)", "ERROR: binding names in let must be identifiers or patterns\n    at test:1:1"},
+		{"(let [[a & b c] [1]] a)", "ERROR: only :as can follow the rest of a list pattern\n    at test:1:1"},
+		{"(let [[a & b & c] [1]] a)", "ERROR: & can only appear once in a list pattern\n    at test:1:1"},
+		{"(let [[a :as] [1]] a)", "ERROR: :as in a pattern must be followed by a name\n    at test:1:1"},
+		{"(let [[a :as b c] [1]] a)", "ERROR: :as must come last in a list pattern\n    at test:1:1"},
+		{"(let [{:keys x} {}] x)", "ERROR: :keys in a map pattern must be a list of names\n    at test:1:1"},
+		{"(let [{:keys [x] :or [x 1]} {}] x)", "ERROR: :or in a map pattern must map names to defaults\n    at test:1:1"},
+		{"(let [{a [1 2] b #{:x}} {[1 2] 3 #{:x} 4}] [a b])", "LIST [3 4]"},
+		{"(let [{a [1.5]} {}] a)", "ERROR: keys in a map pattern must be constants usable as map keys\n    at test:1:1"},
+		{"(defn f [&key [a]] a)", "ERROR: keyword parameters to defn must be names\n    at test:1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(defn adder [x] (\\ [y] (+ x y))) ((adder 2) 3)", 5},
+		{"(defn f [a] (\\ [b] (\\ [c] (+ a b c)))) (((f 1) 2) 3)", 6},
+		{"(defn f [] (def g (\\ [] (h))) (def h (\\ [] 7)) (g)) (f)", 7},
+		{"(defn f [n] (defn g [m] (+ n m)) (g 1)) (f 41)", 42},
+		{"(defn f [] (def a (\\ [] (h 7))) (defn h ([x] x)) (a)) (f)", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+// TestClosureCapture pins down what a closure sees of the bindings around
+// it: the bindings themselves, not copies of their values, with new ones
+// for each call, block and loop iteration
+func TestClosureCapture(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Each loop iteration binds i afresh
+		{"(loop [i 0 fs []] (if (< i 3) (recur (+ i 1) (concat fs [(\\ [] i)])) (let [[f0 f1 f2] fs] [(f0) (f1) (f2)])))", "LIST [0 1 2]"},
+		// Closures over the same binding share it
+		{"(let [n 0 up (\\ [] (set! n (+ n 1))) get-n (\\ [] n)] (up) (up) (get-n))", "INTEGER 2"},
+		// Each call makes new bindings
+		{"(defn make [] (let [n 0] (\\ [] (set! n (+ n 1))))) (def a (make)) (def b (make)) (a) (a) (b)", "INTEGER 1"},
+		// A def later in the body is visible to closures made before it
+		{"(defn f [] (def g (\\ [] x)) (def x 5) (g)) (f)", "INTEGER 5"},
+		{"(defn f [] (defn ev? [n] (if (= n 0) true (od? (- n 1)))) (defn od? [n] (if (= n 0) false (ev? (- n 1)))) (ev? 4)) (f)", "BOOLEAN true"},
+		// A def inside a function binds a local of the call, not a global
+		{"(def x 1) (defn f [] (def x 2) x) [(f) x]", "LIST [2 1]"},
+		{"(defn f [n] (def g (\\ [] n)) g) (def g1 (f 1)) (def g2 (f 2)) [(g1) (g2)]", "LIST [1 2]"},
+		// Reading a local before its def has run is an error
+		{"(defn f [c] (when c (def y 1)) y) (f false)", "ERROR: identifier not found: y\n    at f (test:1:32)\n    at test:1:35"},
+		{"(defn f [] (str y) (def y 1)) (f)", "ERROR: identifier not found: y\n    at f (test:1:17)\n    at test:1:31"},
+		{"(defn f [] [y] (def y 1)) (f)", "ERROR: identifier not found: y\n    at f (test:1:13)\n    at test:1:27"},
+		{"(let [v y] (def y 1) v)", "ERROR: identifier not found: y\n    at test:1:9"},
+		{"(defn f [] (h) (defn h [] 1)) (f)", "ERROR: identifier not found: h\n    at f (test:1:13)\n    at test:1:31"},
+		{"(defn f [c] (when c (def y 1)) y) (f true)", "INTEGER 1"},
+		// Locals shadow globals, and globals are looked up when used
+		{"(def x 1) (defn f [x] (\\ [] x)) (def g (f 5)) (def x 2) (g)", "INTEGER 5"},
+		{"(defn f [] (g)) (defn g [] 1) (def before (f)) (defn g [] 2) [before (f)]", "LIST [1 2]"},
+		{"(def n 1) (defn f [] n) (set! n 2) (f)", "INTEGER 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+// TestClosuresAcrossPrograms runs programs one after another against the
+// same global environment, as the REPL does
+func TestClosuresAcrossPrograms(t *testing.T) {
+	tests := []struct {
+		inputs   []string
+		expected string
+	}{
+		{[]string{"(defn f [] (g))", "(defn g [] 1)", "(f)"}, "INTEGER 1"},
+		{[]string{"(defn g [] 1)", "(defn f [] (g))", "(defn g [] 2)", "(f)"}, "INTEGER 2"},
+		{[]string{"(def x 1)", "(defn f [] x)", "(def x 2)", "(f)"}, "INTEGER 2"},
+		{[]string{"(def c (let [n 0] (\\ [] (set! n (+ n 1)))))", "(c)", "(c)"}, "INTEGER 2"},
+		{[]string{"(def a (atom 0))", "(defn bump [] (swap! a + 1))", "(bump)", "(bump)", "@a"}, "INTEGER 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testSession(t, tt.inputs...)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.inputs, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestSetBang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(def x 1) (set! x 2) x", "INTEGER 2"},
+		{"(def x 1) (set! x (+ x 1))", "INTEGER 2"},
+		{"(let [x 1] (set! x 5) x)", "INTEGER 5"},
+		{"(def x 1) (let [x 2] (set! x 3)) x", "INTEGER 1"},
+		{"(def x 1) (defn f [] (set! x 10)) (f) x", "INTEGER 10"},
+		{"(defn counter [] (let [n 0] (\\ [] (set! n (+ n 1))))) (def c (counter)) (c) (c) (c)", "INTEGER 3"},
+		{"(defn f [n] (let [g (\\ [] (set! n (* n 2)))] (g) (g) n)) (f 3)", "INTEGER 12"},
+		{"(def total 0) (loop [i 1] (when (< i 4) (set! total (+ total i)) (recur (+ i 1)))) total", "INTEGER 6"},
+		{"(set! y 1)", "ERROR: cannot set! unbound identifier: y\n    at test:1:1"},
+		{"(defn f [] (set! y 1))\n(f)", "ERROR: cannot set! unbound identifier: y\n    at f (test:1:12)\n    at test:2:1"},
+		{"(set! + 1)", "ERROR: cannot set! builtin: +\n    at test:1:1"},
+		{"(set! nil 1)", "ERROR: cannot set! builtin: nil\n    at test:1:1"},
+		{"(set! x)", "ERROR: wrong number of arguments to set!, got 1, expected 2\n    at test:1:1"},
+		{"(set! 1 2)", "ERROR: first argument to set! must be an identifier\n    at test:1:1"},
+		{"(def x 1) (set! x (foo)) x", "ERROR: identifier not found: foo\n    at test:1:20"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"()", "empty list"},
+		{"(1 2)", "first element is not a function"},
+		{"foo", "identifier not found: foo"},
+		{"(def x)", "wrong number of arguments to def, got 1, expected 2"},
+		{"(defn f [1] 1)", "parameters to defn must be identifiers or patterns"},
+		{"(\\ x 1)", "first argument to lambda must be a list of identifiers"},
+		{"(if true 1)", "wrong number of arguments to if, got 2, expected 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", err.Message, tt.expected)
+		}
+	}
+}
+
+func TestErrorPropagation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(+ 1 (foo))", "identifier not found: foo"},
+		{"(+ 1 \"a\")", "unsupported operand types for +: INTEGER and STRING"},
+		{"(-)", "wrong number of arguments to -, got 0, expected at least 1"},
+		{"[1 (2) 3]", "first element is not a function"},
+		{"(def x (foo)) x", "identifier not found: foo"},
+		{"(if (foo) 1 2)", "identifier not found: foo"},
+		{"(defn f [] (foo) 1) (f)", "identifier not found: foo"},
+		{"(foo) (println \"unreachable\")", "identifier not found: foo"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("wrong error message. got=%q, want=%q", err.Message, tt.expected)
+		}
+	}
+}
+
+func TestErrorTraces(t *testing.T) {
+	input := `(defn inner [x]
+  (+ x "oops"))
+(defn middle [x]
+  (inner x)
+  1)
+(defn outer [x]
+  (+ (middle x) 1))
+(defn tail [x]
+  (outer x))
+(tail 1)`
+
+	expected := `ERROR: unsupported operand types for +: INTEGER and STRING
+    at inner (test:2:3)
+    at middle (test:4:3)
+    at outer (test:7:6)
+    at test:10:1`
+
+	// tail's frame was replaced by its tail call to outer
+	evaluated := testEval(t, input)
+
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if err.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%s\ngot=%s", expected, err.Traceback())
+	}
+
+	tok := err.Token()
+	if tok.Filename != "test" || tok.Line != 2 || tok.Column != 3 {
+		t.Errorf("wrong error position. got=%s:%d:%d", tok.Filename, tok.Line, tok.Column)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(try 1 (catch e 2))`, "1"},
+		{`(try (throw "boom") (catch e (error-message e)))`, "boom"},
+		{`(try (throw "boom") (catch e (error-kind e)))`, "error"},
+		{`(try (/ 1 0) (catch "divide-by-zero" e (error-kind e)))`, "divide-by-zero"},
+		{`(try (-) (catch "arity-error" e 1))`, "1"},
+		{`(try (foo) (catch "type-error" e 1) (catch "name-error" e 2))`, "2"},
+		{`(try (throw "not-found" [1 2]) (catch "not-found" e (error-payload e)))`, "[1 2]"},
+		{`(try (try (foo) (catch e (throw e))) (catch "name-error" e 3))`, "3"},
+		{`(try (try (foo) (catch "type-error" e 1)) (catch e (error-kind e)))`, "name-error"},
+		{`(defn f [] (throw "x")) (defn g [] (try (f) (catch e (str "caught " (error-message e))))) (g)`, "caught x"},
+		{`(defn f [x] (try (+ x 1) (catch e 0))) (f "a")`, "0"},
+		{`(def e 1) (try (foo) (catch e 2)) e`, "1"},
+		{`(try 1 (finally 2))`, "1"},
+		{`(try (def y 1) (finally (def x 2))) (+ x y)`, "3"},
+		{`(try (try (foo) (finally (def x 3))) (catch e x))`, "3"},
+		{`(try (try (foo) (catch e 1) (finally (def x 4))) (+ x 0))`, "4"},
+		{`(try (try (foo) (catch e (bar)) (finally (def z "!"))) (catch e (str (error-message e) z)))`, "identifier not found: bar!"},
+		{`(try (try 1 (finally (foo))) (catch e (error-message e)))`, "identifier not found: foo"},
+		{`(try (try (throw "a") (finally (throw "b"))) (catch e (error-message e)))`, "b"},
+		{`(try (def z 5) (+ z 1))`, "6"},
+		// Kinds can be keywords as well as strings
+		{`(try (/ 1 0) (catch :divide-by-zero e (error-kind e)))`, "divide-by-zero"},
+		{`(try (foo) (catch :type-error e 1) (catch :name-error e 2))`, "2"},
+		{`(try (throw :not-found [1 2]) (catch "not-found" e (error-payload e)))`, "[1 2]"},
+		{`(try (throw "not-found" 1) (catch :not-found e (error-kind e)))`, "not-found"},
+		{`(try (throw :not-found 1) (catch :not-found e (error-kind e)))`, "not-found"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestTryErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		kind     string
+		expected string
+	}{
+		{`(try (foo) (catch "type-error" e 1))`, "name-error", "identifier not found: foo"},
+		{`(try 1 (finally 2) (catch e 3))`, "syntax-error", "finally must be the last clause in try"},
+		{`(try 1 (catch e 2) 3)`, "syntax-error", "only catch and finally clauses may follow them in try"},
+		{`(try 1 (catch "kind"))`, "syntax-error", "catch clause must name the error it binds"},
+		{`(defn f [] (try (foo) (catch e 1)) e) (f)`, "name-error", "identifier not found: e"},
+		{`(throw "a" "b" "c")`, "arity-error", "wrong number of arguments to throw, got 3, expected 1 or 2"},
+		{`(throw "custom" "msg")`, "custom", "msg"},
+		{`(throw :custom "msg")`, "custom", "msg"},
+		{`(try (throw :custom "msg") (catch :other e 1))`, "custom", "msg"},
+		{`(throw 1 "msg")`, "type-error", "error kind must be a STRING or KEYWORD, got INTEGER"},
+		{`(error-kind 1)`, "type-error", "argument to error-kind must be an ERROR, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if err.Kind != tt.kind || err.Message != tt.expected {
+			t.Errorf("wrong error. got=%s %q, want=%s %q", err.Kind, err.Message, tt.kind, tt.expected)
+		}
+	}
+}
+
+func TestCaughtErrorIsValue(t *testing.T) {
+	evaluated := testEval(t, `(defn f [] (foo)) (try (f) (catch e e))`)
+
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if !err.Caught {
+		t.Errorf("caught error should be marked as caught")
+	}
+
+	if len(err.Trace) != 2 || err.Trace[0].Function != "f" {
+		t.Errorf("caught error should keep its trace. got=%s", err.Traceback())
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// depth reports how deep the Go stack is when the recursion bottoms out
+	globals := map[string]object.Object{
+		"depth": &object.Builtin{Name: "depth", Fn: func(args ...object.Object) object.Object {
+			return &object.Integer{Value: int64(runtime.Callers(0, make([]uintptr, 4096)))}
+		}},
+	}
+
+	countdown := `
+(defn countdown [n]
+  (if (= n 0)
+    (depth)
+    (countdown (- n 1))))
+(defn even [n] (if (= n 0) true (odd (- n 1))))
+(defn odd [n] (if (= n 0) false (even (- n 1))))
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(= (countdown 10) (countdown 10000))", "true"},
+		{"(countdown 1000000) 1", "1"},
+		{"(even 10001)", "false"},
+		{"(defn down [n] (or (= n 0) (down (- n 1)))) (down 100000)", "true"},
+		{"(defn up [n] (and (> n 0) (up (- n 1)))) (up 100000)", "false"},
+		{"(defn tally [n acc] (if (= n 0) acc (tally (- n 1) (+ acc 1)))) (tally 10000 0)", "10000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWith(t, countdown+tt.input, globals)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	deep := "(defn deep [n] (if (= n 0) 0 (+ 1 (deep (- n 1))))) "
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{deep + "(deep 9000)", "INTEGER 9000"},
+		{deep + "(deep 3000000)", "ERROR: maximum call depth of 10000 exceeded\n    at deep (test:1:35)\n    at deep (test:1:35)\n    at deep (test:1:35)\n    ... repeated 9997 more times\n    at test:1:53"},
+		{"(defn f [] (+ 1 (f))) (f)", "ERROR: maximum call depth of 10000 exceeded\n    at f (test:1:17)\n    at f (test:1:17)\n    at f (test:1:17)\n    ... repeated 9997 more times\n    at test:1:23"},
+		{`(defn f [] (+ 1 (f))) (try (f) (catch "depth-error" e (str e)))`, "STRING ERROR: maximum call depth of 10000 exceeded"},
+		{"(defn f [x] (map f [x])) (f 1)", "ERROR: maximum call depth of 10000 exceeded\n    at f (test:1:13)\n    at f (test:1:13)\n    at f (test:1:13)\n    ... repeated 9997 more times\n    at test:1:26"},
+		{"(defn f [n] (if (= n 0) :done (f (- n 1)))) (f 100000)", "KEYWORD :done"},
+		{"(defn nat [n] (lazy-seq (cons n (nat (+ n 1))))) (nth (nat 0) 20000)", "INTEGER 20000"},
+		{"(defn nat [n] (lazy-seq (cons n (nat (+ n 1))))) (reduce + (take 20001 (nat 0)))", "INTEGER 200010000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "MAP {}"},
+		{"{1 2 \"a\" 3 true 4}", "MAP {1 2 a 3 true 4}"},
+		{"{1 (+ 1 1) (+ 1 2) [4]}", "MAP {1 2 3 [4]}"},
+		{"{1 2 1 3}", "MAP {1 3}"},
+		{"(get {1 2} 1)", "INTEGER 2"},
+		{"(get {\"a\" 2} \"a\")", "INTEGER 2"},
+		{"(get {1 2} \"1\" 3)", "INTEGER 3"},
+		{"(get {1 2} 2)", "NIL nil"},
+		{"(get {'a 1} 'a)", "INTEGER 1"},
+		{"(assoc {1 2} 3 4 1 5)", "MAP {1 5 3 4}"},
+		{"(def m {1 2}) (assoc m 3 4) m", "MAP {1 2}"},
+		{"(dissoc {1 2 3 4 5 6} 3 7)", "MAP {1 2 5 6}"},
+		{"(keys {3 4 1 2})", "LIST [3 1]"},
+		{"(vals {3 4 1 2})", "LIST [4 2]"},
+		{"(contains? {1 2} 1)", "BOOLEAN true"},
+		{"(contains? {1 2} 2)", "BOOLEAN false"},
+		{"(merge {1 2 3 4} {3 5} {6 7})", "MAP {1 2 3 5 6 7}"},
+		{"(merge)", "MAP {}"},
+		{"(update {1 2} 1 + 10)", "MAP {1 12}"},
+		{"(update {1 2} 1 (\\ [x] (* x 3)))", "MAP {1 6}"},
+		{"(defn f [m] (update m \"n\" (\\ [x y] (+ x y)) 5)) (f {\"n\" 1})", "MAP {n 6}"},
+		{"(update {1 {2 3}} 1 update 2 + 1)", "MAP {1 {2 4}}"},
+		{"'{a [b c]}", "MAP {a [b c]}"},
+		{"(def b 2) `{a ~b}", "MAP {a 2}"},
+		{"(defmacro m [x] (get x 'k)) (m {k (+ 1 2)})", "INTEGER 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		kind     string
+		expected string
+	}{
+		{"{[1.5] 2}", "type-error", "unusable as map key: LIST"},
+		{"'{[1.5] 2}", "type-error", "unusable as map key: LIST"},
+		{"(get [1] 1)", "type-error", "first argument to get must be a MAP, got LIST"},
+		{"(assoc {} [1.5] 1)", "type-error", "unusable as map key: LIST"},
+		{"(get {})", "arity-error", "wrong number of arguments to get, got 1, expected 2 or 3"},
+		{"(assoc {} 1)", "arity-error", "wrong number of arguments to assoc, got 2, expected a map or list followed by key-value pairs"},
+		{"(merge {} 1)", "type-error", "arguments to merge must be MAPs, got INTEGER"},
+		{"(update {1 2} 1 3)", "type-error", "not a function, got INTEGER"},
+		{"(update {1 2} 1 (\\ [x] (foo)))", "name-error", "identifier not found: foo"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if err.Kind != tt.kind || err.Message != tt.expected {
+			t.Errorf("wrong error for %q. got=%s %q, want=%s %q", tt.input, err.Kind, err.Message, tt.kind, tt.expected)
+		}
+	}
+}
+
+func TestHigherOrderBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"(defn f [x]\n  (foo))\n(update {1 2}\n  1 f)",
+			"ERROR: identifier not found: foo\n    at f (test:2:4)\n    at test:3:1",
+		},
+		{
+			"(defn f [x] (throw \"inner\"))\n(try (update {1 2} 1 f) (catch e (error-message e)))",
+			"STRING inner",
+		},
+		{
+			"(defn f [x] (try (throw \"inner\") (catch e (+ x 1))))\n(update {1 2} 1 f)",
+			"MAP {1 3}",
+		},
+		{
+			"(defn f [x] (update {1 x} 1 (\\ [y] (throw \"deep\"))))\n(try (f 1) (catch e (error-message e)))",
+			"STRING deep",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%q, want=%q", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestKeywordsAndSymbols(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":a", "KEYWORD :a"},
+		{":status-code", "KEYWORD :status-code"},
+		{"[:a :b]", "LIST [:a :b]"},
+		{"{:a 1 :b 2}", "MAP {:a 1 :b 2}"},
+		{"(get {:a 1} :a)", "INTEGER 1"},
+		{"(:a {:a 1})", "INTEGER 1"},
+		{"(:b {:a 1} 2)", "INTEGER 2"},
+		{"(:b {:a 1})", "NIL nil"},
+		{"(:a [1])", "NIL nil"},
+		{"(defn f [m] (:n m)) (f {:n 3})", "INTEGER 3"},
+		{"(defn f [k m] (k m)) (f :n {:n 3})", "INTEGER 3"},
+		{"(update {:n {:m 1}} :n :m)", "MAP {:n 1}"},
+		{"{:a 1 \"a\" 2 'a 3}", "MAP {:a 1 a 2 a 3}"},
+		{"(keyword \"a\")", "KEYWORD :a"},
+		{"(keyword 'a)", "KEYWORD :a"},
+		{"(get {:a 1} (keyword \"a\"))", "INTEGER 1"},
+		{"(symbol \"a\")", "SYMBOL a"},
+		{"(symbol :a)", "SYMBOL a"},
+		{"(get {'a 1} (symbol \"a\"))", "INTEGER 1"},
+		{"(name :a)", "STRING a"},
+		{"(name 'a)", "STRING a"},
+		{"(name \"a\")", "STRING a"},
+		{"(keyword? :a)", "BOOLEAN true"},
+		{"(keyword? 'a)", "BOOLEAN false"},
+		{"(symbol? 'a)", "BOOLEAN true"},
+		{"(symbol? \"a\")", "BOOLEAN false"},
+		{"(symbol? (gensym))", "BOOLEAN true"},
+		{"(= (gensym) (gensym))", "BOOLEAN false"},
+		{"(starts-with? (name (gensym \"tmp\")) \"tmp\")", "BOOLEAN true"},
+		{"(defmacro my-or [a b] (let [t (gensym)] `(let [~t ~a] (if ~t ~t ~b)))) (let [t 5] (my-or false t))", "INTEGER 5"},
+		{"':a", "KEYWORD :a"},
+		{"'(:a b)", "FORM (:a b)"},
+		{"(defmacro k [x] `(~x {~x 1})) (k :a)", "INTEGER 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestKeywordsAreInterned(t *testing.T) {
+	a := testEval(t, ":a")
+	b := testEval(t, "(keyword \"a\")")
+	if a != b {
+		t.Errorf("keywords with the same name are different objects")
+	}
+}
+
+func TestKeywordErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		kind     string
+		expected string
+	}{
+		{"(:a)", "arity-error", "wrong number of arguments to keyword :a, got 0, expected 1 or 2"},
+		{"(keyword 1)", "type-error", "argument to keyword must be a KEYWORD, SYMBOL or STRING, got INTEGER"},
+		{"(name)", "arity-error", "wrong number of arguments to name, got 0, expected 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if err.Kind != tt.kind || err.Message != tt.expected {
+			t.Errorf("wrong error for %q. got=%s %q, want=%s %q", tt.input, err.Kind, err.Message, tt.kind, tt.expected)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"'a", "SYMBOL a"},
+		{"'1", "INTEGER 1"},
+		{"'true", "BOOLEAN true"},
+		{"'(a b 1)", "FORM (a b 1)"},
+		{"'(a [b \"c\"] (d))", "FORM (a [b c] (d))"},
+		{"(quote (+ 1 2))", "FORM (+ 1 2)"},
+		{"''a", "FORM (quote a)"},
+		{"'()", "FORM ()"},
+		{"(defn f [] '(x)) (f)", "FORM (x)"},
+		{"(defn f [] '(def x 1) x) (def x 2) (f)", "INTEGER 2"},
+		{"(def b 2) `(a ~b)", "FORM (a 2)"},
+		{"(def b [1 2]) `(a ~@b c)", "FORM (a 1 2 c)"},
+		{"(def b [1 2]) `[a ~@b]", "LIST [a 1 2]"},
+		{"(def b 2) `[a ~b]", "LIST [a 2]"},
+		{"`(a (b ~(+ 1 2)))", "FORM (a (b 3))"},
+		{"(def b '(x y)) `(~@b ~@b)", "FORM (x y x y)"},
+		{"(list 1 'a)", "FORM (1 a)"},
+		{"(concat '(1) [2])", "FORM (1 2)"},
+		{"(vec '(1 2))", "LIST [1 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if inspect(evaluated) != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defmacro unless [c a b] `(if ~c ~b ~a)) (unless false 1 2)", "1"},
+		{"(defmacro unless [c a b] `(if ~c ~b ~a)) (unless true 1 2)", "2"},
+		{"(defmacro do-all [body] `(try ~@body)) (do-all [(def x 1) (+ x 1)])", "2"},
+		{"(defmacro swap [form] (vec form)) (swap (1 2))", "[1 2]"},
+		{"(defmacro sq [x] `(* ~x ~x)) (defn f [n] (sq (+ n 1))) (f 2)", "9"},
+		{"(defmacro sq [x] `(* ~x ~x)) (defmacro quad [x] `(sq (sq ~x))) (quad 2)", "16"},
+		{"(defmacro m [] '(+ 1 2)) (macroexpand '(m))", "(+ 1 2)"},
+		{"(defmacro sq [x] `(* ~x ~x)) (defmacro quad [x] `(sq (sq ~x))) (macroexpand-1 '(quad 2))", "(sq (sq 2))"},
+		{"(defmacro sq [x] `(* ~x ~x)) (defmacro quad [x] `(sq (sq ~x))) (macroexpand '(quad 2))", "(* (sq 2) (sq 2))"},
+		{"(defmacro sum [& xs] (letfn [(total [ys] (if (empty? ys) 0 (+ (first ys) (total (rest ys)))))] (total xs))) (sum 1 2 3)", "6"},
+		{"(defmacro down [n] (if (= n 0) 0 `(down ~(- n 1)))) (down 900)", "0"},
+		{"(macroexpand '(+ 1 2))", "(+ 1 2)"},
+		{"(macroexpand 1)", "1"},
+		{"(defmacro ident [x] x) (defn f [] (macroexpand '(ident y))) (f)", "y"},
+		// Macros can call the functions defined above their calls
+		{"(defn helper [] 1) (defmacro m [] (helper)) (m)", "1"},
+		{"(def n 2) (defmacro m [] n) (m)", "2"},
+		{"(defmacro m [] (helper)) (defn helper [] '(+ 1 2)) (m)", "3"},
+		{"(defn wrap [body] `(do ~@body :done)) (defmacro my-do [& body] (wrap body)) (my-do 1 2)", ":done"},
+		{"(defn double [x] `(* 2 ~x)) (defmacro doubles [& xs] (vec (map double xs))) (doubles 1 2)", "[2 4]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, inspect(evaluated), tt.expected)
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		kind     string
+		expected string
+	}{
+		{"`(a ~@b)", "name-error", "identifier not found: b"},
+		{"~a", "syntax-error", "unquote used outside of quasiquote"},
+		{"`~@a", "syntax-error", "unquote-splicing used outside of a list"},
+		{"(defn f [] (defmacro m [] 1))", "syntax-error", "defmacro is only allowed at the top level"},
+		{"(defmacro m [x])", "syntax-error", "wrong number of arguments to defmacro, got 2, expected 3"},
+		{"(defmacro m [x] x) (m)", "arity-error", "wrong number of arguments to macro m, got 0, expected 1"},
+		{"(defmacro m [] (throw \"bad\")) (m)", "error", "bad"},
+		{"(defmacro m [] (\\ [] 1)) (m)", "type-error", "in expansion of macro m: cannot use FUNCTION as code"},
+		{"(defmacro m [] (helper)) (m) (defn helper [] 1)", "name-error", "identifier not found: helper"},
+		{"(defn helper [] (foo)) (defmacro m [] (list (helper))) (m)", "name-error", "identifier not found: foo"},
+		{"(defmacro m [] (throw \"bad\")) (macroexpand '(m))", "error", "bad"},
+		{"(defmacro m [] '(m)) (m)", "syntax-error", "macro expansion too deep"},
+		{"(defmacro m [] '(do (m))) (m)", "syntax-error", "macro expansion too deep"},
+		{"(defmacro m [] '(m)) (macroexpand '(m))", "syntax-error", "macro expansion too deep"},
+		{"(gensym 1)", "type-error", "argument to gensym must be a STRING, got INTEGER"},
+		{"(gensym \"a\" \"b\")", "arity-error", "wrong number of arguments to gensym, got 2, expected 0 or 1"},
+		{"(quote 1 2)", "syntax-error", "wrong number of arguments to quote, got 2, expected 1"},
+		{"(concat 1)", "type-error", "argument to concat must be a sequence, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if err.Kind != tt.kind || err.Message != tt.expected {
+			t.Errorf("wrong error for %q. got=%s %q, want=%s %q", tt.input, err.Kind, err.Message, tt.kind, tt.expected)
+		}
+	}
+}
+
+func TestMacroErrorTraces(t *testing.T) {
+	input := "(defmacro m []\n  (throw \"bad\"))\n(+ 1\n   (m))"
+	expected := "ERROR: bad\n    at m (test:2:3)\n    at test:4:4"
+
+	evaluated := testEval(t, input)
+	if inspect(evaluated) != expected {
+		t.Errorf("wrong traceback. got=%q, want=%q", inspect(evaluated), expected)
+	}
+}
+
+func TestMacrosPersist(t *testing.T) {
+	env := object.NewEnvironment()
+	evalProgram(parse("(defmacro twice [x] `(+ ~x ~x))"), env)
+
+	evaluated := evalProgram(parse("(twice 21)"), env)
+	testIntegerObject(t, evaluated, 42)
+
+	// Macros can call the functions earlier programs define, as on later
+	// lines of the REPL, on either back end
+	evaluated = testSession(t, "(defn helper [x] `(+ ~x 1))", "(defmacro inc [x] (helper x))", "(inc 41)")
+	testIntegerObject(t, evaluated, 42)
+}
+
 // Helpers
 
-func testEval(input string) object.Object {
+func parse(input string) *ast.Program {
 	l := lexer.New(input, "test")
 	p := parser.New(l)
-	program := p.Parse()
+	return p.Parse()
+}
+
+// testEval runs input through both the tree-walking evaluator and the
+// bytecode VM, failing the test if the two back ends disagree. It returns
+// the evaluator's result for the caller to check.
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalWith(t, input, nil)
+}
+
+// testEvalWith is testEval with extra globals defined in both back ends
+func testEvalWith(t *testing.T, input string, globals map[string]object.Object) object.Object {
+	t.Helper()
+
+	program := parse(input)
+
+	evaluated := evalProgram(program, newTestEnvironment(globals))
+	executed := runProgram(t, input, program, newTestEnvironment(globals))
+
+	if inspect(evaluated) != inspect(executed) {
+		t.Errorf("back ends disagree on %q. eval=%s, vm=%s", input, inspect(evaluated), inspect(executed))
+	}
 
+	return evaluated
+}
+
+// testSession runs each input in turn on both back ends, keeping one
+// global environment for each as the REPL does, and returns the
+// evaluator's result for the last
+func testSession(t *testing.T, inputs ...string) object.Object {
+	t.Helper()
+
+	evalEnv := object.NewEnvironment()
+	vmEnv := object.NewEnvironment()
+	constants := []object.Object{}
+
+	var evaluated, executed object.Object
+	for _, input := range inputs {
+		evaluated = evalProgram(parse(input), evalEnv)
+		executed = runForms(t, input, parse(input), vmEnv, &constants)
+	}
+
+	if inspect(evaluated) != inspect(executed) {
+		t.Errorf("back ends disagree on %q. eval=%s, vm=%s", inputs, inspect(evaluated), inspect(executed))
+	}
+	return evaluated
+}
+
+// evalProgram expands and runs each form of program on the tree-walker
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	return eval.RunForms(program, env, func(form *ast.Program) object.Object {
+		return eval.Eval(form, env)
+	})
+}
+
+// runProgram expands and runs each form of program on the VM
+func runProgram(t *testing.T, input string, program *ast.Program, env *object.Environment) object.Object {
+	t.Helper()
+	return runForms(t, input, program, env, &[]object.Object{})
+}
+
+// runForms is runProgram with the constants of earlier programs run in
+// env, which it adds to
+func runForms(t *testing.T, input string, program *ast.Program, env *object.Environment, constants *[]object.Object) object.Object {
+	t.Helper()
+
+	return eval.RunForms(program, env, func(form *ast.Program) object.Object {
+		comp := compiler.NewWithState(*constants)
+		if err := comp.Compile(form); err != nil {
+			t.Fatalf("compiler error on %q: %s", input, err)
+		}
+		bytecode := comp.Bytecode()
+		*constants = bytecode.Constants
+
+		machine := vm.New(bytecode, env)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error on %q: %s", input, err)
+		}
+		return machine.LastPoppedStackElem()
+	})
+}
+
+func newTestEnvironment(globals map[string]object.Object) *object.Environment {
 	env := object.NewEnvironment()
+	for name, val := range globals {
+		env.Set(name, val)
+	}
+	return env
+}
 
-	return Eval(program, env)
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	if err, ok := obj.(*object.Error); ok {
+		return err.Traceback()
+	}
+	return string(obj.Type()) + " " + obj.Inspect()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
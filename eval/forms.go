@@ -0,0 +1,336 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/consts"
+	"lo/object"
+)
+
+// BindingForm is the shape of a (let [pattern value ...] body...) or loop
+// form, shared with the compiler so both back ends accept the same syntax
+type BindingForm struct {
+	Patterns []*object.Pattern
+	Values   []ast.Expression
+	Body     []ast.Expression
+}
+
+// ParseBindings splits a let or loop form into its bindings and body
+func ParseBindings(le *ast.ListExpression) (*BindingForm, *object.Error) {
+	name := formName(le)
+	if len(le.Expressions) < 2 {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to " + name + ", got 0, expected at least 1"}
+	}
+
+	bindings, ok := le.Expressions[1].(*ast.ListLiteral)
+	if !ok {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "first argument to " + name + " must be a list of bindings"}
+	}
+	if len(bindings.Expressions)%2 != 0 {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: name + " bindings must contain an even number of forms"}
+	}
+
+	form := &BindingForm{Body: le.Expressions[2:]}
+	for i := 0; i < len(bindings.Expressions); i += 2 {
+		pattern, err := ParsePattern(bindings.Expressions[i], "binding names in "+name+" must be identifiers or patterns")
+		if err != nil {
+			return nil, err
+		}
+		form.Patterns = append(form.Patterns, pattern)
+		form.Values = append(form.Values, bindings.Expressions[i+1])
+	}
+	return form, nil
+}
+
+// evalLet binds each pattern in turn in a new environment, so later values
+// can refer to earlier names, then evaluates the body there
+func evalLet(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	form, err := ParseBindings(le)
+	if err != nil {
+		return err
+	}
+
+	letEnv, result := bindAll(form, env)
+	if result != nil {
+		return result
+	}
+	return evalBlock(form.Body, letEnv, tail)
+}
+
+// bindAll evaluates the values of form's bindings in order in a new
+// environment enclosed by env, binding each to its pattern there
+func bindAll(form *BindingForm, env *object.Environment) (*object.Environment, object.Object) {
+	bindEnv := object.NewEnclosedEnvironment(env)
+	for i, pattern := range form.Patterns {
+		val := Eval(form.Values[i], bindEnv)
+		if isError(val) {
+			return nil, val
+		}
+		if err := bindPattern(pattern, val, bindEnv); err != nil {
+			return nil, err
+		}
+	}
+	return bindEnv, nil
+}
+
+// LetfnForm is the shape of a (letfn [(name [params] body...) ...] body...)
+// form. Each function can have several arities, like a defn.
+type LetfnForm struct {
+	Names   []*ast.Identifier
+	Arities [][]*Arity
+	Body    []ast.Expression
+}
+
+// ParseLetfn splits a letfn form into its functions and body
+func ParseLetfn(le *ast.ListExpression) (*LetfnForm, *object.Error) {
+	if len(le.Expressions) < 2 {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to letfn, got 0, expected at least 1"}
+	}
+
+	fns, ok := le.Expressions[1].(*ast.ListLiteral)
+	if !ok {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "first argument to letfn must be a list of functions"}
+	}
+
+	form := &LetfnForm{Body: le.Expressions[2:]}
+	for _, exp := range fns.Expressions {
+		fn, ok := exp.(*ast.ListExpression)
+		if !ok || len(fn.Expressions) < 2 {
+			return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "functions in letfn must be (name [params] body...)"}
+		}
+		name, ok := fn.Expressions[0].(*ast.Identifier)
+		if !ok {
+			return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "functions in letfn must be (name [params] body...)"}
+		}
+		arities, err := ParseArities(fn.Expressions[1:], "letfn", "functions in letfn must be (name [params] body...)")
+		if err != nil {
+			return nil, err
+		}
+		form.Names = append(form.Names, name)
+		form.Arities = append(form.Arities, arities)
+	}
+	return form, nil
+}
+
+// evalLetfn binds each function in a new environment that they all close
+// over, so they can call each other, then evaluates the body there
+func evalLetfn(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	form, err := ParseLetfn(le)
+	if err != nil {
+		return err
+	}
+
+	fnEnv := object.NewEnclosedEnvironment(env)
+	for i, name := range form.Names {
+		bindName(name, newFunction(name.Value, form.Arities[i], fnEnv), fnEnv)
+	}
+	return evalBlock(form.Body, fnEnv, tail)
+}
+
+// evalLoop binds its patterns like let, then evaluates the body again in a
+// fresh environment each time it recurs, with the patterns bound to the
+// values passed to recur
+func evalLoop(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	form, err := ParseBindings(le)
+	if err != nil {
+		return err
+	}
+
+	loopEnv, result := bindAll(form, env)
+	if result != nil {
+		return result
+	}
+
+	for {
+		result := evalBlock(form.Body, loopEnv, tail)
+		rc, ok := result.(*recurCall)
+		if !ok {
+			return result
+		}
+
+		loopEnv = object.NewEnclosedEnvironment(env)
+		for i, pattern := range form.Patterns {
+			if err := bindPattern(pattern, rc.args[i], loopEnv); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func evalRecur(le *ast.ListExpression, env *object.Environment) object.Object {
+	args := make([]object.Object, 0, len(le.Expressions)-1)
+	for _, exp := range le.Expressions[1:] {
+		val := Eval(exp, env)
+		if isError(val) {
+			return val
+		}
+		args = append(args, val)
+	}
+	return &recurCall{args: args}
+}
+
+func evalDo(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	return evalBlock(le.Expressions[1:], env, tail)
+}
+
+// CheckCond checks that a cond form has a result for every test
+func CheckCond(le *ast.ListExpression) *object.Error {
+	if len(le.Expressions)%2 != 1 {
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "cond requires an even number of forms"}
+	}
+	return nil
+}
+
+// evalCond evaluates the result of the first test that is truthy, or
+// returns nil if there is none. A final :else test is always truthy.
+func evalCond(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	if err := CheckCond(le); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(le.Expressions); i += 2 {
+		test := Eval(le.Expressions[i], env)
+		if isError(test) {
+			return test
+		}
+		if object.IsTruthy(test) {
+			return evalBranch(le.Expressions[i+1], env, tail)
+		}
+	}
+	return &consts.Nil
+}
+
+// CheckWhen checks that a when or unless form has a test
+func CheckWhen(le *ast.ListExpression) *object.Error {
+	if len(le.Expressions) < 2 {
+		name := le.Expressions[0].(*ast.Identifier).Value
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to " + name + ", got 0, expected at least 1"}
+	}
+	return nil
+}
+
+// evalWhen evaluates the body when the test's truthiness is want, and
+// returns nil otherwise. unless is when with want false.
+func evalWhen(le *ast.ListExpression, env *object.Environment, tail bool, want bool) object.Object {
+	if err := CheckWhen(le); err != nil {
+		return err
+	}
+
+	test := Eval(le.Expressions[1], env)
+	if isError(test) {
+		return test
+	}
+	if object.IsTruthy(test) != want {
+		return &consts.Nil
+	}
+	return evalBlock(le.Expressions[2:], env, tail)
+}
+
+// CaseForm is the shape of a (case expr constant result ... default) form.
+// No constant can appear twice.
+type CaseForm struct {
+	Expr    ast.Expression
+	Clauses []CaseClause
+	Default ast.Expression
+}
+
+// CaseClause is one constant and its result. The constant is read as
+// quoted data, and a form of constants matches any one of them.
+type CaseClause struct {
+	Constants *object.List
+	Result    ast.Expression
+}
+
+// Matches reports whether val is equal to one of the clause's constants
+func (c CaseClause) Matches(val object.Object) bool {
+	for _, constant := range c.Constants.Elements() {
+		if object.Equal(constant, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCase splits a case form into its clauses and optional default
+func ParseCase(le *ast.ListExpression) (*CaseForm, *object.Error) {
+	if len(le.Expressions) < 2 {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to case, got 0, expected at least 1"}
+	}
+
+	form := &CaseForm{Expr: le.Expressions[1]}
+	seen := []object.Object{}
+	rest := le.Expressions[2:]
+	if len(rest)%2 == 1 {
+		form.Default = rest[len(rest)-1]
+		rest = rest[:len(rest)-1]
+	}
+
+	for i := 0; i < len(rest); i += 2 {
+		alternatives := []ast.Expression{rest[i]}
+		if group, ok := rest[i].(*ast.ListExpression); ok {
+			alternatives = group.Expressions
+		}
+
+		constants, err := quoteAll(alternatives)
+		if err != nil {
+			return nil, err.(*object.Error)
+		}
+		for _, constant := range constants {
+			for _, other := range seen {
+				if object.Equal(constant, other) {
+					return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: fmt.Sprintf("duplicate case constant: %s", constant.Inspect())}
+				}
+			}
+			seen = append(seen, constant)
+		}
+		form.Clauses = append(form.Clauses, CaseClause{Constants: object.NewList(constants), Result: rest[i+1]})
+	}
+	return form, nil
+}
+
+// NoCase is the error raised when no clause of a case without a default
+// matches val
+func NoCase(val object.Object) *object.Error {
+	return &object.Error{Kind: object.MATCH_ERROR, Message: fmt.Sprintf("non-exhaustive case: no clause matches %s", val.Inspect())}
+}
+
+// evalCase evaluates the result of the first clause with a constant equal
+// to the value of expr, or the default. Without one, it's an error for no
+// clause to match.
+func evalCase(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	form, err := ParseCase(le)
+	if err != nil {
+		return err
+	}
+
+	val := Eval(form.Expr, env)
+	if isError(val) {
+		return val
+	}
+
+	for _, c := range form.Clauses {
+		if c.Matches(val) {
+			return evalBranch(c.Result, env, tail)
+		}
+	}
+	if form.Default != nil {
+		return evalBranch(form.Default, env, tail)
+	}
+	return NoCase(val)
+}
+
+func evalBranch(exp ast.Expression, env *object.Environment, tail bool) object.Object {
+	if tail {
+		return evalTail(exp, env)
+	}
+	return Eval(exp, env)
+}
+
+// evalBlock evaluates exps in order, with the last in tail position if the
+// block is
+func evalBlock(exps []ast.Expression, env *object.Environment, tail bool) object.Object {
+	if tail {
+		return evalBody(exps, env)
+	}
+	return evalSequence(exps, env)
+}
@@ -0,0 +1,263 @@
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"lo/object"
+)
+
+// lazySeq is the builtin a (lazy-seq body...) form becomes, with the body
+// wrapped in a function of no arguments. It returns a LazySeq that calls
+// the function when it's first realized, and is the sequence the function
+// returns.
+func lazySeq(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("lazy-seq", len(args), "1")
+	}
+
+	body := args[0]
+	return object.NewLazySeq(func() (object.Object, *object.LazySeq) {
+		result := apply(body)
+		if isError(result) {
+			return result, nil
+		}
+		if seq, ok := result.(*object.LazySeq); ok {
+			return seq.Realize()
+		}
+		seq, ok := result.(object.Iterable)
+		if !ok {
+			return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("lazy-seq body must return a sequence, got %s", typeName(result))}, nil
+		}
+		return object.IteratorSeq(seq.Iterator()).Realize()
+	})
+}
+
+// Realize realizes any lazy sequences in obj, including those inside its
+// elements, so it can be printed. It returns the first error realizing
+// them raises, or nil.
+func Realize(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.LazySeq, *object.List, *object.Form, *object.Set:
+		it := obj.(object.Iterable).Iterator()
+		for elem := it.Next(); elem != nil; elem = it.Next() {
+			if isError(elem) {
+				return elem
+			}
+			if err := Realize(elem); err != nil {
+				return err
+			}
+		}
+	case *object.Map:
+		for _, pair := range obj.Pairs() {
+			if err := Realize(pair.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func lazyCons(elem object.Object, seq *object.LazySeq) *object.LazySeq {
+	return object.NewLazySeq(func() (object.Object, *object.LazySeq) {
+		return elem, seq
+	})
+}
+
+// iterate returns the unbounded sequence x, (f x), (f (f x)) and so on
+func iterate(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("iterate", len(args), "2")
+	}
+
+	f, x := args[0], args[1]
+	started := false
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		if started {
+			x = apply(f, x)
+		}
+		started = true
+		return x
+	}))
+}
+
+// repeat returns the lazy sequence of its last argument, unbounded, or n
+// long if it's preceded by n
+func repeat(args ...object.Object) object.Object {
+	switch len(args) {
+	case 1:
+		return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+			return args[0]
+		}))
+	case 2:
+		n, err := indexArg("repeat", args[0])
+		if err != nil {
+			return err
+		}
+		return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+			if n <= 0 {
+				return nil
+			}
+			n--
+			return args[1]
+		}))
+	}
+	return arityError("repeat", len(args), "1 or 2")
+}
+
+// cycle returns the unbounded sequence of the elements of a sequence,
+// repeated over and over
+func cycle(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("cycle", len(args), "1")
+	}
+
+	elems, err := elements("cycle", args[0])
+	if err != nil {
+		return err
+	}
+	i := 0
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		if len(elems) == 0 {
+			return nil
+		}
+		elem := elems[i%len(elems)]
+		i++
+		return elem
+	}))
+}
+
+// stdin is shared by every sequence read-lines returns, so each reads on
+// from where the last left off
+var stdin = bufio.NewReader(os.Stdin)
+
+// readLines returns the lines of standard input as a LazySeq, reading each
+// only when it's needed
+func readLines(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return arityError("read-lines", len(args), "0")
+	}
+
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		line, err := stdin.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return nil
+			}
+			return &object.Error{Kind: object.IO_ERROR, Message: err.Error()}
+		}
+		line = strings.TrimSuffix(line, "\n")
+		return &object.String{Value: strings.TrimSuffix(line, "\r")}
+	}))
+}
+
+// lazyTake is take on a LazySeq
+func lazyTake(args []object.Object) object.Object {
+	n, err := indexArg("take", args[0])
+	if err != nil {
+		return err
+	}
+
+	it := args[1].(*object.LazySeq).Iterator()
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		if n <= 0 {
+			return nil
+		}
+		n--
+		elem := it.Next()
+		if isError(elem) {
+			n = 0
+		}
+		return elem
+	}))
+}
+
+// lazyDrop is drop on a LazySeq
+func lazyDrop(args []object.Object) object.Object {
+	n, err := indexArg("drop", args[0])
+	if err != nil {
+		return err
+	}
+
+	it := args[1].(*object.LazySeq).Iterator()
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		for ; n > 0; n-- {
+			if elem := it.Next(); elem == nil || isError(elem) {
+				return elem
+			}
+		}
+		return it.Next()
+	}))
+}
+
+// lazyConcat is concat on sequences at least one of which is a LazySeq
+func lazyConcat(args []object.Object) object.Object {
+	its := make([]object.Iterator, len(args))
+	for i, arg := range args {
+		it, err := iterator("concat", arg)
+		if err != nil {
+			return err
+		}
+		its[i] = it
+	}
+
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		for len(its) > 0 {
+			if elem := its[0].Next(); elem != nil {
+				return elem
+			}
+			its = its[1:]
+		}
+		return nil
+	}))
+}
+
+// lazyMap is map on sequences at least one of which is a LazySeq, or zip
+// if f is nil
+func lazyMap(apply object.Applier, name string, f object.Object, seqs []object.Object) object.Object {
+	its := make([]object.Iterator, len(seqs))
+	for i, seq := range seqs {
+		it, err := iterator(name, seq)
+		if err != nil {
+			return err
+		}
+		its[i] = it
+	}
+
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		row := make([]object.Object, len(its))
+		for i, it := range its {
+			row[i] = it.Next()
+			if row[i] == nil || isError(row[i]) {
+				return row[i]
+			}
+		}
+		if f == nil {
+			return newList(row)
+		}
+		return apply(f, row...)
+	}))
+}
+
+// lazyFilter is filter on a LazySeq
+func lazyFilter(apply object.Applier, pred object.Object, seq *object.LazySeq) object.Object {
+	it := seq.Iterator()
+	return object.IteratorSeq(object.IteratorFunc(func() object.Object {
+		for elem := it.Next(); elem != nil; elem = it.Next() {
+			if isError(elem) {
+				return elem
+			}
+			keep := apply(pred, elem)
+			if isError(keep) {
+				return keep
+			}
+			if object.IsTruthy(keep) {
+				return elem
+			}
+		}
+		return nil
+	}))
+}
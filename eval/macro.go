@@ -0,0 +1,299 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/consts"
+	"lo/object"
+)
+
+// RunForms expands the top-level forms of program one at a time, handing
+// each to run as a program of its own before expanding the next, so a
+// macro can call the functions the forms before its call define. It
+// returns the value of the last form, or the first error expanding or
+// running one. Both back ends run programs through it.
+func RunForms(program *ast.Program, env *object.Environment, run func(*ast.Program) object.Object) object.Object {
+	var result object.Object = &consts.Nil
+
+	for _, exp := range program.Expressions {
+		form, err := ExpandMacros(&ast.Program{Expressions: []ast.Expression{exp}}, env)
+		if err != nil {
+			return err
+		}
+		if len(form.Expressions) == 0 {
+			continue
+		}
+
+		result = run(form)
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// ExpandMacros defines the program's top-level macros in env and returns
+// the program with every quasiquote rewritten and every macro call
+// replaced by its expansion. It also checks that every recur is in tail
+// position of a loop or function, and resolves the identifiers of the
+// expanded program. A macro's body runs on the tree-walker in env, so it
+// can use the globals defined when it's called, but not those the rest of
+// the program being expanded defines; RunForms expands a form only once
+// the forms before it have run.
+func ExpandMacros(program *ast.Program, env *object.Environment) (*ast.Program, *object.Error) {
+	expanded := &ast.Program{Expressions: []ast.Expression{}}
+
+	for _, exp := range program.Expressions {
+		if le, ok := exp.(*ast.ListExpression); ok && formName(le) == "defmacro" {
+			if err := defineMacro(le, env); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		exp, err := expand(exp, env, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRecur(exp, noTarget, false); err != nil {
+			return nil, err
+		}
+		expanded.Expressions = append(expanded.Expressions, exp)
+	}
+
+	Resolve(expanded)
+	return expanded, nil
+}
+
+// defineMacro binds a (defmacro name [params] body...) form in env. The
+// body runs at expansion time, closing over env.
+func defineMacro(le *ast.ListExpression, env *object.Environment) *object.Error {
+	if len(le.Expressions) < 4 {
+		return syntaxError(le.Token, "wrong number of arguments to defmacro, got %d, expected 3", len(le.Expressions)-1)
+	}
+
+	ident, ok := le.Expressions[1].(*ast.Identifier)
+	if !ok {
+		return syntaxError(le.Token, "first argument to defmacro must be an identifier")
+	}
+
+	paramsExpr, ok := le.Expressions[2].(*ast.ListLiteral)
+	if !ok {
+		return syntaxError(le.Token, "second argument to defmacro must be a list of identifiers")
+	}
+
+	params, err := ParseParams(paramsExpr, "defmacro")
+	if err != nil {
+		err.Locate(le.Token)
+		return err
+	}
+
+	body := []ast.Expression{}
+	for _, exp := range le.Expressions[3:] {
+		exp, err := expand(exp, env, 0)
+		if err != nil {
+			return err
+		}
+		body = append(body, exp)
+	}
+	if err := checkRecurBody(body, params.Signature.Len(), true); err != nil {
+		return err
+	}
+	resolveMacro(params, body)
+
+	fn := newArity(ident.Value, params, body, env)
+	env.Set(ident.Value, &object.Macro{Fn: fn})
+	return nil
+}
+
+// maxExpansionDepth bounds how deeply macro calls can expand into further
+// macro calls, so a macro that expands into a call to itself is an error
+// rather than a stack overflow
+const maxExpansionDepth = 1000
+
+// expand expands the macro calls in exp. depth is the number of macro
+// calls whose expansion exp is part of.
+func expand(exp ast.Expression, env *object.Environment, depth int) (ast.Expression, *object.Error) {
+	switch exp := exp.(type) {
+	case *ast.ListExpression:
+		switch name := formName(exp); name {
+		case "quote":
+			return exp, nil
+		case "quasiquote":
+			if len(exp.Expressions) != 2 {
+				return nil, syntaxError(exp.Token, "wrong number of arguments to quasiquote, got %d, expected 1", len(exp.Expressions)-1)
+			}
+			built, err := quasiquote(exp.Expressions[1], exp.Token)
+			if err != nil {
+				return nil, err
+			}
+			return expand(built, env, depth)
+		case "unquote", "unquote-splicing":
+			return nil, syntaxError(exp.Token, "%s used outside of quasiquote", name)
+		case "defmacro":
+			return nil, syntaxError(exp.Token, "defmacro is only allowed at the top level")
+		case "lazy-seq":
+			body, err := expandAll(exp.Expressions[1:], env, depth)
+			if err != nil {
+				return nil, err
+			}
+			// The call is left as it is, or it would be wrapped again
+			params := &ast.ListLiteral{Token: withLiteral(exp.Token, "["), Expressions: []ast.Expression{}}
+			return call(exp.Token, "lazy-seq", call(exp.Token, "\\", append([]ast.Expression{params}, body...)...)), nil
+		default:
+			if m, ok := lookupMacro(name, env); ok {
+				if depth >= maxExpansionDepth {
+					return nil, syntaxError(exp.Token, "macro expansion too deep")
+				}
+				args := make([]object.Object, len(exp.Expressions)-1)
+				for i, arg := range exp.Expressions[1:] {
+					args[i] = Quote(arg)
+					if err, ok := args[i].(*object.Error); ok {
+						err.Locate(exp.Token)
+						return nil, err
+					}
+				}
+
+				expansion, err := expandCall(m, args, exp)
+				if err != nil {
+					return nil, err
+				}
+				return expand(expansion, env, depth+1)
+			}
+		}
+
+		exps, err := expandAll(exp.Expressions, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ListExpression{Token: exp.Token, Expressions: exps}, nil
+
+	case *ast.ListLiteral:
+		exps, err := expandAll(exp.Expressions, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ListLiteral{Token: exp.Token, Expressions: exps}, nil
+
+	case *ast.MapLiteral:
+		keys, err := expandAll(exp.Keys, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		values, err := expandAll(exp.Values, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.MapLiteral{Token: exp.Token, Keys: keys, Values: values}, nil
+
+	case *ast.SetLiteral:
+		exps, err := expandAll(exp.Expressions, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.SetLiteral{Token: exp.Token, Expressions: exps}, nil
+	}
+
+	return exp, nil
+}
+
+func expandAll(exps []ast.Expression, env *object.Environment, depth int) ([]ast.Expression, *object.Error) {
+	expanded := make([]ast.Expression, len(exps))
+	for i, exp := range exps {
+		e, err := expand(exp, env, depth)
+		if err != nil {
+			return nil, err
+		}
+		expanded[i] = e
+	}
+	return expanded, nil
+}
+
+// expandCall expands one call to a macro, reporting errors at the call
+func expandCall(m *object.Macro, args []object.Object, call *ast.ListExpression) (ast.Expression, *object.Error) {
+	result := applyMacro(m, args)
+	if isError(result) {
+		err := result.(*object.Error)
+		err.Locate(call.Token)
+		return nil, err
+	}
+
+	expansion, err := ToAST(result, call.Token)
+	if err != nil {
+		err.Message = fmt.Sprintf("in expansion of macro %s: %s", m.Fn.Name, err.Message)
+		err.Locate(call.Token)
+		return nil, err
+	}
+	return expansion, nil
+}
+
+// applyMacro calls m on the quoted arguments of a call to it
+func applyMacro(m *object.Macro, args []object.Object) object.Object {
+	slots, err := m.Fn.Signature.Bind("macro "+m.Fn.Name, args)
+	if err != nil {
+		return err
+	}
+	return callFunction(m.Fn, slots)
+}
+
+func lookupMacro(name string, env *object.Environment) (*object.Macro, bool) {
+	if name == "" {
+		return nil, false
+	}
+	obj, ok := env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	m, ok := obj.(*object.Macro)
+	return m, ok
+}
+
+// Macroexpand expands form, a call to a macro as data, until it is no
+// longer a macro call, or just once if once is set. Anything else is
+// returned as is.
+func Macroexpand(form object.Object, env *object.Environment, once bool) object.Object {
+	for depth := 0; ; depth++ {
+		f, ok := form.(*object.Form)
+		if !ok || len(f.Elements) == 0 {
+			return form
+		}
+
+		head, ok := f.Elements[0].(*object.Symbol)
+		if !ok {
+			return form
+		}
+
+		m, ok := lookupMacro(head.Name, env)
+		if !ok {
+			return form
+		}
+		if depth >= maxExpansionDepth {
+			return &object.Error{Kind: object.SYNTAX_ERROR, Message: "macro expansion too deep"}
+		}
+
+		form = applyMacro(m, f.Elements[1:])
+		if isError(form) || once {
+			return form
+		}
+	}
+}
+
+func evalQuote(le *ast.ListExpression) object.Object {
+	if len(le.Expressions) != 2 {
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: fmt.Sprintf("wrong number of arguments to quote, got %d, expected 1", len(le.Expressions)-1)}
+	}
+	return Quote(le.Expressions[1])
+}
+
+func evalMacroexpand(le *ast.ListExpression, env *object.Environment) object.Object {
+	name := formName(le)
+	if len(le.Expressions) != 2 {
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: fmt.Sprintf("wrong number of arguments to %s, got %d, expected 1", name, len(le.Expressions)-1)}
+	}
+
+	form := Eval(le.Expressions[1], env)
+	if isError(form) {
+		return form
+	}
+	return Macroexpand(form, env, name == "macroexpand-1")
+}
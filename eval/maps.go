@@ -0,0 +1,293 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/consts"
+	"lo/object"
+)
+
+// BuildMap builds a map from parallel keys and values, as written in a map
+// literal. Later pairs replace earlier ones with the same key.
+func BuildMap(keys, values []object.Object) object.Object {
+	m := object.NewMap().Transient()
+	for i, key := range keys {
+		hashable, err := hashKey(key)
+		if err != nil {
+			return err
+		}
+		m.Assoc(hashable, values[i])
+	}
+	return m.Persistent()
+}
+
+// hashKey checks that key can be stored in a map, realizing any lazy
+// sequences in it first
+func hashKey(key object.Object) (object.Hashable, *object.Error) {
+	if err := Realize(key); err != nil {
+		return nil, err.(*object.Error)
+	}
+	if !object.IsHashable(key) {
+		return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("unusable as map key: %s", typeName(key))}
+	}
+	return key.(object.Hashable), nil
+}
+
+// lookupKey returns key to look up in a map or set, reporting false if it
+// can't be stored in one, so no map or set has it
+func lookupKey(key object.Object) (object.Hashable, bool, *object.Error) {
+	if err := Realize(key); err != nil {
+		return nil, false, err.(*object.Error)
+	}
+	if !object.IsHashable(key) {
+		return nil, false, nil
+	}
+	return key.(object.Hashable), true, nil
+}
+
+func evalMapLiteral(ml *ast.MapLiteral, env *object.Environment) object.Object {
+	keys := make([]object.Object, len(ml.Keys))
+	values := make([]object.Object, len(ml.Values))
+
+	for i := range ml.Keys {
+		key := Eval(ml.Keys[i], env)
+		if isError(key) {
+			return key
+		}
+		value := Eval(ml.Values[i], env)
+		if isError(value) {
+			return value
+		}
+		keys[i], values[i] = key, value
+	}
+
+	result := BuildMap(keys, values)
+	if isError(result) {
+		result.(*object.Error).Locate(ml.Token)
+	}
+	return result
+}
+
+func mapArg(name string, arg object.Object) (*object.Map, object.Object) {
+	m, ok := arg.(*object.Map)
+	if !ok {
+		return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("first argument to %s must be a MAP, got %s", name, typeName(arg))}
+	}
+	return m, nil
+}
+
+// get returns the value stored under a key, or a default when it's missing
+func get(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("get", len(args), "2 or 3")
+	}
+
+	m, err := mapArg("get", args[0])
+	if err != nil {
+		return err
+	}
+
+	key, ok, keyErr := lookupKey(args[1])
+	if keyErr != nil {
+		return keyErr
+	}
+
+	if ok {
+		if val, found := m.Get(key); found {
+			return val
+		}
+	}
+	if len(args) == 3 {
+		return args[2]
+	}
+	return &consts.Nil
+}
+
+// assoc returns a map with each key-value pair added, or a list with the
+// element at each index replaced, where the index just past the end adds
+// an element
+func assoc(args ...object.Object) object.Object {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return arityError("assoc", len(args), "a map or list followed by key-value pairs")
+	}
+
+	if l, ok := args[0].(*object.List); ok {
+		return assocList(l, args[1:])
+	}
+	m, err := mapArg("assoc", args[0])
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		key, err := hashKey(args[i])
+		if err != nil {
+			return err
+		}
+		m = m.Assoc(key, args[i+1])
+	}
+	return m
+}
+
+func assocList(l *object.List, pairs []object.Object) object.Object {
+	for i := 0; i < len(pairs); i += 2 {
+		index, err := indexArg("assoc", pairs[i])
+		if err != nil {
+			return err
+		}
+		if index < 0 || index > l.Len() {
+			return &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("index %d out of range for assoc on a list of length %d", index, l.Len())}
+		}
+		l = l.Assoc(index, pairs[i+1])
+	}
+	return l
+}
+
+// dissoc returns a map without the given keys
+func dissoc(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("dissoc", len(args), "at least 1")
+	}
+
+	m, err := mapArg("dissoc", args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args[1:] {
+		key, ok, err := lookupKey(arg)
+		if err != nil {
+			return err
+		}
+		if ok {
+			m = m.Dissoc(key)
+		}
+	}
+	return m
+}
+
+func keys(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("keys", len(args), "1")
+	}
+
+	m, err := mapArg("keys", args[0])
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, 0, m.Len())
+	for _, pair := range m.Pairs() {
+		elements = append(elements, pair.Key)
+	}
+	return object.NewList(elements)
+}
+
+func vals(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("vals", len(args), "1")
+	}
+
+	m, err := mapArg("vals", args[0])
+	if err != nil {
+		return err
+	}
+
+	elements := make([]object.Object, 0, m.Len())
+	for _, pair := range m.Pairs() {
+		elements = append(elements, pair.Value)
+	}
+	return object.NewList(elements)
+}
+
+func contains(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("contains?", len(args), "2")
+	}
+
+	if s, ok := args[0].(*object.Set); ok {
+		member, ok, err := lookupKey(args[1])
+		if err != nil {
+			return err
+		}
+		return nativeBool(ok && s.Contains(member))
+	}
+	m, ok := args[0].(*object.Map)
+	if !ok {
+		return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("first argument to contains? must be a MAP or SET, got %s", typeName(args[0]))}
+	}
+
+	key, ok, err := lookupKey(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nativeBool(false)
+	}
+
+	_, found := m.Get(key)
+	return nativeBool(found)
+}
+
+// merge returns a map with the pairs of all its arguments, later maps
+// replacing the values of earlier ones
+func merge(args ...object.Object) object.Object {
+	result := object.NewMap().Transient()
+	for _, arg := range args {
+		m, ok := arg.(*object.Map)
+		if !ok {
+			return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("arguments to merge must be MAPs, got %s", typeName(arg))}
+		}
+		for _, pair := range m.Pairs() {
+			result.Assoc(pair.Key, pair.Value)
+		}
+	}
+	return result.Persistent()
+}
+
+// update returns a map with the value under a key replaced by the result
+// of calling f on it, followed by any extra arguments
+func update(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) < 3 {
+		return arityError("update", len(args), "at least 3")
+	}
+
+	m, err := mapArg("update", args[0])
+	if err != nil {
+		return err
+	}
+
+	key, keyErr := hashKey(args[1])
+	if keyErr != nil {
+		return keyErr
+	}
+
+	old, ok := m.Get(key)
+	if !ok {
+		old = &consts.Nil
+	}
+	val := apply(args[2], append([]object.Object{old}, args[3:]...)...)
+	if isError(val) {
+		return val
+	}
+
+	return m.Assoc(key, val)
+}
+
+// CallKeyword looks k up in the map it's called on, like get. Called on
+// anything other than a map it finds nothing.
+func CallKeyword(k *object.Keyword, args []object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return arityError("keyword "+k.Inspect(), len(args), "1 or 2")
+	}
+
+	if m, ok := args[0].(*object.Map); ok {
+		if val, ok := m.Get(k); ok {
+			return val
+		}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return &consts.Nil
+}
@@ -0,0 +1,332 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/object"
+)
+
+// matchTypes are the types a (TYPE pattern) guard in a match can name
+var matchTypes = map[object.ObjectType]bool{
+	object.INTEGER_OBJ:  true,
+	object.FLOAT_OBJ:    true,
+	object.RATIO_OBJ:    true,
+	object.BOOLEAN_OBJ:  true,
+	object.STRING_OBJ:   true,
+	object.KEYWORD_OBJ:  true,
+	object.SYMBOL_OBJ:   true,
+	object.LIST_OBJ:     true,
+	object.FORM_OBJ:     true,
+	object.MAP_OBJ:      true,
+	object.SET_OBJ:      true,
+	object.LAZY_SEQ_OBJ: true,
+	object.FUNCTION_OBJ: true,
+	object.BUILTIN_OBJ:  true,
+	object.ERROR_OBJ:    true,
+	object.NIL_OBJ:      true,
+}
+
+// MatchForm is the shape of a (match expr pattern result ...) form, where
+// a pattern can be followed by :when and a guard before its result
+type MatchForm struct {
+	Expr    ast.Expression
+	Clauses []MatchClause
+}
+
+// MatchClause is one pattern, its optional guard and its result
+type MatchClause struct {
+	Pattern *object.Pattern
+	Guard   ast.Expression
+	Result  ast.Expression
+}
+
+// ParseMatch splits a match form into its clauses. A pattern can't bind
+// the same name twice.
+func ParseMatch(le *ast.ListExpression) (*MatchForm, *object.Error) {
+	if len(le.Expressions) < 2 {
+		return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "wrong number of arguments to match, got 0, expected at least 1"}
+	}
+
+	form := &MatchForm{Expr: le.Expressions[1]}
+	exps := le.Expressions[2:]
+	for i := 0; i < len(exps); i += 2 {
+		pattern, err := ParseMatchPattern(exps[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDistinctNames(pattern); err != nil {
+			return nil, err
+		}
+		clause := MatchClause{Pattern: pattern}
+
+		if kw, ok := next(exps, i).(*ast.KeywordLiteral); ok && kw.Value == "when" {
+			if i+3 >= len(exps) {
+				return nil, patternError(":when in match must be followed by a guard and a result")
+			}
+			clause.Guard = exps[i+2]
+			i += 2
+		}
+		if i+1 >= len(exps) {
+			return nil, patternError("match requires a result for every pattern")
+		}
+		clause.Result = exps[i+1]
+		form.Clauses = append(form.Clauses, clause)
+	}
+	return form, nil
+}
+
+// ParseMatchPattern parses a pattern of a match clause: _, which matches
+// anything, a name, which matches anything and binds it, a literal or a
+// quoted form, which matches values equal to it, a list or map pattern
+// whose pieces are match patterns, or (TYPE pattern), which matches values
+// of that type that also match pattern
+func ParseMatchPattern(exp ast.Expression) (*object.Pattern, *object.Error) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		switch exp.Value {
+		case "_":
+			return &object.Pattern{Kind: object.WildcardPattern, Token: exp.Token}, nil
+		case "true", "false", "nil":
+			return literalPattern(exp)
+		}
+		return namePattern(exp), nil
+
+	case *ast.IntLiteral, *ast.BigIntLiteral, *ast.FloatLiteral, *ast.RatioLiteral, *ast.StringLiteral, *ast.KeywordLiteral:
+		return literalPattern(exp)
+
+	case *ast.ListLiteral:
+		return parseListPattern(exp, ParseMatchPattern)
+
+	case *ast.MapLiteral:
+		p, err := parseMapPattern(exp, ParseMatchPattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Defaults) > 0 {
+			return nil, patternError(":or can't be used in a match pattern")
+		}
+		return p, nil
+
+	case *ast.ListExpression:
+		switch formName(exp) {
+		case "quote":
+			if len(exp.Expressions) == 2 {
+				return literalPattern(exp.Expressions[1])
+			}
+		default:
+			name := object.ObjectType(formName(exp))
+			if matchTypes[name] && len(exp.Expressions) == 2 {
+				inner, err := ParseMatchPattern(exp.Expressions[1])
+				if err != nil {
+					return nil, err
+				}
+				return &object.Pattern{Kind: object.TypePattern, Token: exp.Token, TypeName: name, Inner: inner}, nil
+			}
+		}
+	}
+	return nil, patternError("patterns in match must be _, names, literals, lists, maps or (TYPE pattern)")
+}
+
+// checkDistinctNames rejects a pattern that binds a name more than once,
+// which would keep only one of the values rather than test they're equal
+func checkDistinctNames(p *object.Pattern) *object.Error {
+	names, _ := p.Bindings()
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name.Value] {
+			return patternError(fmt.Sprintf("%s is bound more than once in a match pattern", name.Value))
+		}
+		seen[name.Value] = true
+	}
+	return nil
+}
+
+func literalPattern(exp ast.Expression) (*object.Pattern, *object.Error) {
+	val := Quote(exp)
+	if err, ok := val.(*object.Error); ok {
+		return nil, patternError(err.Message)
+	}
+	return &object.Pattern{Kind: object.LiteralPattern, Value: val}, nil
+}
+
+// Match tests val against p, returning a value for each of the names p
+// binds, in the order of p.Bindings, if it matches. Unlike destructuring,
+// a list pattern only matches a list, form or lazy sequence of its length,
+// or at least its length if it has a rest pattern, and a map pattern only
+// matches a map with all of its keys. Realizing a lazy sequence far enough
+// to tell can fail, which is returned as an error.
+func Match(p *object.Pattern, val object.Object) ([]object.Object, bool, *object.Error) {
+	vals := []object.Object{}
+	ok, err := match(p, val, &vals)
+	if !ok || err != nil {
+		return nil, false, err
+	}
+	return vals, true, nil
+}
+
+func match(p *object.Pattern, val object.Object, vals *[]object.Object) (bool, *object.Error) {
+	switch p.Kind {
+	case object.NamePattern:
+		*vals = append(*vals, val)
+		return true, nil
+
+	case object.WildcardPattern:
+		return true, nil
+
+	case object.LiteralPattern:
+		return object.Equal(p.Value, val), nil
+
+	case object.TypePattern:
+		if typeName(val) != p.TypeName {
+			return false, nil
+		}
+		return match(p.Inner, val, vals)
+
+	case object.ListPattern:
+		elements, rest, ok, err := matchElements(p, val)
+		if !ok || err != nil {
+			return false, err
+		}
+
+		for i, elem := range p.Elements {
+			if ok, err := match(elem, elements[i], vals); !ok || err != nil {
+				return false, err
+			}
+		}
+		if p.Rest != nil {
+			if ok, err := match(p.Rest, rest, vals); !ok || err != nil {
+				return false, err
+			}
+		}
+
+	case object.MapPattern:
+		m, ok := val.(*object.Map)
+		if !ok {
+			return false, nil
+		}
+		for i, key := range p.Keys {
+			v, ok := m.Get(key)
+			if !ok {
+				return false, nil
+			}
+			if ok, err := match(p.Values[i], v, vals); !ok || err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if p.Name != nil {
+		*vals = append(*vals, val)
+	}
+	return true, nil
+}
+
+// matchElements returns the elements of val a list pattern names and the
+// rest of val after them, reporting whether val is a sequence of a length
+// p matches. Of a LazySeq it realizes only those elements and, if p has no
+// rest pattern, one more to check there are no others.
+func matchElements(p *object.Pattern, val object.Object) ([]object.Object, object.Object, bool, *object.Error) {
+	n := len(p.Elements)
+
+	switch val := val.(type) {
+	case *object.List:
+		if val.Len() < n || (p.Rest == nil && val.Len() > n) {
+			return nil, nil, false, nil
+		}
+		elements := make([]object.Object, n)
+		for i := range elements {
+			elements[i] = val.Nth(i)
+		}
+		return elements, val.Drop(n), true, nil
+
+	case *object.Form:
+		if len(val.Elements) < n || (p.Rest == nil && len(val.Elements) > n) {
+			return nil, nil, false, nil
+		}
+		return val.Elements[:n], object.NewList(val.Elements[n:]), true, nil
+
+	case *object.LazySeq:
+		elements := make([]object.Object, 0, n)
+		seq := val
+		for len(elements) < n {
+			if seq == nil {
+				return nil, nil, false, nil
+			}
+			var elem object.Object
+			elem, seq = seq.Realize()
+			if elem == nil {
+				return nil, nil, false, nil
+			}
+			if isError(elem) {
+				return nil, nil, false, elem.(*object.Error)
+			}
+			elements = append(elements, elem)
+		}
+
+		if p.Rest != nil {
+			if seq == nil {
+				return elements, object.NewList([]object.Object{}), true, nil
+			}
+			return elements, seq, true, nil
+		}
+		if seq != nil {
+			elem, _ := seq.Realize()
+			if isError(elem) {
+				return nil, nil, false, elem.(*object.Error)
+			}
+			if elem != nil {
+				return nil, nil, false, nil
+			}
+		}
+		return elements, nil, true, nil
+	}
+	return nil, nil, false, nil
+}
+
+// NoMatch is the error raised when no clause of a match matches val
+func NoMatch(val object.Object) *object.Error {
+	return &object.Error{Kind: object.MATCH_ERROR, Message: fmt.Sprintf("non-exhaustive match: no pattern matches %s", val.Inspect())}
+}
+
+// evalMatch evaluates the result of the first clause whose pattern matches
+// the value and whose guard, if it has one, is truthy, with the pattern's
+// names bound in a new environment
+func evalMatch(le *ast.ListExpression, env *object.Environment, tail bool) object.Object {
+	form, err := ParseMatch(le)
+	if err != nil {
+		return err
+	}
+
+	val := Eval(form.Expr, env)
+	if isError(val) {
+		return val
+	}
+
+	for _, clause := range form.Clauses {
+		vals, ok, err := Match(clause.Pattern, val)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		clauseEnv := object.NewEnclosedEnvironment(env)
+		names, _ := clause.Pattern.Bindings()
+		for i, name := range names {
+			bindName(name, vals[i], clauseEnv)
+		}
+
+		if clause.Guard != nil {
+			guard := Eval(clause.Guard, clauseEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !object.IsTruthy(guard) {
+				continue
+			}
+		}
+		return evalBranch(clause.Result, clauseEnv, tail)
+	}
+	return NoMatch(val)
+}
@@ -0,0 +1,318 @@
+package eval
+
+import (
+	"math"
+	"math/big"
+
+	"lo/object"
+)
+
+// rank orders the kinds of number by how arithmetic promotes them: an
+// operation is done at the higher rank of its operands, and integer
+// results that overflow an Integer become BigInts
+type rank int
+
+const (
+	notNumber rank = iota
+	integerRank
+	bigIntRank
+	ratioRank
+	floatRank
+)
+
+func rankOf(obj object.Object) rank {
+	switch obj.(type) {
+	case *object.Integer:
+		return integerRank
+	case *object.BigInt:
+		return bigIntRank
+	case *object.Ratio:
+		return ratioRank
+	case *object.Float:
+		return floatRank
+	}
+	return notNumber
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if b, ok := obj.(*object.BigInt); ok {
+		return b.Value
+	}
+	return big.NewInt(obj.(*object.Integer).Value)
+}
+
+func toRat(obj object.Object) *big.Rat {
+	switch obj := obj.(type) {
+	case *object.Ratio:
+		return obj.Value
+	case *object.BigInt:
+		return new(big.Rat).SetInt(obj.Value)
+	}
+	return new(big.Rat).SetInt64(obj.(*object.Integer).Value)
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Float:
+		return obj.Value
+	case *object.Ratio:
+		f, _ := obj.Value.Float64()
+		return f
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	}
+	return float64(obj.(*object.Integer).Value)
+}
+
+// arithmetic is an operator done at each rank. ints reports false if the
+// result overflows, to have it done again with big integers.
+type arithmetic struct {
+	name   string
+	ints   func(a, b int64) (int64, bool)
+	bigs   func(z, a, b *big.Int) *big.Int
+	rats   func(z, a, b *big.Rat) *big.Rat
+	floats func(a, b float64) float64
+}
+
+var (
+	addition = &arithmetic{
+		name: "+",
+		ints: func(a, b int64) (int64, bool) {
+			c := a + b
+			return c, (c > a) == (b > 0)
+		},
+		bigs:   (*big.Int).Add,
+		rats:   (*big.Rat).Add,
+		floats: func(a, b float64) float64 { return a + b },
+	}
+	subtraction = &arithmetic{
+		name: "-",
+		ints: func(a, b int64) (int64, bool) {
+			c := a - b
+			return c, (c < a) == (b > 0)
+		},
+		bigs:   (*big.Int).Sub,
+		rats:   (*big.Rat).Sub,
+		floats: func(a, b float64) float64 { return a - b },
+	}
+	multiplication = &arithmetic{
+		name: "*",
+		ints: func(a, b int64) (int64, bool) {
+			if a == 0 || b == 0 {
+				return 0, true
+			}
+			c := a * b
+			return c, c/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+		},
+		bigs:   (*big.Int).Mul,
+		rats:   (*big.Rat).Mul,
+		floats: func(a, b float64) float64 { return a * b },
+	}
+)
+
+func (op *arithmetic) apply(a, b object.Object) object.Object {
+	ra, rb := rankOf(a), rankOf(b)
+	if ra == notNumber || rb == notNumber {
+		return operandError(op.name, a, b)
+	}
+
+	switch max(ra, rb) {
+	case integerRank:
+		x, y := a.(*object.Integer).Value, b.(*object.Integer).Value
+		if c, ok := op.ints(x, y); ok {
+			return &object.Integer{Value: c}
+		}
+		return object.NewInteger(op.bigs(new(big.Int), big.NewInt(x), big.NewInt(y)))
+	case bigIntRank:
+		return object.NewInteger(op.bigs(new(big.Int), toBigInt(a), toBigInt(b)))
+	case ratioRank:
+		return object.NewRatio(op.rats(new(big.Rat), toRat(a), toRat(b)))
+	}
+	return &object.Float{Value: op.floats(toFloat(a), toFloat(b))}
+}
+
+// fold applies op to identity and the arguments from left to right, or
+// to the arguments alone if there is no identity
+func fold(op *arithmetic, identity object.Object, args []object.Object) object.Object {
+	result := identity
+	if identity == nil {
+		if len(args) == 0 {
+			return arityError(op.name, 0, "at least 1")
+		}
+		result, args = args[0], args[1:]
+	}
+
+	for _, arg := range args {
+		result = op.apply(result, arg)
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
+func add(args ...object.Object) object.Object {
+	return fold(addition, &object.Integer{Value: 0}, args)
+}
+
+// subtract subtracts the rest of its arguments from the first, or negates
+// a lone argument
+func subtract(args ...object.Object) object.Object {
+	if len(args) == 1 {
+		return negate(args[0])
+	}
+	return fold(subtraction, nil, args)
+}
+
+// negate is 0 - x, except that a float zero negates to -0.0
+func negate(x object.Object) object.Object {
+	if f, ok := x.(*object.Float); ok {
+		return &object.Float{Value: -f.Value}
+	}
+	if rankOf(x) == notNumber {
+		return unaryOperandError("-", x)
+	}
+	return subtraction.apply(&object.Integer{Value: 0}, x)
+}
+
+func multiply(args ...object.Object) object.Object {
+	return fold(multiplication, &object.Integer{Value: 1}, args)
+}
+
+// divide divides the first argument by the rest, or 1 by a lone argument.
+// Dividing integers and ratios is exact, giving a Ratio unless the result
+// is whole.
+func divide(args ...object.Object) object.Object {
+	switch len(args) {
+	case 0:
+		return arityError("/", 0, "at least 1")
+	case 1:
+		if rankOf(args[0]) == notNumber {
+			return unaryOperandError("/", args[0])
+		}
+		return div(&object.Integer{Value: 1}, args[0])
+	}
+
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = div(result, arg)
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
+func div(a, b object.Object) object.Object {
+	ra, rb := rankOf(a), rankOf(b)
+	switch {
+	case ra == notNumber || rb == notNumber:
+		return operandError("/", a, b)
+	case max(ra, rb) == floatRank:
+		return &object.Float{Value: toFloat(a) / toFloat(b)}
+	case isZero(b):
+		return divisionByZero()
+	}
+
+	if x, ok := a.(*object.Integer); ok {
+		if y, ok := b.(*object.Integer); ok && y.Value != -1 && x.Value%y.Value == 0 {
+			return &object.Integer{Value: x.Value / y.Value}
+		}
+	}
+	return object.NewRatio(new(big.Rat).Quo(toRat(a), toRat(b)))
+}
+
+func isZero(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value == 0
+	case *object.Float:
+		return obj.Value == 0
+	}
+	// BigInts and Ratios are never zero, which is an Integer
+	return false
+}
+
+func divisionByZero() *object.Error {
+	return &object.Error{Kind: object.DIVIDE_BY_ZERO, Message: "division by zero"}
+}
+
+// division is quot, rem or mod at each rank they're defined for: integers
+// and floats
+type division struct {
+	ints   func(a, b int64) (int64, bool)
+	bigs   func(a, b *big.Int) *big.Int
+	floats func(a, b float64) float64
+}
+
+// quot is the quotient rounded toward zero
+var quot = division{
+	ints: func(a, b int64) (int64, bool) {
+		return a / b, !(a == math.MinInt64 && b == -1)
+	},
+	bigs:   func(a, b *big.Int) *big.Int { return new(big.Int).Quo(a, b) },
+	floats: func(a, b float64) float64 { return math.Trunc(a / b) },
+}
+
+// rem is the remainder of quot, which has the sign of the dividend
+var rem = division{
+	ints:   func(a, b int64) (int64, bool) { return a % b, true },
+	bigs:   func(a, b *big.Int) *big.Int { return new(big.Int).Rem(a, b) },
+	floats: math.Mod,
+}
+
+// mod is the remainder of dividing rounded toward negative infinity, which
+// has the sign of the divisor
+var mod = division{
+	ints: func(a, b int64) (int64, bool) {
+		r := a % b
+		if r != 0 && (r < 0) != (b < 0) {
+			r += b
+		}
+		return r, true
+	},
+	bigs: func(a, b *big.Int) *big.Int {
+		r := new(big.Int).Rem(a, b)
+		if r.Sign() != 0 && r.Sign() != b.Sign() {
+			r.Add(r, b)
+		}
+		return r
+	},
+	floats: func(a, b float64) float64 {
+		r := math.Mod(a, b)
+		if r != 0 && (r < 0) != (b < 0) {
+			r += b
+		}
+		return r
+	},
+}
+
+// integerDivision returns the builtin called name that does d
+func integerDivision(name string, d division) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return arityError(name, len(args), "2")
+		}
+
+		a, b := args[0], args[1]
+		ra, rb := rankOf(a), rankOf(b)
+		switch {
+		case ra == notNumber || rb == notNumber || ra == ratioRank || rb == ratioRank:
+			return operandError(name, a, b)
+		case isZero(b):
+			return divisionByZero()
+		case max(ra, rb) == floatRank:
+			return &object.Float{Value: d.floats(toFloat(a), toFloat(b))}
+		}
+
+		if x, ok := a.(*object.Integer); ok {
+			if y, ok := b.(*object.Integer); ok {
+				if c, ok := d.ints(x.Value, y.Value); ok {
+					return &object.Integer{Value: c}
+				}
+			}
+		}
+		return object.NewInteger(d.bigs(toBigInt(a), toBigInt(b)))
+	}
+}
@@ -0,0 +1,233 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/consts"
+	"lo/object"
+	"strings"
+)
+
+// Params is a parsed parameter list: the pattern each slot is bound to,
+// the default of each optional or keyword parameter, and the Signature
+// that binds arguments to the slots
+type Params struct {
+	Patterns  []*object.Pattern
+	Defaults  []ast.Expression
+	Signature *object.Signature
+}
+
+// ParseParams parses the parameter list of a defn, lambda or defmacro
+// form: required patterns, then optional (pattern default) pairs, then
+// either & followed by a rest pattern, or &key followed by keyword
+// parameters, each a name or a (name default) pair. Keyword parameters
+// can't be combined with optional ones, since both would claim the same
+// arguments.
+func ParseParams(ll *ast.ListLiteral, form string) (*Params, *object.Error) {
+	params := &Params{Signature: &object.Signature{}}
+	sig := params.Signature
+	keys := false
+	source := []string{}
+
+	exps := ll.Expressions
+	for i := 0; i < len(exps); i++ {
+		if ident, ok := exps[i].(*ast.Identifier); ok {
+			switch ident.Value {
+			case "&":
+				if keys {
+					return nil, paramError("parameters to " + form + " cannot have both & and &key")
+				}
+				if i != len(exps)-2 {
+					return nil, paramError("& in parameters to " + form + " must be followed by one pattern")
+				}
+				rest, err := ParsePattern(exps[i+1], "parameters to "+form+" must be identifiers or patterns")
+				if err != nil {
+					return nil, err
+				}
+				sig.Rest = true
+				params.add(rest, nil)
+				source = append(source, "&", rest.Inspect())
+				sig.Source = "[" + strings.Join(source, " ") + "]"
+				return params, params.checkDistinctNames(form)
+			case "&key":
+				if keys {
+					return nil, paramError("&key can only appear once in parameters to " + form)
+				}
+				if sig.Optional > 0 {
+					return nil, paramError("parameters to " + form + " cannot have both optional and &key parameters")
+				}
+				keys = true
+				source = append(source, "&key")
+				continue
+			}
+		}
+
+		pattern, def, err := parseParam(exps[i], form)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case keys && pattern.Kind != object.NamePattern:
+			return nil, paramError("keyword parameters to " + form + " must be names")
+		case keys:
+			sig.Keys = append(sig.Keys, object.InternKeyword(pattern.Name.Value))
+		case def != nil:
+			sig.Optional++
+		case sig.Optional > 0:
+			return nil, paramError("required parameters to " + form + " must come before optional ones")
+		default:
+			sig.Required++
+		}
+		params.add(pattern, def)
+		if def != nil {
+			source = append(source, "("+pattern.Inspect()+" "+Quote(def).Inspect()+")")
+		} else {
+			source = append(source, pattern.Inspect())
+		}
+	}
+
+	sig.Source = "[" + strings.Join(source, " ") + "]"
+	return params, params.checkDistinctNames(form)
+}
+
+// parseParam parses a pattern, or a (pattern default) pair
+func parseParam(exp ast.Expression, form string) (*object.Pattern, ast.Expression, *object.Error) {
+	invalid := "parameters to " + form + " must be identifiers or patterns"
+	if le, ok := exp.(*ast.ListExpression); ok {
+		if len(le.Expressions) != 2 {
+			return nil, nil, paramError("optional parameters to " + form + " must be (name default)")
+		}
+		pattern, err := ParsePattern(le.Expressions[0], invalid)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pattern, le.Expressions[1], nil
+	}
+	pattern, err := ParsePattern(exp, invalid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pattern, nil, nil
+}
+
+// Arity is one parameter list of a function and the body it runs
+type Arity struct {
+	Params *Params
+	Body   []ast.Expression
+}
+
+// ParseArities parses what follows the name of a defn, or the \ of a
+// lambda: a parameter list and a body, or one or more
+// ([params] body...) arities. Only one arity can be variadic, and no two
+// fixed ones can take the same number of arguments. badParams is the
+// message for a function with neither.
+func ParseArities(exps []ast.Expression, form string, badParams string) ([]*Arity, *object.Error) {
+	if params, ok := exps[0].(*ast.ListLiteral); ok {
+		parsed, err := ParseParams(params, form)
+		if err != nil {
+			return nil, err
+		}
+		return []*Arity{{Params: parsed, Body: exps[1:]}}, nil
+	}
+	if _, ok := exps[0].(*ast.ListExpression); !ok {
+		return nil, paramError(badParams)
+	}
+
+	arities := []*Arity{}
+	for _, exp := range exps {
+		le, ok := exp.(*ast.ListExpression)
+		if !ok || len(le.Expressions) == 0 {
+			return nil, paramError("arities of " + form + " must be ([params] body...)")
+		}
+		params, ok := le.Expressions[0].(*ast.ListLiteral)
+		if !ok {
+			return nil, paramError("arities of " + form + " must be ([params] body...)")
+		}
+		parsed, err := ParseParams(params, form)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkArity(parsed.Signature, arities, form); err != nil {
+			return nil, err
+		}
+		arities = append(arities, &Arity{Params: parsed, Body: le.Expressions[1:]})
+	}
+	return arities, nil
+}
+
+// checkArity reports an arity that conflicts with an earlier one
+func checkArity(sig *object.Signature, arities []*Arity, form string) *object.Error {
+	for _, a := range arities {
+		other := a.Params.Signature
+		if sig.Variadic() && other.Variadic() {
+			return paramError(form + " can only have one variadic arity")
+		}
+		if sig.Variadic() || other.Variadic() {
+			continue
+		}
+		for n := sig.Required; n <= sig.Required+sig.Optional; n++ {
+			if !other.Accepts(n) {
+				continue
+			}
+			plural := "s"
+			if n == 1 {
+				plural = ""
+			}
+			return paramError(fmt.Sprintf("%s has more than one arity taking %d argument%s", form, n, plural))
+		}
+	}
+	return nil
+}
+
+func (p *Params) add(pattern *object.Pattern, def ast.Expression) {
+	p.Patterns = append(p.Patterns, pattern)
+	p.Defaults = append(p.Defaults, def)
+}
+
+// checkDistinctNames rejects parameters that bind a name more than once,
+// as a match pattern can't. _ can be repeated, since it's never looked up.
+func (p *Params) checkDistinctNames(form string) *object.Error {
+	seen := map[string]bool{}
+	for _, pattern := range p.Patterns {
+		names, _ := pattern.Bindings()
+		for _, name := range names {
+			if name.Value == "_" {
+				continue
+			}
+			if seen[name.Value] {
+				return paramError(fmt.Sprintf("%s is bound more than once in parameters to %s", name.Value, form))
+			}
+			seen[name.Value] = true
+		}
+	}
+	return nil
+}
+
+func paramError(msg string) *object.Error {
+	return &object.Error{Kind: object.SYNTAX_ERROR, Message: msg}
+}
+
+// bindParameters makes the environment a call to f runs in, with slots
+// bound to its parameters in order. Optional and keyword parameters left
+// unbound get their defaults, evaluated when their turn comes so they can
+// refer to earlier parameters, or nil if they have none.
+func bindParameters(f *object.Function, slots []object.Object) (*object.Environment, object.Object) {
+	env := object.NewEnclosedEnvironment(f.Env)
+	for i, param := range f.Parameters {
+		val := slots[i]
+		if val == nil {
+			val = &consts.Nil
+			if f.Defaults[i] != nil {
+				val = Eval(f.Defaults[i], env)
+			}
+		}
+		if !isError(val) {
+			val = bindPattern(param, val, env)
+		}
+		if isError(val) {
+			val.(*object.Error).Unwind(f.Name)
+			return nil, val
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,305 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/consts"
+	"lo/object"
+	"lo/token"
+)
+
+// Quote converts code to the data that represents it: identifiers become
+// symbols, forms become Forms and literals become their values. Quoting a
+// map or set literal with a key or member that can't be hashed returns an
+// error.
+func Quote(exp ast.Expression) object.Object {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		switch exp.Value {
+		case "true":
+			return &consts.TrueBool
+		case "false":
+			return &consts.FalseBool
+		case "nil":
+			return &consts.Nil
+		}
+		return &object.Symbol{Name: exp.Value, Token: exp.Token}
+
+	case *ast.ListExpression:
+		elements, err := quoteAll(exp.Expressions)
+		if err != nil {
+			return err
+		}
+		return &object.Form{Elements: elements, Token: exp.Token}
+
+	case *ast.ListLiteral:
+		elements, err := quoteAll(exp.Expressions)
+		if err != nil {
+			return err
+		}
+		return object.NewList(elements)
+
+	case *ast.MapLiteral:
+		keys, err := quoteAll(exp.Keys)
+		if err != nil {
+			return err
+		}
+		values, err := quoteAll(exp.Values)
+		if err != nil {
+			return err
+		}
+		return BuildMap(keys, values)
+
+	case *ast.SetLiteral:
+		elements, err := quoteAll(exp.Expressions)
+		if err != nil {
+			return err
+		}
+		return BuildSet(elements)
+
+	case *ast.IntLiteral:
+		return &object.Integer{Value: exp.Value}
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: exp.Value}
+
+	case *ast.BigIntLiteral:
+		return &object.BigInt{Value: exp.Value}
+
+	case *ast.RatioLiteral:
+		return object.NewRatio(exp.Value)
+
+	case *ast.StringLiteral:
+		return &object.String{Value: exp.Value}
+
+	case *ast.KeywordLiteral:
+		return object.InternKeyword(exp.Value)
+	}
+
+	return nil
+}
+
+func quoteAll(exps []ast.Expression) ([]object.Object, object.Object) {
+	objs := make([]object.Object, len(exps))
+	for i, exp := range exps {
+		objs[i] = Quote(exp)
+		if isError(objs[i]) {
+			return nil, objs[i]
+		}
+	}
+	return objs, nil
+}
+
+// ToAST converts data back to code, the inverse of Quote. Nodes built from
+// values that don't remember where they were read are given tok.
+func ToAST(obj object.Object, tok token.Token) (ast.Expression, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Symbol:
+		if obj.Token.Line == 0 {
+			return &ast.Identifier{Token: withLiteral(tok, obj.Name), Value: obj.Name}, nil
+		}
+		return &ast.Identifier{Token: obj.Token, Value: obj.Name}, nil
+
+	case *object.Boolean, *object.Nil:
+		name := obj.Inspect()
+		return &ast.Identifier{Token: withLiteral(tok, name), Value: name}, nil
+
+	case *object.Form:
+		formTok := obj.Token
+		if formTok.Line == 0 {
+			formTok = withLiteral(tok, "(")
+		}
+		exps, err := toASTs(obj.Elements, formTok)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ListExpression{Token: formTok, Expressions: exps}, nil
+
+	case *object.List:
+		exps, err := toASTs(obj.Elements(), tok)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.ListLiteral{Token: withLiteral(tok, "["), Expressions: exps}, nil
+
+	case *object.Map:
+		ml := &ast.MapLiteral{Token: withLiteral(tok, "{")}
+		for _, pair := range obj.Pairs() {
+			key, err := ToAST(pair.Key, tok)
+			if err != nil {
+				return nil, err
+			}
+			value, err := ToAST(pair.Value, tok)
+			if err != nil {
+				return nil, err
+			}
+			ml.Keys = append(ml.Keys, key)
+			ml.Values = append(ml.Values, value)
+		}
+		return ml, nil
+
+	case *object.Set:
+		sl := &ast.SetLiteral{Token: withLiteral(tok, "#{")}
+		for _, member := range obj.Members() {
+			exp, err := ToAST(member, tok)
+			if err != nil {
+				return nil, err
+			}
+			sl.Expressions = append(sl.Expressions, exp)
+		}
+		return sl, nil
+
+	case *object.Integer:
+		return &ast.IntLiteral{Token: withLiteral(tok, obj.Inspect()), Value: obj.Value}, nil
+
+	case *object.Float:
+		return &ast.FloatLiteral{Token: withLiteral(tok, obj.Inspect()), Value: obj.Value}, nil
+
+	case *object.BigInt:
+		return &ast.BigIntLiteral{Token: withLiteral(tok, obj.Inspect()), Value: obj.Value}, nil
+
+	case *object.Ratio:
+		return &ast.RatioLiteral{Token: withLiteral(tok, obj.Inspect()), Value: obj.Value}, nil
+
+	case *object.String:
+		return &ast.StringLiteral{Token: withLiteral(tok, obj.Value), Value: obj.Value}, nil
+
+	case *object.Keyword:
+		return &ast.KeywordLiteral{Token: withLiteral(tok, obj.Inspect()), Value: obj.Name}, nil
+	}
+
+	return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("cannot use %s as code", typeName(obj))}
+}
+
+func toASTs(objs []object.Object, tok token.Token) ([]ast.Expression, *object.Error) {
+	exps := make([]ast.Expression, len(objs))
+	for i, obj := range objs {
+		exp, err := ToAST(obj, tok)
+		if err != nil {
+			return nil, err
+		}
+		exps[i] = exp
+	}
+	return exps, nil
+}
+
+func withLiteral(tok token.Token, literal string) token.Token {
+	tok.Literal = literal
+	return tok
+}
+
+// quasiquote rewrites the template of a quasiquote form into code that
+// builds it, quoting everything but the unquoted parts. `(a ~b ~@c)
+// becomes (concat (list (quote a)) (list b) c).
+func quasiquote(exp ast.Expression, tok token.Token) (ast.Expression, *object.Error) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return call(tok, "quote", exp), nil
+
+	case *ast.ListExpression:
+		switch formName(exp) {
+		case "unquote":
+			if len(exp.Expressions) != 2 {
+				return nil, syntaxError(exp.Token, "wrong number of arguments to unquote, got %d, expected 1", len(exp.Expressions)-1)
+			}
+			return exp.Expressions[1], nil
+		case "unquote-splicing":
+			return nil, syntaxError(exp.Token, "unquote-splicing used outside of a list")
+		}
+		return quasiquoteElements(exp.Expressions, exp.Token, "list")
+
+	case *ast.ListLiteral:
+		return quasiquoteElements(exp.Expressions, exp.Token, "vec")
+
+	case *ast.MapLiteral:
+		ml := &ast.MapLiteral{Token: exp.Token}
+		for i := range exp.Keys {
+			key, err := quasiquote(exp.Keys[i], tok)
+			if err != nil {
+				return nil, err
+			}
+			value, err := quasiquote(exp.Values[i], tok)
+			if err != nil {
+				return nil, err
+			}
+			ml.Keys = append(ml.Keys, key)
+			ml.Values = append(ml.Values, value)
+		}
+		return ml, nil
+
+	case *ast.SetLiteral:
+		sl := &ast.SetLiteral{Token: exp.Token}
+		for _, elem := range exp.Expressions {
+			item, err := quasiquote(elem, tok)
+			if err != nil {
+				return nil, err
+			}
+			sl.Expressions = append(sl.Expressions, item)
+		}
+		return sl, nil
+	}
+
+	return exp, nil
+}
+
+// quasiquoteElements builds a Form, or a List with build set to "vec",
+// from the quasiquoted elements of a template
+func quasiquoteElements(elements []ast.Expression, tok token.Token, build string) (ast.Expression, *object.Error) {
+	spliced := false
+	parts := []ast.Expression{}
+	items := []ast.Expression{}
+
+	for _, elem := range elements {
+		if le, ok := elem.(*ast.ListExpression); ok && formName(le) == "unquote-splicing" {
+			if len(le.Expressions) != 2 {
+				return nil, syntaxError(le.Token, "wrong number of arguments to unquote-splicing, got %d, expected 1", len(le.Expressions)-1)
+			}
+			spliced = true
+			parts = append(parts, le.Expressions[1])
+			continue
+		}
+
+		item, err := quasiquote(elem, tok)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		parts = append(parts, call(tok, "list", item))
+	}
+
+	if !spliced {
+		if build == "vec" {
+			return &ast.ListLiteral{Token: withLiteral(tok, "["), Expressions: items}, nil
+		}
+		return call(tok, "list", items...), nil
+	}
+
+	concat := call(tok, "concat", parts...)
+	if build == "vec" {
+		return call(tok, "vec", concat), nil
+	}
+	return concat, nil
+}
+
+// call builds the form (name args...)
+func call(tok token.Token, name string, args ...ast.Expression) *ast.ListExpression {
+	exps := []ast.Expression{&ast.Identifier{Token: withLiteral(tok, name), Value: name}}
+	return &ast.ListExpression{Token: withLiteral(tok, "("), Expressions: append(exps, args...)}
+}
+
+// formName returns the name at the head of le, if it is an identifier
+func formName(le *ast.ListExpression) string {
+	if len(le.Expressions) == 0 {
+		return ""
+	}
+	if ident, ok := le.Expressions[0].(*ast.Identifier); ok {
+		return ident.Value
+	}
+	return ""
+}
+
+func syntaxError(tok token.Token, format string, a ...interface{}) *object.Error {
+	err := &object.Error{Kind: object.SYNTAX_ERROR, Message: fmt.Sprintf(format, a...)}
+	err.Locate(tok)
+	return err
+}
@@ -0,0 +1,210 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/object"
+)
+
+// noTarget is the arity passed to checkRecur outside any loop or function
+const noTarget = -1
+
+// checkRecur reports a recur in exp that isn't in tail position of the
+// innermost loop or function around it, or that passes it the wrong number
+// of values. arity is the number of values that loop or function takes,
+// and tail whether exp is in its tail position. Malformed forms are left
+// for the back ends to report.
+func checkRecur(exp ast.Expression, arity int, tail bool) *object.Error {
+	switch exp := exp.(type) {
+	case *ast.ListLiteral:
+		return checkRecurAll(exp.Expressions, arity)
+	case *ast.MapLiteral:
+		if err := checkRecurAll(exp.Keys, arity); err != nil {
+			return err
+		}
+		return checkRecurAll(exp.Values, arity)
+	case *ast.SetLiteral:
+		return checkRecurAll(exp.Expressions, arity)
+	case *ast.ListExpression:
+		return checkRecurForm(exp, arity, tail)
+	}
+	return nil
+}
+
+func checkRecurForm(le *ast.ListExpression, arity int, tail bool) *object.Error {
+	exps := le.Expressions
+
+	switch formName(le) {
+	case "quote":
+		return nil
+
+	case "recur":
+		switch {
+		case arity == noTarget:
+			return syntaxError(le.Token, "recur used outside of loop or function")
+		case !tail:
+			return syntaxError(le.Token, "recur must be in tail position")
+		case len(exps)-1 != arity:
+			err := arityError("recur", len(exps)-1, fmt.Sprint(arity))
+			err.Locate(le.Token)
+			return err
+		}
+		return checkRecurAll(exps[1:], arity)
+
+	case "\\":
+		if len(exps) >= 2 {
+			return checkRecurFunction(exps[1:])
+		}
+
+	case "defn":
+		if len(exps) >= 3 {
+			return checkRecurFunction(exps[2:])
+		}
+
+	case "letfn":
+		form, err := ParseLetfn(le)
+		if err != nil {
+			break
+		}
+		for _, arities := range form.Arities {
+			if err := checkRecurArities(arities); err != nil {
+				return err
+			}
+		}
+		return checkRecurBody(form.Body, arity, tail)
+
+	case "let", "loop":
+		form, err := ParseBindings(le)
+		if err != nil {
+			break
+		}
+		if err := checkRecurAll(form.Values, arity); err != nil {
+			return err
+		}
+		if formName(le) == "loop" {
+			return checkRecurBody(form.Body, len(form.Patterns), true)
+		}
+		return checkRecurBody(form.Body, arity, tail)
+
+	case "if":
+		if len(exps) != 4 {
+			break
+		}
+		if err := checkRecur(exps[1], arity, false); err != nil {
+			return err
+		}
+		return checkRecurAllTail(exps[2:], arity, tail)
+
+	case "do", "and", "or":
+		return checkRecurBody(exps[1:], arity, tail)
+
+	case "when", "unless":
+		if len(exps) < 2 {
+			break
+		}
+		if err := checkRecur(exps[1], arity, false); err != nil {
+			return err
+		}
+		return checkRecurBody(exps[2:], arity, tail)
+
+	case "cond":
+		if CheckCond(le) != nil {
+			break
+		}
+		for i := 1; i < len(exps); i += 2 {
+			if err := checkRecur(exps[i], arity, false); err != nil {
+				return err
+			}
+			if err := checkRecur(exps[i+1], arity, tail); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "case":
+		form, err := ParseCase(le)
+		if err != nil {
+			break
+		}
+		if err := checkRecur(form.Expr, arity, false); err != nil {
+			return err
+		}
+		for _, c := range form.Clauses {
+			if err := checkRecur(c.Result, arity, tail); err != nil {
+				return err
+			}
+		}
+		if form.Default != nil {
+			return checkRecur(form.Default, arity, tail)
+		}
+		return nil
+
+	case "match":
+		form, err := ParseMatch(le)
+		if err != nil {
+			break
+		}
+		if err := checkRecur(form.Expr, arity, false); err != nil {
+			return err
+		}
+		for _, c := range form.Clauses {
+			if c.Guard != nil {
+				if err := checkRecur(c.Guard, arity, false); err != nil {
+					return err
+				}
+			}
+			if err := checkRecur(c.Result, arity, tail); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return checkRecurAll(exps, arity)
+}
+
+// checkRecurFunction checks the body of each arity of a function, where
+// recur takes a value for each of the arity's parameter slots, a rest
+// parameter taking a list
+func checkRecurFunction(exps []ast.Expression) *object.Error {
+	arities, err := ParseArities(exps, "", "")
+	if err != nil {
+		return nil
+	}
+	return checkRecurArities(arities)
+}
+
+func checkRecurArities(arities []*Arity) *object.Error {
+	for _, a := range arities {
+		if err := checkRecurBody(a.Body, a.Params.Signature.Len(), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRecurAll checks exps, none of which is in tail position
+func checkRecurAll(exps []ast.Expression, arity int) *object.Error {
+	return checkRecurAllTail(exps, arity, false)
+}
+
+func checkRecurAllTail(exps []ast.Expression, arity int, tail bool) *object.Error {
+	for _, exp := range exps {
+		if err := checkRecur(exp, arity, tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRecurBody checks a sequence of expressions whose last is in tail
+// position if the sequence is
+func checkRecurBody(body []ast.Expression, arity int, tail bool) *object.Error {
+	if len(body) == 0 {
+		return nil
+	}
+	if err := checkRecurAll(body[:len(body)-1], arity); err != nil {
+		return err
+	}
+	return checkRecur(body[len(body)-1], arity, tail)
+}
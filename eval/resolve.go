@@ -0,0 +1,504 @@
+package eval
+
+import (
+	"lo/ast"
+	"lo/object"
+)
+
+// scope numbers the locals of one function call or block, mirroring the
+// Environment the tree-walker makes for it
+type scope struct {
+	slots map[string]int
+	size  int
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{slots: map[string]int{}, outer: outer}
+}
+
+// resolver works out where the binding of each identifier in a program
+// lives: in a slot of a scope some number of scopes out, in the global
+// environment, or among the builtins. Malformed forms are left for the
+// back ends to report.
+type resolver struct {
+	scope *scope
+
+	// defined are the globals the program defines, and free the
+	// references to globals
+	defined map[string]bool
+	free    []*ast.Identifier
+
+	// isMacro reports whether a name is a macro, whose calls are skipped,
+	// if the program being resolved hasn't been expanded
+	isMacro func(name string) bool
+}
+
+// Resolve annotates the identifiers of a program that ExpandMacros has
+// expanded with where their bindings live, returning the references to
+// globals the program doesn't define itself. Eval relies on the
+// annotations, so ExpandMacros resolves every program it returns.
+func Resolve(program *ast.Program) []*ast.Identifier {
+	r := &resolver{defined: map[string]bool{}}
+	r.resolveAll(program.Expressions)
+
+	free := []*ast.Identifier{}
+	for _, ident := range r.free {
+		if !r.defined[ident.Value] {
+			free = append(free, ident)
+		}
+	}
+	return free
+}
+
+// CheckNames reports the first identifier in program, before it runs,
+// that is bound neither by the program, in env, nor among names. RunForms
+// runs each top-level form as a program of its own, so names are those
+// defined at the top level of the whole program, found by DefinedNames.
+// A global defined by the expansion of a later macro call isn't among
+// them.
+func CheckNames(program *ast.Program, env *object.Environment, names []string) *object.Error {
+	defined := map[string]bool{}
+	for _, name := range names {
+		defined[name] = true
+	}
+
+	for _, ident := range Resolve(program) {
+		if _, ok := env.Get(ident.Value); !ok && !defined[ident.Value] {
+			err := &object.Error{Kind: object.NAME_ERROR, Message: "undefined identifier: " + ident.Value}
+			err.Locate(ident.Token)
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckUnexpandedNames is CheckNames for a program ExpandMacros hasn't
+// expanded, so that a file's names can be checked before any of it runs.
+// The calls to the macros in env or defined at the top level of program
+// are skipped, for CheckNames to check once they're expanded, and any name
+// in one counts as defined, in case the expansion defines it.
+func CheckUnexpandedNames(program *ast.Program, env *object.Environment, names []string) *object.Error {
+	macros := map[string]bool{}
+	for _, exp := range program.Expressions {
+		if le, ok := exp.(*ast.ListExpression); ok && formName(le) == "defmacro" && len(le.Expressions) > 1 {
+			if ident, ok := le.Expressions[1].(*ast.Identifier); ok {
+				macros[ident.Value] = true
+			}
+		}
+	}
+
+	r := &resolver{defined: map[string]bool{}}
+	r.isMacro = func(name string) bool {
+		_, ok := lookupMacro(name, env)
+		return ok || macros[name]
+	}
+	for _, name := range names {
+		r.defined[name] = true
+	}
+	r.resolveAll(program.Expressions)
+
+	for _, ident := range r.free {
+		if _, ok := env.Get(ident.Value); !ok && !r.defined[ident.Value] {
+			err := &object.Error{Kind: object.NAME_ERROR, Message: "undefined identifier: " + ident.Value}
+			err.Locate(ident.Token)
+			return err
+		}
+	}
+	return nil
+}
+
+// skipMacroCall reports whether le is to be left unresolved: a defmacro or
+// quasiquote form, or a call to a macro, when resolving a program before
+// it's expanded. The names in a macro call are taken to be defined.
+func (r *resolver) skipMacroCall(le *ast.ListExpression) bool {
+	if r.isMacro == nil {
+		return false
+	}
+	name := formName(le)
+	for s := r.scope; s != nil; s = s.outer {
+		if _, ok := s.slots[name]; ok {
+			return false
+		}
+	}
+	switch {
+	case name == "defmacro", name == "quasiquote":
+		return true
+	case r.isMacro(name):
+		for _, ident := range identifiers(le.Expressions[1:]) {
+			r.defined[ident.Value] = true
+		}
+		return true
+	}
+	return false
+}
+
+// identifiers returns the identifiers anywhere in exps
+func identifiers(exps []ast.Expression) []*ast.Identifier {
+	idents := []*ast.Identifier{}
+	for _, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.Identifier:
+			idents = append(idents, exp)
+		case *ast.ListExpression:
+			idents = append(idents, identifiers(exp.Expressions)...)
+		case *ast.ListLiteral:
+			idents = append(idents, identifiers(exp.Expressions)...)
+		case *ast.MapLiteral:
+			idents = append(idents, identifiers(exp.Keys)...)
+			idents = append(idents, identifiers(exp.Values)...)
+		case *ast.SetLiteral:
+			idents = append(idents, identifiers(exp.Expressions)...)
+		}
+	}
+	return idents
+}
+
+// resolveMacro resolves the body of a macro, which runs as a function of
+// its parameters
+func resolveMacro(params *Params, body []ast.Expression) {
+	r := &resolver{defined: map[string]bool{}}
+	r.resolveArity(params, body)
+}
+
+func (r *resolver) resolve(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		r.reference(exp)
+	case *ast.ListLiteral:
+		r.resolveAll(exp.Expressions)
+	case *ast.MapLiteral:
+		r.resolveAll(exp.Keys)
+		r.resolveAll(exp.Values)
+	case *ast.SetLiteral:
+		r.resolveAll(exp.Expressions)
+	case *ast.ListExpression:
+		r.resolveForm(exp)
+	}
+}
+
+func (r *resolver) resolveAll(exps []ast.Expression) {
+	for _, exp := range exps {
+		r.resolve(exp)
+	}
+}
+
+func (r *resolver) resolveForm(le *ast.ListExpression) {
+	exps := le.Expressions
+	if r.skipMacroCall(le) {
+		return
+	}
+
+	switch formName(le) {
+	case "quote":
+
+	case "def":
+		if len(exps) != 3 {
+			return
+		}
+		if name, ok := exps[1].(*ast.Identifier); ok {
+			r.resolve(exps[2])
+			r.define(name)
+		}
+
+	case "defn":
+		if len(exps) < 3 {
+			return
+		}
+		name, ok := exps[1].(*ast.Identifier)
+		if !ok {
+			return
+		}
+		if arities, err := ParseArities(exps[2:], "defn", ""); err == nil {
+			r.define(name)
+			r.resolveFunction(arities)
+		}
+
+	case "\\":
+		if len(exps) < 2 {
+			return
+		}
+		if arities, err := ParseArities(exps[1:], "lambda", ""); err == nil {
+			r.resolveFunction(arities)
+		}
+
+	case "set!":
+		if name, err := ParseSet(le); err == nil {
+			r.resolve(exps[2])
+			r.reference(name)
+		}
+
+	case "let", "loop":
+		form, err := ParseBindings(le)
+		if err != nil {
+			return
+		}
+		r.enter(append(append([]ast.Expression{}, form.Values...), form.Body...))
+		for i, pattern := range form.Patterns {
+			r.resolve(form.Values[i])
+			r.bind(pattern)
+		}
+		r.resolveAll(form.Body)
+		r.leave()
+
+	case "letfn":
+		form, err := ParseLetfn(le)
+		if err != nil {
+			return
+		}
+		r.enter(form.Body)
+		for _, name := range form.Names {
+			r.declare(name)
+		}
+		for _, arities := range form.Arities {
+			r.resolveFunction(arities)
+		}
+		r.resolveAll(form.Body)
+		r.leave()
+
+	case "match":
+		form, err := ParseMatch(le)
+		if err != nil {
+			return
+		}
+		r.resolve(form.Expr)
+		for _, clause := range form.Clauses {
+			exps := []ast.Expression{clause.Result}
+			if clause.Guard != nil {
+				exps = append(exps, clause.Guard)
+			}
+			r.enter(exps)
+			r.bind(clause.Pattern)
+			if clause.Guard != nil {
+				r.resolve(clause.Guard)
+			}
+			r.resolve(clause.Result)
+			r.leave()
+		}
+
+	case "case":
+		form, err := ParseCase(le)
+		if err != nil {
+			return
+		}
+		r.resolve(form.Expr)
+		for _, clause := range form.Clauses {
+			r.resolve(clause.Result)
+		}
+		if form.Default != nil {
+			r.resolve(form.Default)
+		}
+
+	case "try":
+		form, err := ParseTry(le)
+		if err != nil {
+			return
+		}
+		r.resolveAll(form.Body)
+		for _, clause := range form.Catches {
+			r.enter(nil)
+			r.define(clause.Name)
+			for _, n := range DefinedNames(clause.Body) {
+				r.defineOnce(n)
+			}
+			r.resolveAll(clause.Body)
+			r.leave()
+		}
+		r.resolveAll(form.Finally)
+
+	case "if", "and", "or", "do", "cond", "when", "unless", "recur", "macroexpand", "macroexpand-1":
+		r.resolveAll(exps[1:])
+
+	default:
+		r.resolveAll(exps)
+	}
+}
+
+// resolveFunction resolves each arity of a function in a scope of its own
+func (r *resolver) resolveFunction(arities []*Arity) {
+	for _, a := range arities {
+		r.resolveArity(a.Params, a.Body)
+	}
+}
+
+// resolveArity resolves a parameter list and body in the order
+// bindParameters binds them: each default can refer to the parameters
+// before it
+func (r *resolver) resolveArity(params *Params, body []ast.Expression) {
+	r.enter(nil)
+	for i, p := range params.Patterns {
+		if params.Defaults[i] != nil {
+			r.resolve(params.Defaults[i])
+		}
+		r.bind(p)
+	}
+	for _, n := range DefinedNames(body) {
+		r.defineOnce(n)
+	}
+	r.resolveAll(body)
+	r.leave()
+}
+
+// enter starts a new scope, with a slot for each name defined in body
+func (r *resolver) enter(body []ast.Expression) {
+	r.scope = newScope(r.scope)
+	for _, n := range DefinedNames(body) {
+		r.defineOnce(n)
+	}
+}
+
+func (r *resolver) leave() {
+	r.scope = r.scope.outer
+}
+
+// bind gives each name p binds a new slot, shadowing any earlier binding
+// of it, then resolves p's :or defaults, which can refer to all of them
+func (r *resolver) bind(p *object.Pattern) {
+	names, defaults := p.Bindings()
+	for _, name := range names {
+		r.declare(name)
+	}
+	for _, def := range defaults {
+		if def != nil {
+			r.resolve(def)
+		}
+	}
+}
+
+// declare gives name a new slot in the current scope
+func (r *resolver) declare(name *ast.Identifier) {
+	r.local(name, 0, r.scope.add(name.Value))
+}
+
+// define resolves the name of a def or defn, which binds it in the current
+// scope, or globally at the top level
+func (r *resolver) define(name *ast.Identifier) {
+	if r.scope == nil {
+		name.Binding = ast.Global
+		r.defined[name.Value] = true
+		return
+	}
+	r.local(name, 0, r.defineOnce(name.Value))
+}
+
+// defineOnce returns the slot of name in the current scope, giving it one
+// if it doesn't have one yet
+func (r *resolver) defineOnce(name string) int {
+	if slot, ok := r.scope.slots[name]; ok {
+		return slot
+	}
+	return r.scope.add(name)
+}
+
+// add gives name the next slot, shadowing any it had
+func (s *scope) add(name string) int {
+	s.slots[name] = s.size
+	s.size++
+	return s.slots[name]
+}
+
+// reference resolves an identifier being evaluated. Like the back ends,
+// it prefers true and false and nil to any binding, and a local to a
+// builtin of the same name, which is preferred to a global.
+func (r *resolver) reference(ident *ast.Identifier) {
+	ident.Binding = ast.Global
+	switch ident.Value {
+	case "true", "false", "nil":
+		return
+	}
+
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if slot, ok := s.slots[ident.Value]; ok {
+			r.local(ident, depth, slot)
+			return
+		}
+		depth++
+	}
+
+	if i, ok := LookupBuiltin(ident.Value); ok {
+		ident.Binding = ast.Builtin
+		ident.Slot = i
+		return
+	}
+	r.free = append(r.free, ident)
+}
+
+func (r *resolver) local(ident *ast.Identifier, depth, slot int) {
+	ident.Binding = ast.Local
+	ident.Depth = depth
+	ident.Slot = slot
+}
+
+// DefinedNames collects the names bound by def and defn forms in body,
+// without descending into the bodies of nested functions or blocks, which
+// have scopes of their own
+func DefinedNames(body []ast.Expression) []string {
+	names := []string{}
+
+	var walk func(exp ast.Expression)
+	walk = func(exp ast.Expression) {
+		switch exp := exp.(type) {
+		case *ast.ListLiteral:
+			for _, e := range exp.Expressions {
+				walk(e)
+			}
+		case *ast.MapLiteral:
+			for i := range exp.Keys {
+				walk(exp.Keys[i])
+				walk(exp.Values[i])
+			}
+		case *ast.SetLiteral:
+			for _, e := range exp.Expressions {
+				walk(e)
+			}
+		case *ast.ListExpression:
+			if len(exp.Expressions) == 0 {
+				return
+			}
+			if ident, ok := exp.Expressions[0].(*ast.Identifier); ok {
+				switch ident.Value {
+				case "def":
+					if len(exp.Expressions) == 3 {
+						if name, ok := exp.Expressions[1].(*ast.Identifier); ok {
+							names = append(names, name.Value)
+						}
+					}
+				case "defn":
+					if len(exp.Expressions) >= 3 {
+						if name, ok := exp.Expressions[1].(*ast.Identifier); ok {
+							names = append(names, name.Value)
+						}
+					}
+					return
+				case "\\", "catch", "quote", "let", "letfn", "loop", "defmacro":
+					return
+				case "match":
+					if form, err := ParseMatch(exp); err == nil {
+						walk(form.Expr)
+					}
+					return
+				case "case":
+					if form, err := ParseCase(exp); err == nil {
+						walk(form.Expr)
+						for _, clause := range form.Clauses {
+							walk(clause.Result)
+						}
+						if form.Default != nil {
+							walk(form.Default)
+						}
+					}
+					return
+				}
+			}
+			for _, e := range exp.Expressions {
+				walk(e)
+			}
+		}
+	}
+
+	for _, exp := range body {
+		walk(exp)
+	}
+	return names
+}
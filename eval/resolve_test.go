@@ -0,0 +1,267 @@
+package eval_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"lo/ast"
+	"lo/eval"
+	"lo/object"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defn f [a] (let [b a] (\\ [c] (+ a b c))))", `defn f a@0:0 let b@0:0 a@1:0 \ c@0:0 +# a@2:0 b@1:0 c@0:0`},
+		{"(let [x 1 x (+ x 1)] x)", "let x@0:0 x@0:1 +# x@0:0 x@0:1"},
+		{"(let [x 1 x 2 g (\\ [] x) x 3] (g))", `let x@0:0 x@0:1 g@0:2 \ x@1:1 x@0:3 g@0:2`},
+		{"(defn f [] (def g (\\ [] (h))) (def h 1))", `defn f def g@0:0 \ h@1:1 def h@0:1`},
+		{"(defn f [[a b] {c :c}] [a b c])", "defn f a@0:0 b@0:1 c@0:2 a@0:0 b@0:1 c@0:2"},
+		{"(defn f [a (b a)] b)", "defn f a@0:0 b@0:1 a@0:0 b@0:1"},
+		{"(match [1 2] [a b] (+ a b))", "match a@0:0 b@0:1 +# a@0:0 b@0:1"},
+		{"(loop [i 0] (when (< i 3) (recur (+ i 1))))", "loop i@0:0 when <# i@0:0 recur +# i@0:0"},
+		{"(try (foo) (catch e e))", "try foo catch e@0:0 e@0:0"},
+		{"(def x 1) (set! x 2) (let [y 1] (set! y 2))", "def x set! x let y@0:0 set! y@0:0"},
+		{"(quote (a b)) true nil", "quote a b true nil"},
+	}
+
+	for _, tt := range tests {
+		program, err := eval.ExpandMacros(parse(tt.input), object.NewEnvironment())
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err.Inspect())
+		}
+		if got := resolved(program); got != tt.expected {
+			t.Errorf("wrong resolution of %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defn f [] (g)) (defn g [] 1) (f)", ""},
+		{"(defn f [x] (+ x y))", "ERROR: undefined identifier: y\n    at test:1:18"},
+		{"(let [x 1] (def y 2)) y", "ERROR: undefined identifier: y\n    at test:1:23"},
+		{"(println 1) (foo)", "ERROR: undefined identifier: foo\n    at test:1:14"},
+		{"(try (foo) (catch e e))", "ERROR: undefined identifier: foo\n    at test:1:7"},
+		{"(set! x 1)", "ERROR: undefined identifier: x\n    at test:1:7"},
+		{"(match [1 2] [a b] (+ a b)) (quote c) :d", ""},
+		{"(defmacro m [] 'q) (m)", "ERROR: undefined identifier: q\n    at test:1:17"},
+		{"global", ""},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("global", &object.Integer{Value: 1})
+
+		program, err := eval.ExpandMacros(parse(tt.input), env)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err.Inspect())
+		}
+		got := ""
+		if err := eval.CheckNames(program, env, nil); err != nil {
+			got = inspect(err)
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+
+	// RunForms checks each form on its own, against the names the whole
+	// program defines
+	whole := parse("(defn f [] (g)) (defn g [] (h))")
+	names := eval.DefinedNames(whole.Expressions)
+	for i, want := range []string{"", "ERROR: undefined identifier: h\n    at test:1:29"} {
+		form, err := eval.ExpandMacros(&ast.Program{Expressions: whole.Expressions[i : i+1]}, object.NewEnvironment())
+		if err != nil {
+			t.Fatal(err.Inspect())
+		}
+		got := ""
+		if err := eval.CheckNames(form, object.NewEnvironment(), names); err != nil {
+			got = inspect(err)
+		}
+		if got != want {
+			t.Errorf("wrong result for form %d. got=%q, want=%q", i, got, want)
+		}
+	}
+}
+
+func TestCheckUnexpandedNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(defn f [] (g)) (defn g [] 1) (f)", ""},
+		{"(emit 1) (foo)", "ERROR: undefined identifier: foo\n    at test:1:11"},
+		{"(defmacro defx [n] `(def ~n 1)) (defx foo) foo", ""},
+		{"(defmacro m [x] `(foo ~x)) (m bar)", ""},
+		{"(defmacro m [] `(emit ~bar)) (m) (foo)", "ERROR: undefined identifier: foo\n    at test:1:35"},
+		{"(defmacro m [] 1) (let [m emit] (m foo))", "ERROR: undefined identifier: foo\n    at test:1:36"},
+		{"(emit `(a ~b))", ""},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("emit", &object.Integer{Value: 1})
+
+		program := parse(tt.input)
+		got := ""
+		if err := eval.CheckUnexpandedNames(program, env, eval.DefinedNames(program.Expressions)); err != nil {
+			got = inspect(err)
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestCheckNamesBeforeRunning checks a program the way lo file.lo does, so
+// an undefined name in its last form stops the earlier ones running
+func TestCheckNamesBeforeRunning(t *testing.T) {
+	var out []string
+	env := object.NewEnvironment()
+	env.Set("emit", &object.Builtin{Name: "emit", Fn: func(args ...object.Object) object.Object {
+		out = append(out, args[0].Inspect())
+		return args[0]
+	}})
+
+	program := parse("(emit 1) (defmacro m [] '(emit 2)) (m) (defn f [] (emit 3)) (f) (undefined)")
+	names := eval.DefinedNames(program.Expressions)
+	var result object.Object
+	if err := eval.CheckUnexpandedNames(program, env, names); err != nil {
+		result = err
+	} else {
+		result = eval.RunForms(program, env, func(form *ast.Program) object.Object {
+			return eval.Eval(form, env)
+		})
+	}
+
+	if inspect(result) != "ERROR: undefined identifier: undefined\n    at test:1:66" {
+		t.Errorf("wrong result. got=%q", inspect(result))
+	}
+	if len(out) != 0 {
+		t.Errorf("forms ran before the check failed, printing %v", out)
+	}
+}
+
+// resolved lists the identifiers of program in order, each marked with
+// where it was resolved to
+func resolved(program *ast.Program) string {
+	var out []string
+
+	var walk func(exps []ast.Expression)
+	walk = func(exps []ast.Expression) {
+		for _, exp := range exps {
+			switch exp := exp.(type) {
+			case *ast.Identifier:
+				switch exp.Binding {
+				case ast.Local:
+					out = append(out, fmt.Sprintf("%s@%d:%d", exp.Value, exp.Depth, exp.Slot))
+				case ast.Builtin:
+					out = append(out, exp.Value+"#")
+				default:
+					out = append(out, exp.Value)
+				}
+			case *ast.ListExpression:
+				walk(exp.Expressions)
+			case *ast.ListLiteral:
+				walk(exp.Expressions)
+			case *ast.MapLiteral:
+				for i := range exp.Keys {
+					walk([]ast.Expression{exp.Values[i], exp.Keys[i]})
+				}
+			}
+		}
+	}
+	walk(program.Expressions)
+
+	return strings.Join(out, " ")
+}
+
+const fib = `
+(defn fib [n]
+  (if (< n 2)
+    n
+    (+ (fib (- n 1)) (fib (- n 2)))))
+(fib 20)`
+
+// BenchmarkFib measures function calls and local lookups on the
+// tree-walker
+func BenchmarkFib(b *testing.B) {
+	env := object.NewEnvironment()
+	program, err := eval.ExpandMacros(parse(fib), env)
+	if err != nil {
+		b.Fatal(err.Inspect())
+	}
+
+	for b.Loop() {
+		result := eval.Eval(program, env)
+		if result.Inspect() != "6765" {
+			b.Fatalf("wrong result, got %s", result.Inspect())
+		}
+	}
+}
+
+// nameEnvironment is the environment the tree-walker used before the
+// resolver: a map of names for each scope, searched outward by name
+type nameEnvironment struct {
+	store map[string]object.Object
+	outer *nameEnvironment
+}
+
+func (e *nameEnvironment) get(name string) (object.Object, bool) {
+	for ; e != nil; e = e.outer {
+		if obj, ok := e.store[name]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// BenchmarkLookup compares finding a local two scopes out by name, as the
+// tree-walker did before the resolver, with finding it by slot, as it
+// does now. BenchmarkFib shows what that's worth across a whole program.
+func BenchmarkLookup(b *testing.B) {
+	val := &object.Integer{Value: 1}
+
+	b.Run("names", func(b *testing.B) {
+		env := &nameEnvironment{store: map[string]object.Object{"fib": val}}
+		for _, names := range [][]string{{"n", "acc"}, {"x", "y", "z"}} {
+			env = &nameEnvironment{store: map[string]object.Object{}, outer: env}
+			for _, name := range names {
+				env.store[name] = val
+			}
+		}
+		env = &nameEnvironment{store: map[string]object.Object{"i": val}, outer: env}
+
+		for b.Loop() {
+			if _, ok := env.get("acc"); !ok {
+				b.Fatal("acc not found")
+			}
+		}
+	})
+
+	b.Run("slots", func(b *testing.B) {
+		env := object.NewEnvironment()
+		env.Set("fib", val)
+		for _, size := range []int{2, 3} {
+			env = object.NewEnclosedEnvironment(env)
+			for slot := range size {
+				env.SetLocal(0, slot, val)
+			}
+		}
+		env = object.NewEnclosedEnvironment(env)
+		env.SetLocal(0, 0, val)
+
+		for b.Loop() {
+			if _, ok := env.GetLocal(2, 1); !ok {
+				b.Fatal("acc not found")
+			}
+		}
+	})
+}
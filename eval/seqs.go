@@ -0,0 +1,805 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"lo/consts"
+	"lo/object"
+)
+
+// The sequence builtins work on any object.Iterable. Those that build a
+// new sequence return a List, apart from list, concat and cons, which
+// build Forms for macros, and those that return a LazySeq when given one,
+// so they can work on unbounded sequences.
+
+// iterator returns an Iterator over a sequence argument
+func iterator(name string, arg object.Object) (object.Iterator, object.Object) {
+	seq, ok := arg.(object.Iterable)
+	if !ok {
+		return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("argument to %s must be a sequence, got %s", name, typeName(arg))}
+	}
+	return seq.Iterator(), nil
+}
+
+// elements returns the elements of a sequence argument, realizing all of
+// a lazy sequence
+func elements(name string, arg object.Object) ([]object.Object, object.Object) {
+	switch arg := arg.(type) {
+	case *object.Form:
+		return arg.Elements, nil
+	case *object.List:
+		return arg.Elements(), nil
+	}
+
+	it, err := iterator(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	elems := []object.Object{}
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		if isError(elem) {
+			return nil, elem
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+// isLazy reports whether any of args is a LazySeq
+func isLazy(args ...object.Object) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*object.LazySeq); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// indexArg returns an argument that must be an integer, such as a count
+// or an index. A BigInt is out of range for any of them.
+func indexArg(name string, arg object.Object) (int, object.Object) {
+	if _, ok := arg.(*object.BigInt); ok {
+		return 0, &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("index %s out of range for %s", arg.Inspect(), name)}
+	}
+	i, ok := arg.(*object.Integer)
+	if !ok {
+		return 0, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("index argument to %s must be an INTEGER, got %s", name, typeName(arg))}
+	}
+	return int(i.Value), nil
+}
+
+func newList(elems []object.Object) *object.List {
+	return object.NewList(elems)
+}
+
+// list builds a Form from its arguments, for macros to return as code
+func list(args ...object.Object) object.Object {
+	return &object.Form{Elements: append([]object.Object{}, args...)}
+}
+
+// concat joins the elements of its arguments into one Form, or into a
+// LazySeq if any of them is one
+func concat(args ...object.Object) object.Object {
+	if isLazy(args...) {
+		return lazyConcat(args)
+	}
+
+	result := []object.Object{}
+	for _, arg := range args {
+		elems, err := elements("concat", arg)
+		if err != nil {
+			return err
+		}
+		result = append(result, elems...)
+	}
+	return &object.Form{Elements: result}
+}
+
+// vec returns the elements of a sequence as a List
+func vec(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("vec", len(args), "1")
+	}
+
+	elems, err := elements("vec", args[0])
+	if err != nil {
+		return err
+	}
+	return newList(append([]object.Object{}, elems...))
+}
+
+// first returns the first element of a sequence, or nil if it's empty
+func first(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("first", len(args), "1")
+	}
+
+	it, err := iterator("first", args[0])
+	if err != nil {
+		return err
+	}
+	if elem := it.Next(); elem != nil {
+		return elem
+	}
+	return &consts.Nil
+}
+
+// rest returns all but the first element of a sequence
+func rest(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("rest", len(args), "1")
+	}
+
+	if seq, ok := args[0].(*object.LazySeq); ok {
+		first, rest := seq.Realize()
+		switch {
+		case isError(first):
+			return first
+		case rest == nil:
+			return newList([]object.Object{})
+		}
+		return rest
+	}
+	if l, ok := args[0].(*object.List); ok {
+		return l.Drop(min(1, l.Len()))
+	}
+
+	elems, err := elements("rest", args[0])
+	if err != nil {
+		return err
+	}
+	if len(elems) == 0 {
+		return newList([]object.Object{})
+	}
+	return newList(append([]object.Object{}, elems[1:]...))
+}
+
+// cons prepends an element to a sequence, giving a Form if the sequence
+// is one, so macros can build code with it, and a LazySeq if it is one
+func cons(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("cons", len(args), "2")
+	}
+
+	if seq, ok := args[1].(*object.LazySeq); ok {
+		return lazyCons(args[0], seq)
+	}
+
+	elems, err := elements("cons", args[1])
+	if err != nil {
+		return err
+	}
+	result := append([]object.Object{args[0]}, elems...)
+	if _, ok := args[1].(*object.Form); ok {
+		return &object.Form{Elements: result}
+	}
+	return newList(result)
+}
+
+// conj adds elements to a collection where they go most naturally: at the
+// end of a List or nil, at the front of a Form or LazySeq, as members of a
+// Set, and as entries of a Map, each of which must be a [key value] List
+func conj(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("conj", len(args), "at least 1")
+	}
+
+	switch coll := args[0].(type) {
+	case *object.List:
+		t := coll.Transient()
+		for _, arg := range args[1:] {
+			t.Conj(arg)
+		}
+		return t.Persistent()
+	case *object.Nil:
+		return newList(append([]object.Object{}, args[1:]...))
+	case *object.Form:
+		result := make([]object.Object, 0, len(coll.Elements)+len(args)-1)
+		for i := len(args) - 1; i > 0; i-- {
+			result = append(result, args[i])
+		}
+		return &object.Form{Elements: append(result, coll.Elements...)}
+	case *object.LazySeq:
+		for _, arg := range args[1:] {
+			coll = lazyCons(arg, coll)
+		}
+		return coll
+	case *object.Map:
+		result := coll.Transient()
+		for _, arg := range args[1:] {
+			entry, ok := arg.(*object.List)
+			if !ok || entry.Len() != 2 {
+				return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("conj onto a MAP takes [key value] entries, got %s", arg.Inspect())}
+			}
+			key, err := hashKey(entry.Nth(0))
+			if err != nil {
+				return err
+			}
+			result.Assoc(key, entry.Nth(1))
+		}
+		return result.Persistent()
+	case *object.Set:
+		result := coll.Transient()
+		for _, arg := range args[1:] {
+			member, err := setMember(arg)
+			if err != nil {
+				return err
+			}
+			result.Conj(member)
+		}
+		return result.Persistent()
+	}
+	return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("first argument to conj must be a LIST, FORM, LAZY_SEQ, MAP, SET or NIL, got %s", typeName(args[0]))}
+}
+
+// nth returns the element of a sequence at an index, counting from 0, or
+// a default if there's no such element
+func nth(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("nth", len(args), "2 or 3")
+	}
+
+	it, err := iterator("nth", args[0])
+	if err != nil {
+		return err
+	}
+	i, err := indexArg("nth", args[1])
+	if err != nil {
+		return err
+	}
+	if l, ok := args[0].(*object.List); ok && i >= 0 && i < l.Len() {
+		return l.Nth(i)
+	}
+
+	length := 0
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		if length == i || isError(elem) {
+			return elem
+		}
+		length++
+	}
+	if len(args) == 3 {
+		return args[2]
+	}
+	return &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("index %d out of range for sequence of length %d", i, length)}
+}
+
+func count(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("count", len(args), "1")
+	}
+
+	switch arg := args[0].(type) {
+	case *object.List:
+		return &object.Integer{Value: int64(arg.Len())}
+	case *object.Form:
+		return &object.Integer{Value: int64(len(arg.Elements))}
+	case *object.Map:
+		return &object.Integer{Value: int64(arg.Len())}
+	case *object.Set:
+		return &object.Integer{Value: int64(arg.Len())}
+	case *object.String:
+		return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	}
+
+	it, err := consume("count", args, 0)
+	if err != nil {
+		return err
+	}
+	n := int64(0)
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		if isError(elem) {
+			return elem
+		}
+		n++
+	}
+	return &object.Integer{Value: n}
+}
+
+func isEmpty(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("empty?", len(args), "1")
+	}
+
+	it, err := iterator("empty?", args[0])
+	if err != nil {
+		return err
+	}
+	elem := it.Next()
+	if isError(elem) {
+		return elem
+	}
+	return nativeBool(elem == nil)
+}
+
+func reverse(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("reverse", len(args), "1")
+	}
+
+	elems, err := elements("reverse", args[0])
+	if err != nil {
+		return err
+	}
+	result := make([]object.Object, len(elems))
+	for i, elem := range elems {
+		result[len(elems)-1-i] = elem
+	}
+	return newList(result)
+}
+
+// countAndSeq returns the arguments of take and drop: a count,
+// which is clamped to the length of the sequence, followed by a sequence
+func countAndSeq(name string, args []object.Object) (int, []object.Object, object.Object) {
+	if len(args) != 2 {
+		return 0, nil, arityError(name, len(args), "2")
+	}
+
+	n, err := indexArg(name, args[0])
+	if err != nil {
+		return 0, nil, err
+	}
+	elems, err := elements(name, args[1])
+	if err != nil {
+		return 0, nil, err
+	}
+	return min(max(n, 0), len(elems)), elems, nil
+}
+
+// take returns the first n elements of a sequence, or all of them if
+// there are fewer
+func take(args ...object.Object) object.Object {
+	if len(args) == 2 && isLazy(args[1]) {
+		return lazyTake(args)
+	}
+
+	n, elems, err := countAndSeq("take", args)
+	if err != nil {
+		return err
+	}
+	return newList(append([]object.Object{}, elems[:n]...))
+}
+
+// drop returns all but the first n elements of a sequence
+func drop(args ...object.Object) object.Object {
+	if len(args) == 2 && isLazy(args[1]) {
+		return lazyDrop(args)
+	}
+
+	if len(args) == 2 {
+		if l, ok := args[1].(*object.List); ok {
+			n, err := indexArg("drop", args[0])
+			if err != nil {
+				return err
+			}
+			return l.Drop(min(max(n, 0), l.Len()))
+		}
+	}
+
+	n, elems, err := countAndSeq("drop", args)
+	if err != nil {
+		return err
+	}
+	return newList(append([]object.Object{}, elems[n:]...))
+}
+
+// numberRange returns the numbers from start up to but not including end,
+// going up by step, which can be negative to count down. start defaults
+// to 0 and step to 1.
+func numberRange(args ...object.Object) object.Object {
+	var start, end, step object.Object = &object.Integer{Value: 0}, nil, &object.Integer{Value: 1}
+	switch len(args) {
+	case 1:
+		end = args[0]
+	case 2:
+		start, end = args[0], args[1]
+	case 3:
+		start, end, step = args[0], args[1], args[2]
+	default:
+		return arityError("range", len(args), "1, 2 or 3")
+	}
+
+	for _, arg := range []object.Object{start, end, step} {
+		if rankOf(arg) == notNumber {
+			return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("arguments to range must be numbers, got %s", typeName(arg))}
+		}
+	}
+	direction := compareMixed(step, &object.Integer{Value: 0})
+	if direction == 0 {
+		return &object.Error{Kind: object.TYPE_ERROR, Message: "range step must not be zero"}
+	}
+
+	result := []object.Object{}
+	for n := start; compareMixed(n, end) == -direction; n = addition.apply(n, step) {
+		result = append(result, n)
+	}
+	return newList(result)
+}
+
+// mapSeq calls a function on each element of a sequence, or on the
+// elements at each index of several, stopping at the end of the shortest
+func mapSeq(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) < 2 {
+		return arityError("map", len(args), "at least 2")
+	}
+	if isLazy(args[1:]...) {
+		return lazyMap(apply, "map", args[0], args[1:])
+	}
+
+	rows, err := zipElements("map", args[1:])
+	if err != nil {
+		return err
+	}
+	result := make([]object.Object, len(rows))
+	for i, row := range rows {
+		result[i] = apply(args[0], row...)
+		if isError(result[i]) {
+			return result[i]
+		}
+	}
+	return newList(result)
+}
+
+// zipElements returns the elements at each index of several sequences,
+// up to the length of the shortest
+func zipElements(name string, seqs []object.Object) ([][]object.Object, object.Object) {
+	cols := make([][]object.Object, len(seqs))
+	length := -1
+	for i, seq := range seqs {
+		elems, err := elements(name, seq)
+		if err != nil {
+			return nil, err
+		}
+		cols[i] = elems
+		if length == -1 || len(elems) < length {
+			length = len(elems)
+		}
+	}
+
+	rows := make([][]object.Object, max(length, 0))
+	for i := range rows {
+		rows[i] = make([]object.Object, len(cols))
+		for j, col := range cols {
+			rows[i][j] = col[i]
+		}
+	}
+	return rows, nil
+}
+
+// zip returns a List of the elements at each index of its arguments, up
+// to the length of the shortest
+func zip(args ...object.Object) object.Object {
+	if isLazy(args...) {
+		return lazyMap(nil, "zip", nil, args)
+	}
+
+	rows, err := zipElements("zip", args)
+	if err != nil {
+		return err
+	}
+	result := make([]object.Object, len(rows))
+	for i, row := range rows {
+		result[i] = newList(row)
+	}
+	return newList(result)
+}
+
+// fnAndSeq returns the arguments of the builtins that take a function
+// followed by a sequence
+func fnAndSeq(name string, args []object.Object) (object.Object, []object.Object, object.Object) {
+	if len(args) != 2 {
+		return nil, nil, arityError(name, len(args), "2")
+	}
+
+	elems, err := elements(name, args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return args[0], elems, nil
+}
+
+// filter returns the elements of a sequence a predicate is truthy for
+func filter(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) == 2 && isLazy(args[1]) {
+		return lazyFilter(apply, args[0], args[1].(*object.LazySeq))
+	}
+
+	pred, elems, err := fnAndSeq("filter", args)
+	if err != nil {
+		return err
+	}
+
+	result := []object.Object{}
+	for _, elem := range elems {
+		keep := apply(pred, elem)
+		if isError(keep) {
+			return keep
+		}
+		if object.IsTruthy(keep) {
+			result = append(result, elem)
+		}
+	}
+	return newList(result)
+}
+
+// consume returns an Iterator over the sequence argument args[i] and
+// drops args' reference to it, so that stepping through a lazy sequence
+// nothing else holds onto takes constant memory
+func consume(name string, args []object.Object, i int) (object.Iterator, object.Object) {
+	it, err := iterator(name, args[i])
+	args[i] = nil
+	return it, err
+}
+
+// reduce combines the elements of a sequence with a function of two
+// arguments, from left to right, starting from an initial value if there
+// is one or else the first element. Reducing an empty sequence without an
+// initial value calls the function with no arguments.
+func reduce(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("reduce", len(args), "2 or 3")
+	}
+
+	f := args[0]
+	it, err := consume("reduce", args, len(args)-1)
+	if err != nil {
+		return err
+	}
+
+	var acc object.Object
+	if len(args) == 3 {
+		acc = args[1]
+	} else {
+		acc = it.Next()
+		switch {
+		case acc == nil:
+			return apply(f)
+		case isError(acc):
+			return acc
+		}
+	}
+
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		if isError(elem) {
+			return elem
+		}
+		acc = apply(f, acc, elem)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// some returns the first truthy result of a predicate on the elements of
+// a sequence, or nil if there isn't one
+func some(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("some", len(args), "2")
+	}
+
+	pred := args[0]
+	it, err := consume("some", args, 1)
+	if err != nil {
+		return err
+	}
+
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		if isError(elem) {
+			return elem
+		}
+		result := apply(pred, elem)
+		if isError(result) || object.IsTruthy(result) {
+			return result
+		}
+	}
+	return &consts.Nil
+}
+
+// every reports whether a predicate is truthy for every element of a
+// sequence
+func every(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("every?", len(args), "2")
+	}
+
+	pred := args[0]
+	it, err := consume("every?", args, 1)
+	if err != nil {
+		return err
+	}
+
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		if isError(elem) {
+			return elem
+		}
+		result := apply(pred, elem)
+		if isError(result) {
+			return result
+		}
+		if !object.IsTruthy(result) {
+			return nativeBool(false)
+		}
+	}
+	return nativeBool(true)
+}
+
+// sortElements sorts elems stably by their keys, with cmp if it isn't
+// nil or else in the order of <. cmp can return a number, which is
+// negative, zero or positive as a is less than, equal to or greater than
+// b, or a boolean saying whether a is less than b.
+func sortElements(apply object.Applier, name string, elems, keys []object.Object, cmp object.Object) object.Object {
+	var failure object.Object
+	less := func(a, b object.Object) bool {
+		if failure != nil {
+			return false
+		}
+		if cmp == nil {
+			c, err := compare(name, a, b)
+			failure = err
+			return c < 0
+		}
+
+		result := apply(cmp, a, b)
+		switch {
+		case isError(result):
+			failure = result
+		case rankOf(result) != notNumber:
+			return compareMixed(result, &object.Integer{Value: 0}) < 0
+		}
+		return object.IsTruthy(result)
+	}
+
+	indices := make([]int, len(elems))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return less(keys[indices[i]], keys[indices[j]])
+	})
+	if failure != nil {
+		return failure
+	}
+
+	result := make([]object.Object, len(elems))
+	for i, index := range indices {
+		result[i] = elems[index]
+	}
+	return newList(result)
+}
+
+// sortSeq sorts a sequence, in the order of < or of a comparator, as
+// sortElements describes
+func sortSeq(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return arityError("sort", len(args), "1 or 2")
+	}
+
+	elems, err := elements("sort", args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	var cmp object.Object
+	if len(args) == 2 {
+		cmp = args[0]
+	}
+	return sortElements(apply, "sort", elems, elems, cmp)
+}
+
+// sortBy sorts a sequence by the results of a key function on its
+// elements, in the order of < or of a comparator
+func sortBy(apply object.Applier, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("sort-by", len(args), "2 or 3")
+	}
+
+	elems, err := elements("sort-by", args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	keys := make([]object.Object, len(elems))
+	for i, elem := range elems {
+		keys[i] = apply(args[0], elem)
+		if isError(keys[i]) {
+			return keys[i]
+		}
+	}
+	var cmp object.Object
+	if len(args) == 3 {
+		cmp = args[1]
+	}
+	return sortElements(apply, "sort-by", elems, keys, cmp)
+}
+
+// groupBy returns a map from each result of a function on the elements of
+// a sequence to a List of the elements that gave it, in their order
+func groupBy(apply object.Applier, args ...object.Object) object.Object {
+	f, elems, err := fnAndSeq("group-by", args)
+	if err != nil {
+		return err
+	}
+
+	groups := object.NewMap().Transient()
+	for _, elem := range elems {
+		k := apply(f, elem)
+		if isError(k) {
+			return k
+		}
+		key, err := hashKey(k)
+		if err != nil {
+			return err
+		}
+		group, ok := groups.Get(key)
+		if !ok {
+			group = newList([]object.Object{})
+		}
+		groups.Assoc(key, group.(*object.List).Conj(elem))
+	}
+	return groups.Persistent()
+}
+
+// partition splits a sequence into Lists of n elements, starting every
+// step elements, which defaults to n. A partition too short to fill at
+// the end is left out.
+func partition(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("partition", len(args), "2 or 3")
+	}
+
+	n, err := indexArg("partition", args[0])
+	if err != nil {
+		return err
+	}
+	step := n
+	if len(args) == 3 {
+		step, err = indexArg("partition", args[1])
+		if err != nil {
+			return err
+		}
+	}
+	if n <= 0 || step <= 0 {
+		return &object.Error{Kind: object.TYPE_ERROR, Message: "partition size and step must be positive"}
+	}
+	elems, err := elements("partition", args[len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	result := []object.Object{}
+	for i := 0; i+n <= len(elems); i += step {
+		result = append(result, newList(append([]object.Object{}, elems[i:i+n]...)))
+	}
+	return newList(result)
+}
+
+// flatten returns the elements of a sequence with any Lists and Forms
+// among them replaced by their own elements, flattened in turn
+func flatten(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("flatten", len(args), "1")
+	}
+
+	elems, err := elements("flatten", args[0])
+	if err != nil {
+		return err
+	}
+
+	result := []object.Object{}
+	var walk func(elems []object.Object)
+	walk = func(elems []object.Object) {
+		for _, elem := range elems {
+			switch elem := elem.(type) {
+			case *object.List:
+				walk(elem.Elements())
+			case *object.Form:
+				walk(elem.Elements)
+			default:
+				result = append(result, elem)
+			}
+		}
+	}
+	walk(elems)
+	return newList(result)
+}
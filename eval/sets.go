@@ -0,0 +1,204 @@
+package eval
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/object"
+)
+
+// BuildSet builds a set of elems, as written in a set literal. Repeated
+// elements are kept once.
+func BuildSet(elems []object.Object) object.Object {
+	s := object.NewSet().Transient()
+	for _, elem := range elems {
+		member, err := setMember(elem)
+		if err != nil {
+			return err
+		}
+		s.Conj(member)
+	}
+	return s.Persistent()
+}
+
+// setMember checks that elem can be a member of a set, which it can if it
+// can be a map key, realizing any lazy sequences in it first
+func setMember(elem object.Object) (object.Hashable, *object.Error) {
+	if err := Realize(elem); err != nil {
+		return nil, err.(*object.Error)
+	}
+	if !object.IsHashable(elem) {
+		return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("unusable as set member: %s", typeName(elem))}
+	}
+	return elem.(object.Hashable), nil
+}
+
+func evalSetLiteral(sl *ast.SetLiteral, env *object.Environment) object.Object {
+	elems := make([]object.Object, len(sl.Expressions))
+	for i, exp := range sl.Expressions {
+		elems[i] = Eval(exp, env)
+		if isError(elems[i]) {
+			return elems[i]
+		}
+	}
+
+	result := BuildSet(elems)
+	if isError(result) {
+		result.(*object.Error).Locate(sl.Token)
+	}
+	return result
+}
+
+// setArgs checks that all of args are sets
+func setArgs(name string, args []object.Object) ([]*object.Set, object.Object) {
+	sets := make([]*object.Set, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*object.Set)
+		if !ok {
+			return nil, &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("arguments to %s must be SETs, got %s", name, typeName(arg))}
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// set returns a set of the elements of a sequence
+func set(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("set", len(args), "1")
+	}
+
+	elems, err := elements("set", args[0])
+	if err != nil {
+		return err
+	}
+	return BuildSet(elems)
+}
+
+// union returns a set of the members of all its arguments, in the order
+// they first appear
+func union(args ...object.Object) object.Object {
+	sets, err := setArgs("union", args)
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		return object.NewSet()
+	}
+
+	result := sets[0].Transient()
+	for _, s := range sets[1:] {
+		for _, member := range s.Members() {
+			result.Conj(member)
+		}
+	}
+	return result.Persistent()
+}
+
+// intersection returns a set of the members of its first argument that
+// are members of all the others
+func intersection(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("intersection", len(args), "at least 1")
+	}
+	sets, err := setArgs("intersection", args)
+	if err != nil {
+		return err
+	}
+
+	result := object.NewSet().Transient()
+	for _, member := range sets[0].Members() {
+		if inAll(member, sets[1:]) {
+			result.Conj(member)
+		}
+	}
+	return result.Persistent()
+}
+
+// difference returns a set of the members of its first argument that
+// aren't members of any of the others
+func difference(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("difference", len(args), "at least 1")
+	}
+	sets, err := setArgs("difference", args)
+	if err != nil {
+		return err
+	}
+
+	result := sets[0]
+	for _, s := range sets[1:] {
+		for _, member := range s.Members() {
+			result = result.Disj(member)
+		}
+	}
+	return result
+}
+
+func inAll(member object.Hashable, sets []*object.Set) bool {
+	for _, s := range sets {
+		if !s.Contains(member) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubset reports whether every member of its first argument is a member
+// of its second
+func isSubset(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("subset?", len(args), "2")
+	}
+	sets, err := setArgs("subset?", args)
+	if err != nil {
+		return err
+	}
+	return nativeBool(subset(sets[0], sets[1]))
+}
+
+// isSuperset reports whether every member of its second argument is a
+// member of its first
+func isSuperset(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("superset?", len(args), "2")
+	}
+	sets, err := setArgs("superset?", args)
+	if err != nil {
+		return err
+	}
+	return nativeBool(subset(sets[1], sets[0]))
+}
+
+func subset(a, b *object.Set) bool {
+	if a.Len() > b.Len() {
+		return false
+	}
+	for _, member := range a.Members() {
+		if !b.Contains(member) {
+			return false
+		}
+	}
+	return true
+}
+
+// disj returns a set without the given members
+func disj(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return arityError("disj", len(args), "at least 1")
+	}
+	s, ok := args[0].(*object.Set)
+	if !ok {
+		return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("first argument to disj must be a SET, got %s", typeName(args[0]))}
+	}
+
+	for _, arg := range args[1:] {
+		member, ok, err := lookupKey(arg)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s = s.Disj(member)
+		}
+	}
+	return s
+}
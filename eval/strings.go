@@ -0,0 +1,282 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"lo/consts"
+	"lo/object"
+)
+
+// The string builtins count and index by character, a Unicode code point,
+// rather than by byte, and an index out of range is an index-error.
+
+func stringArg(name string, arg object.Object) (string, object.Object) {
+	s, ok := arg.(*object.String)
+	if !ok {
+		return "", &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("argument to %s must be a STRING, got %s", name, typeName(arg))}
+	}
+	return s.Value, nil
+}
+
+// stringArgs checks that all of args are strings
+func stringArgs(name string, args []object.Object) ([]string, object.Object) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, err := stringArg(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func rangeError(name string, i, length int) *object.Error {
+	return &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("index %d out of range for %s on a string of length %d", i, name, length)}
+}
+
+// stringFunction makes a builtin of a function from one string to another
+func stringFunction(name string, f func(string) string) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return arityError(name, len(args), "1")
+		}
+		s, err := stringArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: f(s)}
+	}
+}
+
+// stringPredicate makes a builtin of a test on two strings
+func stringPredicate(name string, f func(s, sub string) bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return arityError(name, len(args), "2")
+		}
+		strs, err := stringArgs(name, args)
+		if err != nil {
+			return err
+		}
+		return nativeBool(f(strs[0], strs[1]))
+	}
+}
+
+// subs returns the characters of a string from start up to but not
+// including end, which defaults to the end of the string
+func subs(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("subs", len(args), "2 or 3")
+	}
+
+	s, err := stringArg("subs", args[0])
+	if err != nil {
+		return err
+	}
+	runes := []rune(s)
+	start, err := indexArg("subs", args[1])
+	if err != nil {
+		return err
+	}
+	end := len(runes)
+	if len(args) == 3 {
+		end, err = indexArg("subs", args[2])
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case start < 0 || start > len(runes):
+		return rangeError("subs", start, len(runes))
+	case end > len(runes):
+		return rangeError("subs", end, len(runes))
+	case end < start:
+		return &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("end index %d is before start index %d", end, start)}
+	}
+	return &object.String{Value: string(runes[start:end])}
+}
+
+// split returns the parts of a string between occurrences of a separator,
+// or its characters if the separator is empty
+func split(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("split", len(args), "2")
+	}
+
+	strs, err := stringArgs("split", args)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(strs[0], strs[1])
+	result := make([]object.Object, len(parts))
+	for i, part := range parts {
+		result[i] = &object.String{Value: part}
+	}
+	return newList(result)
+}
+
+// join concatenates the elements of a sequence, as str would print them,
+// with an optional separator between them
+func join(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return arityError("join", len(args), "1 or 2")
+	}
+
+	sep := ""
+	if len(args) == 2 {
+		var err object.Object
+		sep, err = stringArg("join", args[0])
+		if err != nil {
+			return err
+		}
+	}
+	it, err := consume("join", args, len(args)-1)
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	for i, elem := 0, it.Next(); elem != nil; i, elem = i+1, it.Next() {
+		if isError(elem) {
+			return elem
+		}
+		if i > 0 {
+			out.WriteString(sep)
+		}
+		out.WriteString(elem.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
+// replace returns a string with every occurrence of match replaced
+func replace(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return arityError("replace", len(args), "3")
+	}
+
+	strs, err := stringArgs("replace", args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+}
+
+// indexOf returns the index of the first occurrence of a substring at or
+// after an optional starting index, or nil if there isn't one
+func indexOf(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("index-of", len(args), "2 or 3")
+	}
+
+	strs, err := stringArgs("index-of", args[:2])
+	if err != nil {
+		return err
+	}
+	s, sub := strs[0], strs[1]
+	from := 0
+	if len(args) == 3 {
+		from, err = indexArg("index-of", args[2])
+		if err != nil {
+			return err
+		}
+	}
+
+	length := utf8.RuneCountInString(s)
+	if from < 0 || from > length {
+		return rangeError("index-of", from, length)
+	}
+	offset := byteOffset(s, from)
+	i := strings.Index(s[offset:], sub)
+	if i < 0 {
+		return &consts.Nil
+	}
+	return &object.Integer{Value: int64(from + utf8.RuneCountInString(s[offset:offset+i]))}
+}
+
+// byteOffset returns the offset in bytes of the character at index i
+func byteOffset(s string, i int) int {
+	offset := 0
+	for ; i > 0; i-- {
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// padLeft pads a string on the left to a width, with spaces or with a
+// given character
+func padLeft(args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return arityError("pad-left", len(args), "2 or 3")
+	}
+
+	s, err := stringArg("pad-left", args[0])
+	if err != nil {
+		return err
+	}
+	width, err := indexArg("pad-left", args[1])
+	if err != nil {
+		return err
+	}
+	pad := " "
+	if len(args) == 3 {
+		pad, err = stringArg("pad-left", args[2])
+		if err != nil {
+			return err
+		}
+		if utf8.RuneCountInString(pad) != 1 {
+			return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("padding for pad-left must be a single character, got %q", pad)}
+		}
+	}
+
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return args[0]
+	}
+	if n > math.MaxInt32/len(pad) {
+		return &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("width %d out of range for pad-left", width)}
+	}
+	return &object.String{Value: strings.Repeat(pad, n) + s}
+}
+
+// repeatStr returns a string repeated n times
+func repeatStr(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return arityError("repeat-str", len(args), "2")
+	}
+
+	s, err := stringArg("repeat-str", args[0])
+	if err != nil {
+		return err
+	}
+	n, err := indexArg("repeat-str", args[1])
+	if err != nil {
+		return err
+	}
+	if n < 0 || (len(s) > 0 && n > math.MaxInt32/len(s)) {
+		return &object.Error{Kind: object.INDEX_ERROR, Message: fmt.Sprintf("count %d out of range for repeat-str", n)}
+	}
+	return &object.String{Value: strings.Repeat(s, n)}
+}
+
+// chars returns a List of the characters of a string
+func chars(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return arityError("chars", len(args), "1")
+	}
+
+	s, err := stringArg("chars", args[0])
+	if err != nil {
+		return err
+	}
+	result := make([]object.Object, 0, len(s))
+	for _, r := range s {
+		result = append(result, &object.String{Value: string(r)})
+	}
+	return newList(result)
+}
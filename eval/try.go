@@ -0,0 +1,133 @@
+package eval
+
+import (
+	"lo/ast"
+	"lo/object"
+)
+
+// TryForm is the shape of a (try body... (catch ...)... (finally ...)) form,
+// shared with the compiler so both back ends accept the same syntax
+type TryForm struct {
+	Body    []ast.Expression
+	Catches []CatchClause
+	Finally []ast.Expression
+}
+
+// CatchClause is (catch name body...) or (catch kind name body...), where
+// kind is a string or a keyword: "name-error" and :name-error are the same
+// kind. A clause without a kind catches every error.
+type CatchClause struct {
+	Kind string
+	Name *ast.Identifier
+	Body []ast.Expression
+}
+
+// Matches reports whether the clause handles err
+func (c CatchClause) Matches(err *object.Error) bool {
+	return c.Kind == "" || c.Kind == err.Kind
+}
+
+// ParseTry splits a try form into its body and clauses
+func ParseTry(le *ast.ListExpression) (*TryForm, *object.Error) {
+	form := &TryForm{}
+
+	exps := le.Expressions[1:]
+	for len(exps) > 0 && clauseName(exps[0]) == "" {
+		form.Body = append(form.Body, exps[0])
+		exps = exps[1:]
+	}
+
+	for i, exp := range exps {
+		switch clauseName(exp) {
+		case "catch":
+			c, err := parseCatch(exp.(*ast.ListExpression))
+			if err != nil {
+				return nil, err
+			}
+			form.Catches = append(form.Catches, c)
+		case "finally":
+			if i != len(exps)-1 {
+				return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "finally must be the last clause in try"}
+			}
+			form.Finally = exp.(*ast.ListExpression).Expressions[1:]
+		default:
+			return nil, &object.Error{Kind: object.SYNTAX_ERROR, Message: "only catch and finally clauses may follow them in try"}
+		}
+	}
+
+	return form, nil
+}
+
+func parseCatch(clause *ast.ListExpression) (CatchClause, *object.Error) {
+	c := CatchClause{}
+	rest := clause.Expressions[1:]
+
+	if len(rest) > 0 {
+		switch kind := rest[0].(type) {
+		case *ast.StringLiteral:
+			c.Kind = kind.Value
+			rest = rest[1:]
+		case *ast.KeywordLiteral:
+			c.Kind = kind.Value
+			rest = rest[1:]
+		}
+	}
+
+	if len(rest) == 0 {
+		return c, &object.Error{Kind: object.SYNTAX_ERROR, Message: "catch clause must name the error it binds"}
+	}
+
+	name, ok := rest[0].(*ast.Identifier)
+	if !ok {
+		return c, &object.Error{Kind: object.SYNTAX_ERROR, Message: "catch clause must name the error it binds"}
+	}
+
+	c.Name = name
+	c.Body = rest[1:]
+	return c, nil
+}
+
+// clauseName returns "catch" or "finally" if exp is that kind of clause
+func clauseName(exp ast.Expression) string {
+	le, ok := exp.(*ast.ListExpression)
+	if !ok || len(le.Expressions) == 0 {
+		return ""
+	}
+
+	ident, ok := le.Expressions[0].(*ast.Identifier)
+	if !ok || (ident.Value != "catch" && ident.Value != "finally") {
+		return ""
+	}
+	return ident.Value
+}
+
+func evalTry(le *ast.ListExpression, env *object.Environment) object.Object {
+	form, err := ParseTry(le)
+	if err != nil {
+		return err
+	}
+
+	result := evalSequence(form.Body, env)
+	if isError(result) {
+		thrown := result.(*object.Error)
+		for _, c := range form.Catches {
+			if !c.Matches(thrown) {
+				continue
+			}
+
+			thrown.Caught = true
+			handlerEnv := object.NewEnclosedEnvironment(env)
+			bindName(c.Name, thrown, handlerEnv)
+			result = evalSequence(c.Body, handlerEnv)
+			break
+		}
+	}
+
+	if form.Finally != nil {
+		if cleanup := evalSequence(form.Finally, env); isError(cleanup) {
+			return cleanup
+		}
+	}
+
+	return result
+}
@@ -43,6 +43,23 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.OpenBracket, l, string(l.ch))
 	case ']':
 		tok = newToken(token.CloseBracket, l, string(l.ch))
+	case '{':
+		tok = newToken(token.OpenBrace, l, string(l.ch))
+	case '}':
+		tok = newToken(token.CloseBrace, l, string(l.ch))
+	case '\'':
+		tok = newToken(token.Quote, l, string(l.ch))
+	case '`':
+		tok = newToken(token.Quasiquote, l, string(l.ch))
+	case '~':
+		if l.peekChar() == '@' {
+			tok = newToken(token.UnquoteSplicing, l, "~@")
+			l.readChar()
+		} else {
+			tok = newToken(token.Unquote, l, string(l.ch))
+		}
+	case '@':
+		tok = newToken(token.Deref, l, string(l.ch))
 	case '"':
 		tok.Type = token.String
 		tok.Column = l.column
@@ -51,19 +68,29 @@ func (l *Lexer) NextToken() token.Token {
 		return tok
 	case 0:
 		tok = newToken(token.EOF, l, "")
+	case '#':
+		if l.peekChar() == '{' {
+			tok = newToken(token.OpenSet, l, "#{")
+			l.readChar()
+			break
+		}
+		fallthrough
 	default:
 		peekChar, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
 		if isStartingDigit(l.ch, peekChar) {
 			tok.Column = l.column
 			tok.Line = l.line
 			tok.Type = token.Number
-			value := readDigit(l)
+			value := readIdentifier(l)
 			tok.Literal = value
 			return tok
 		}
 		tok.Column = l.column
 		tok.Line = l.line
 		tok.Type = token.Ident
+		if l.ch == ':' {
+			tok.Type = token.Keyword
+		}
 		value := readIdentifier(l)
 		tok.Literal = value
 		return tok
@@ -96,25 +123,24 @@ func (l *Lexer) readChar() {
 	}
 }
 
-func isDigit(ch rune) bool {
-	return ('0' <= ch && ch <= '9') || ch == '_' || ch == '.'
+func (l *Lexer) peekChar() rune {
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
-func isStartingDigit(ch, next rune) bool {
-	return ('0' <= ch && ch <= '9') || (ch == '-' && isDigit(next))
+func isDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9'
 }
 
-func readDigit(l *Lexer) string {
-	position := l.position
-	for isDigit(l.ch) {
-		l.readChar()
-	}
-	return l.input[position:l.position]
+// isStartingDigit reports whether ch starts a number, which the lexer
+// reads up to the next delimiter and leaves for the parser to check
+func isStartingDigit(ch, next rune) bool {
+	return isDigit(ch) || ((ch == '-' || ch == '+') && isDigit(next))
 }
 
 func readIdentifier(l *Lexer) string {
 	position := l.position
-	for !isWhitespace(l.ch) && l.ch != ')' && l.ch != '(' && l.ch != 0 && l.ch != '[' && l.ch != ']' {
+	for !isWhitespace(l.ch) && l.ch != ')' && l.ch != '(' && l.ch != 0 && l.ch != '[' && l.ch != ']' && l.ch != '{' && l.ch != '}' {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -57,6 +57,118 @@ func TestLexer(t *testing.T) {
 				t.Fatalf("tests[%d] - line wrong. expected=%d, got=%d", i, tt.expectedLine, tok.Line)
 			}
 
+			if tok.Column != tt.expectedColumn {
+				t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+			}
+		}
+	})
+	t.Run("quote test", func(t *testing.T) {
+		input := "'a `(b ~c ~@d @e)"
+		l := New(input, "test")
+
+		tests := []struct {
+			expectedType    token.TokenType
+			expectedLiteral string
+			expectedColumn  int
+		}{
+			{token.Quote, "'", 1},
+			{token.Ident, "a", 2},
+			{token.Quasiquote, "`", 4},
+			{token.OpenParen, "(", 5},
+			{token.Ident, "b", 6},
+			{token.Unquote, "~", 8},
+			{token.Ident, "c", 9},
+			{token.UnquoteSplicing, "~@", 11},
+			{token.Ident, "d", 13},
+			{token.Deref, "@", 15},
+			{token.Ident, "e", 16},
+			{token.CloseParen, ")", 17},
+			{token.EOF, "", 18},
+		}
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+			}
+
+			if tok.Column != tt.expectedColumn {
+				t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+			}
+		}
+	})
+	t.Run("number test", func(t *testing.T) {
+		input := "(- -5 1.5e-9 0xff 1_000 1/3 1.2.3 -x)"
+		l := New(input, "test")
+
+		tests := []struct {
+			expectedType    token.TokenType
+			expectedLiteral string
+			expectedColumn  int
+		}{
+			{token.OpenParen, "(", 1},
+			{token.Ident, "-", 2},
+			{token.Number, "-5", 4},
+			{token.Number, "1.5e-9", 7},
+			{token.Number, "0xff", 14},
+			{token.Number, "1_000", 19},
+			{token.Number, "1/3", 25},
+			{token.Number, "1.2.3", 29},
+			{token.Ident, "-x", 35},
+			{token.CloseParen, ")", 37},
+			{token.EOF, "", 38},
+		}
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+			}
+
+			if tok.Column != tt.expectedColumn {
+				t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
+			}
+		}
+	})
+
+	t.Run("set test", func(t *testing.T) {
+		input := "#{1 #a} #x"
+		l := New(input, "test")
+
+		tests := []struct {
+			expectedType    token.TokenType
+			expectedLiteral string
+			expectedColumn  int
+		}{
+			{token.OpenSet, "#{", 1},
+			{token.Number, "1", 3},
+			{token.Ident, "#a", 5},
+			{token.CloseBrace, "}", 7},
+			{token.Ident, "#x", 9},
+			{token.EOF, "", 11},
+		}
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+			}
+
 			if tok.Column != tt.expectedColumn {
 				t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Column)
 			}
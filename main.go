@@ -8,12 +8,17 @@ import (
 	"os"
 	"strings"
 
+	"lo/ast"
+	"lo/compiler"
 	"lo/eval"
 	"lo/lexer"
 	"lo/object"
 	"lo/parser"
+	"lo/vm"
 )
 
+var engine = flag.String("engine", "vm", "execution engine to use: vm or eval")
+
 func main() {
 	flag.Parse()
 	args := flag.Args()
@@ -30,7 +35,7 @@ func main() {
 
 func runRepl() {
 	scanner := bufio.NewScanner(os.Stdin)
-	env := object.NewEnvironment()
+	session := newSession()
 
 	fmt.Println("lo v0.0.1")
 	fmt.Println("type '.exit' to exit")
@@ -57,8 +62,13 @@ func runRepl() {
 			continue
 		}
 
-		result := eval.Eval(program, env)
-		if result != nil {
+		result := session.run(program)
+		if err := eval.Realize(result); err != nil {
+			result = err
+		}
+		if err, ok := result.(*object.Error); ok && !err.Caught {
+			fmt.Println(err.Traceback())
+		} else {
 			fmt.Println(result.Inspect())
 		}
 	}
@@ -87,24 +97,86 @@ func runFile(path string, args []string) {
 		os.Exit(1)
 	}
 
-	env := object.NewEnvironment()
-	_ = eval.Eval(program, env)
+	session := newSession()
+	session.checkNames = true
+	exitOnError(session.run(program))
 
-	main, ok := env.Get("main")
+	main, ok := session.env.Get("main")
 	if ok && main.Type() == object.FUNCTION_OBJ {
 		s := fmt.Sprintf("(main %s)", strings.Join(args, " "))
 		l = lexer.New(s, "main")
 		p = parser.New(l)
 		program = p.Parse()
 
-		eval.Eval(program, env)
+		exitOnError(session.run(program))
+	}
+}
+
+// exitOnError prints the traceback of an uncaught error and exits
+func exitOnError(result object.Object) {
+	if err, ok := result.(*object.Error); ok && !err.Caught {
+		fmt.Fprintln(os.Stderr, err.Traceback())
+		os.Exit(1)
+	}
+}
+
+// session runs programs against one global environment with the engine
+// selected on the command line. Unless checkNames is set, a program can
+// refer to globals a later one defines, as in the REPL.
+type session struct {
+	env        *object.Environment
+	constants  []object.Object
+	checkNames bool
+}
+
+func newSession() *session {
+	return &session{env: object.NewEnvironment(), constants: []object.Object{}}
+}
 
+// run runs each top-level form of program in turn. If checkNames is set,
+// it checks the names of the whole program before running any of it, and
+// those of each form again once its macro calls are expanded.
+func (s *session) run(program *ast.Program) object.Object {
+	var names []string
+	if s.checkNames {
+		names = eval.DefinedNames(program.Expressions)
+		if err := eval.CheckUnexpandedNames(program, s.env, names); err != nil {
+			return err
+		}
 	}
 
+	return eval.RunForms(program, s.env, func(form *ast.Program) object.Object {
+		if s.checkNames {
+			if err := eval.CheckNames(form, s.env, names); err != nil {
+				return err
+			}
+		}
+		return s.runForm(form)
+	})
+}
+
+func (s *session) runForm(form *ast.Program) object.Object {
+	if *engine == "eval" {
+		return eval.Eval(form, s.env)
+	}
+
+	comp := compiler.NewWithState(s.constants)
+	if err := comp.Compile(form); err != nil {
+		return &object.Error{Kind: object.SYNTAX_ERROR, Message: err.Error()}
+	}
+
+	bytecode := comp.Bytecode()
+	s.constants = bytecode.Constants
+
+	machine := vm.New(bytecode, s.env)
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
 }
 
 func printParserErrors(errors []parser.ParseError) {
 	for _, msg := range errors {
-		fmt.Println("\t" + msg.Msg)
+		fmt.Printf("\t%d:%d: %s\n", msg.Line, msg.Column, msg.Msg)
 	}
 }
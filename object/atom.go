@@ -0,0 +1,66 @@
+package object
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Atom is a mutable reference to a value, the one kind of object lo code
+// can change in place. Its methods are safe to call from concurrent
+// goroutines.
+type Atom struct {
+	mu    sync.Mutex
+	value Object
+
+	// inspecting is set while Inspect prints the value, so an atom that
+	// holds itself prints as (atom ...) inside itself
+	inspecting atomic.Bool
+}
+
+func NewAtom(val Object) *Atom {
+	return &Atom{value: val}
+}
+
+func (a *Atom) Type() ObjectType { return ATOM_OBJ }
+func (a *Atom) Inspect() string {
+	if !a.inspecting.CompareAndSwap(false, true) {
+		return "(atom ...)"
+	}
+	defer a.inspecting.Store(false)
+	return "(atom " + a.Deref().Inspect() + ")"
+}
+
+// Deref returns the atom's current value
+func (a *Atom) Deref() Object {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.value
+}
+
+// Reset sets the atom's value
+func (a *Atom) Reset(val Object) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.value = val
+}
+
+// CompareAndSet sets the atom's value to val if its current value is old,
+// compared with Equal, and reports whether it did. Equal can realize lazy
+// sequences, running code that uses the atom, so it runs without the lock,
+// and is run again if the value changed meanwhile.
+func (a *Atom) CompareAndSet(old, val Object) bool {
+	for {
+		current := a.Deref()
+		if current != old && !Equal(current, old) {
+			return false
+		}
+
+		a.mu.Lock()
+		if a.value == current {
+			a.value = val
+			a.mu.Unlock()
+			return true
+		}
+		a.mu.Unlock()
+	}
+}
@@ -1,30 +1,115 @@
 package object
 
+import "sync/atomic"
+
+// Environment holds the bindings the tree-walker evaluates with. The
+// global environment maps names to values, and is shared with the VM. The
+// environment of each function call or block within it keeps its locals in
+// slots the resolver has numbered, so finding one is a walk out a known
+// number of scopes rather than a search by name.
 type Environment struct {
 	store map[string]Object
+	slots []Object
 	outer *Environment
+
+	// calls is the number of tree-walker function calls in progress in
+	// the global environment
+	calls *atomic.Int64
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{store: s, calls: new(atomic.Int64)}
 }
 
+// NewEnclosedEnvironment makes the environment of a function call or
+// block inside outer
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{outer: outer}
 }
 
-func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+// BeginCall counts a function call as in progress in e's global
+// environment, returning the number in progress, and EndCall counts it as
+// finished. Goroutines evaluating in one global environment share the
+// count.
+func (e *Environment) BeginCall() int {
+	return int(e.global().calls.Add(1))
+}
+
+func (e *Environment) EndCall() {
+	e.global().calls.Add(-1)
+}
+
+// global returns the global environment e is inside
+func (e *Environment) global() *Environment {
+	for e.store == nil {
+		e = e.outer
 	}
+	return e
+}
+
+// Get looks name up in the global environment
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.global().store[name]
 	return obj, ok
 }
 
+// Set binds name in the global environment
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.global().store[name] = val
 	return val
 }
+
+// Assign sets name in the global environment if it's bound there,
+// reporting whether it was
+func (e *Environment) Assign(name string, val Object) bool {
+	g := e.global()
+	if _, ok := g.store[name]; !ok {
+		return false
+	}
+	g.store[name] = val
+	return true
+}
+
+// GetLocal returns the local in slot of the environment depth scopes out
+// from e, reporting whether it has been bound yet
+func (e *Environment) GetLocal(depth, slot int) (Object, bool) {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	if slot >= len(e.slots) || e.slots[slot] == nil {
+		return nil, false
+	}
+	return e.slots[slot], true
+}
+
+// SetLocal binds slot of the environment depth scopes out from e
+func (e *Environment) SetLocal(depth, slot int, val Object) {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	for slot >= len(e.slots) {
+		e.slots = append(e.slots, nil)
+	}
+	e.slots[slot] = val
+}
+
+// Scope holds the slot-indexed locals of one function call in the VM.
+// Closures keep a pointer to the Scope they were created in, so like
+// Environment a binding defined after the closure is still visible to it.
+type Scope struct {
+	Slots []Object
+	Outer *Scope
+}
+
+func NewScope(size int, outer *Scope) *Scope {
+	return &Scope{Slots: make([]Object, size), Outer: outer}
+}
+
+// At returns the scope depth levels out from s
+func (s *Scope) At(depth int) *Scope {
+	for ; depth > 0; depth-- {
+		s = s.Outer
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package object
+
+import "math/big"
+
+// Equal reports whether a and b are the same value. Numbers are equal if
+// their values are, whatever their kind, so 1 and 1.0 are equal, and a
+// float is compared with an exact number as a float, as < does. The exact
+// kinds never overlap, an Integer being whole and a BigInt too big for
+// one, and floats can't be map keys, so equal keys still have equal
+// HashKeys. Strings and other scalars compare by value. Lists, forms and
+// lazy sequences compare element by element, and maps and sets compare
+// their pairs and members regardless of order. Anything else, such as
+// functions, is only equal to itself.
+func Equal(a, b Object) bool {
+	if _, ok := a.(*Float); ok {
+		return equalFloat(a, b)
+	}
+	if _, ok := b.(*Float); ok {
+		return equalFloat(b, a)
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *BigInt:
+		b, ok := b.(*BigInt)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *Ratio:
+		b, ok := b.(*Ratio)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Nil:
+		_, ok := b.(*Nil)
+		return ok
+	case *Symbol:
+		b, ok := b.(*Symbol)
+		return ok && a.Name == b.Name
+	case *Keyword:
+		b, ok := b.(*Keyword)
+		return ok && a.Name == b.Name
+	case *List, *Form, *LazySeq:
+		return sequential(b) && equalElements(a.(Iterable), b.(Iterable))
+	case *Map:
+		b, ok := b.(*Map)
+		return ok && equalMaps(a, b)
+	case *Set:
+		b, ok := b.(*Set)
+		return ok && equalSets(a, b)
+	}
+	return a == b
+}
+
+// equalFloat compares the float f with b, converting b to a float if it's
+// an exact number
+func equalFloat(f, b Object) bool {
+	x := f.(*Float).Value
+	switch b := b.(type) {
+	case *Float:
+		return x == b.Value
+	case *Integer:
+		return x == float64(b.Value)
+	case *BigInt:
+		y, _ := new(big.Float).SetInt(b.Value).Float64()
+		return x == y
+	case *Ratio:
+		y, _ := b.Value.Float64()
+		return x == y
+	}
+	return false
+}
+
+// sequential reports whether obj is a list, form or lazy sequence, which
+// are equal if their elements are
+func sequential(obj Object) bool {
+	switch obj.(type) {
+	case *List, *Form, *LazySeq:
+		return true
+	}
+	return false
+}
+
+// equalElements compares two sequences element by element, realizing as
+// much of any lazy sequence as it takes. A lazy sequence that fails to
+// realize is equal to nothing.
+func equalElements(a, b Iterable) bool {
+	as, bs := a.Iterator(), b.Iterator()
+	for {
+		x, y := as.Next(), bs.Next()
+		if x == nil || y == nil {
+			return x == nil && y == nil
+		}
+		if isFailure(x) || isFailure(y) || !Equal(x, y) {
+			return false
+		}
+	}
+}
+
+func equalMaps(a, b *Map) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for _, pair := range a.Pairs() {
+		other, ok := b.Get(pair.Key)
+		if !ok || !Equal(pair.Value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalSets(a, b *Set) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for _, member := range a.Members() {
+		if !b.Contains(member) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,489 @@
+package object
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// HashKey identifies a map key. Two keys are the same key exactly when
+// their HashKeys are equal, so values of different types never collide.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Text  string
+}
+
+// Hashable is implemented by the objects that can be used as map keys.
+// Sequences and maps can only be used if IsHashable says so.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+// IsHashable reports whether obj can be used as a map key: whether it's
+// Hashable and, if it's a sequence or map, whether its elements or values
+// are. It realizes a lazy sequence, which can't be used if that fails.
+func IsHashable(obj Object) bool {
+	switch obj := obj.(type) {
+	case *List, *Form, *LazySeq:
+		it := obj.(Iterable).Iterator()
+		for elem := it.Next(); elem != nil; elem = it.Next() {
+			if isFailure(elem) || !IsHashable(elem) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		for _, pair := range obj.Pairs() {
+			if !IsHashable(pair.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := obj.(Hashable)
+	return ok
+}
+
+// write writes k to out in a form that tells it apart from any other key,
+// even with other keys written after it
+func (k HashKey) write(out *strings.Builder) {
+	fmt.Fprintf(out, "%s %d %d:%s", k.Type, k.Value, len(k.Text), k.Text)
+}
+
+// HashKey of a List is made of those of its elements, in order, so equal
+// lists have equal keys. An equal form or lazy sequence has the same key.
+func (l *List) HashKey() HashKey    { return sequenceHashKey(l) }
+func (f *Form) HashKey() HashKey    { return sequenceHashKey(f) }
+func (s *LazySeq) HashKey() HashKey { return sequenceHashKey(s) }
+
+func sequenceHashKey(seq Iterable) HashKey {
+	var out strings.Builder
+	n := 0
+	it := seq.Iterator()
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		elem.(Hashable).HashKey().write(&out)
+		n++
+	}
+	return HashKey{Type: LIST_OBJ, Value: uint64(n), Text: out.String()}
+}
+
+// HashKey of a Map is made of those of its keys and values, in an order
+// that doesn't depend on the order the keys were added in
+func (m *Map) HashKey() HashKey {
+	pairs := make([]string, 0, m.Len())
+	for _, pair := range m.Pairs() {
+		var out strings.Builder
+		pair.Key.HashKey().write(&out)
+		pair.Value.(Hashable).HashKey().write(&out)
+		pairs = append(pairs, out.String())
+	}
+	return HashKey{Type: m.Type(), Value: uint64(m.Len()), Text: sortedText(pairs)}
+}
+
+// HashKey of a Set is made of those of its members, in an order that
+// doesn't depend on the order they were added in
+func (s *Set) HashKey() HashKey {
+	members := make([]string, 0, s.Len())
+	for _, member := range s.Members() {
+		var out strings.Builder
+		member.HashKey().write(&out)
+		members = append(members, out.String())
+	}
+	return HashKey{Type: s.Type(), Value: uint64(s.Len()), Text: sortedText(members)}
+}
+
+func sortedText(keys []string) string {
+	sort.Strings(keys)
+	return strings.Join(keys, "")
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Value}
+}
+
+func (k *Keyword) HashKey() HashKey {
+	return HashKey{Type: k.Type(), Text: k.Name}
+}
+
+func (n *Nil) HashKey() HashKey {
+	return HashKey{Type: n.Type()}
+}
+
+func (s *Symbol) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Name}
+}
+
+// HashPair is a key and the value stored under it
+type HashPair struct {
+	Key   Hashable
+	Value Object
+}
+
+// Map is a persistent hash map, written {k v}: a hash array mapped trie
+// with 32-way branching. Like Lists, Maps are immutable, and Assoc and
+// Dissoc take O(log32 n) time, copying only the path to the key they
+// change. A Map remembers the order its keys were added in, so iterating
+// over it and printing it are deterministic.
+type Map struct {
+	root  *hamtNode
+	count int
+
+	// order holds the keys in the order they were added. A key that has
+	// been removed stays in order until it's compacted, but its entry no
+	// longer has its index, so it's skipped.
+	order *List
+}
+
+// mapEntry is a pair stored in a Map, along with its key's hash and the
+// index of the key in the Map's order
+type mapEntry struct {
+	hash  uint64
+	key   HashKey
+	pair  HashPair
+	index int
+}
+
+// hamtNode is a node of a Map's trie. Each of its slots holds an entry or a
+// child node, and bitmap has a bit set for each of the 32 slots that is
+// present, so they can be stored compactly. Keys whose hashes are the same
+// all the way down share a collision node, a list of entries past the last
+// level.
+type hamtNode struct {
+	edit   *editToken
+	bitmap uint32
+	slots  []hamtSlot
+}
+
+type hamtSlot struct {
+	entry *mapEntry
+	node  *hamtNode
+}
+
+const hashBits = 64
+
+var emptyHAMTNode = &hamtNode{}
+
+func NewMap() *Map {
+	return &Map{root: emptyHAMTNode, order: NewList(nil)}
+}
+
+func (m *Map) Type() ObjectType { return MAP_OBJ }
+func (m *Map) Inspect() string {
+	var out strings.Builder
+	out.WriteString("{")
+	for i, pair := range m.Pairs() {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(pair.Key.Inspect())
+		out.WriteString(" ")
+		out.WriteString(pair.Value.Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Get returns the value stored under key
+func (m *Map) Get(key Hashable) (Object, bool) {
+	hash := key.HashKey()
+	e := findEntry(m.root, hash.hash(), hash)
+	if e == nil {
+		return nil, false
+	}
+	return e.pair.Value, true
+}
+
+// Assoc returns a map with val stored under key, which keeps its place if
+// it's already there
+func (m *Map) Assoc(key Hashable, val Object) *Map {
+	e := newEntry(key, val, m.order.Len())
+	root, old := assocEntry(nil, m.root, 0, e)
+	if old != nil {
+		return &Map{root: root, count: m.count, order: m.order}
+	}
+	return &Map{root: root, count: m.count + 1, order: m.order.Conj(key)}
+}
+
+// Dissoc returns a map without key
+func (m *Map) Dissoc(key Hashable) *Map {
+	hash := key.HashKey()
+	root, removed := dissocEntry(nil, m.root, 0, hash.hash(), hash)
+	if removed == nil {
+		return m
+	}
+	result := &Map{root: root, count: m.count - 1, order: m.order}
+
+	// once most of order is removed keys, rebuild the map without them
+	if result.order.Len() > 2*result.count+vectorWidth {
+		t := NewMap().Transient()
+		for _, pair := range result.Pairs() {
+			t.Assoc(pair.Key, pair.Value)
+		}
+		return t.Persistent()
+	}
+	return result
+}
+
+// Len returns the number of pairs in the map
+func (m *Map) Len() int {
+	return m.count
+}
+
+// Pairs returns the map's pairs in the order their keys were added
+func (m *Map) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, m.count)
+	next := m.entries()
+	for e := next(); e != nil; e = next() {
+		pairs = append(pairs, e.pair)
+	}
+	return pairs
+}
+
+// entries returns a function that returns each of the map's entries in
+// the order their keys were added, and then nil
+func (m *Map) entries() func() *mapEntry {
+	keys := m.order.Iterator()
+	i := -1
+	return func() *mapEntry {
+		for key := keys.Next(); key != nil; key = keys.Next() {
+			i++
+			hash := key.(Hashable).HashKey()
+			if e := findEntry(m.root, hash.hash(), hash); e != nil && e.index == i {
+				return e
+			}
+		}
+		return nil
+	}
+}
+
+func newEntry(key Hashable, val Object, index int) *mapEntry {
+	hash := key.HashKey()
+	return &mapEntry{hash: hash.hash(), key: hash, pair: HashPair{Key: key, Value: val}, index: index}
+}
+
+// hash mixes a HashKey into 64 bits, five of which pick the slot at each
+// level of a Map's trie. It's FNV-1a followed by a finalizer that spreads
+// the small differences between nearby integers across all the bits.
+func (k HashKey) hash() uint64 {
+	const offset, prime = 14695981039346656037, 1099511628211
+	h := uint64(offset)
+	for i := 0; i < len(k.Type); i++ {
+		h = (h ^ uint64(k.Type[i])) * prime
+	}
+	for i := 0; i < 64; i += 8 {
+		h = (h ^ (k.Value>>i)&0xff) * prime
+	}
+	for i := 0; i < len(k.Text); i++ {
+		h = (h ^ uint64(k.Text[i])) * prime
+	}
+
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
+
+// slotIndex returns the bit for hash at the level with the given shift and
+// the index of its slot in node
+func slotIndex(node *hamtNode, shift uint, hash uint64) (uint32, int) {
+	bit := uint32(1) << ((hash >> shift) & vectorMask)
+	return bit, bits.OnesCount32(node.bitmap & (bit - 1))
+}
+
+func findEntry(node *hamtNode, hash uint64, key HashKey) *mapEntry {
+	for shift := uint(0); node != nil; shift += vectorBits {
+		if shift >= hashBits {
+			for _, slot := range node.slots {
+				if slot.entry.key == key {
+					return slot.entry
+				}
+			}
+			return nil
+		}
+
+		bit, i := slotIndex(node, shift, hash)
+		if node.bitmap&bit == 0 {
+			return nil
+		}
+		slot := node.slots[i]
+		if slot.node == nil {
+			if slot.entry.key == key {
+				return slot.entry
+			}
+			return nil
+		}
+		node = slot.node
+	}
+	return nil
+}
+
+// assocEntry returns node with e stored in it, and the entry e replaced if
+// its key was already there, in which case e takes over its index. Nodes
+// owned by edit are changed in place.
+func assocEntry(edit *editToken, node *hamtNode, shift uint, e *mapEntry) (*hamtNode, *mapEntry) {
+	if shift >= hashBits {
+		result := editableHAMTNode(edit, node)
+		for i, slot := range node.slots {
+			if slot.entry.key == e.key {
+				e.index = slot.entry.index
+				result.slots[i] = hamtSlot{entry: e}
+				return result, slot.entry
+			}
+		}
+		result.slots = append(result.slots, hamtSlot{entry: e})
+		return result, nil
+	}
+
+	bit, i := slotIndex(node, shift, e.hash)
+	result := editableHAMTNode(edit, node)
+	if node.bitmap&bit == 0 {
+		result.bitmap |= bit
+		result.slots = append(result.slots, hamtSlot{})
+		copy(result.slots[i+1:], result.slots[i:])
+		result.slots[i] = hamtSlot{entry: e}
+		return result, nil
+	}
+
+	slot := node.slots[i]
+	switch {
+	case slot.node != nil:
+		child, old := assocEntry(edit, slot.node, shift+vectorBits, e)
+		result.slots[i] = hamtSlot{node: child}
+		return result, old
+
+	case slot.entry.key == e.key:
+		e.index = slot.entry.index
+		result.slots[i] = hamtSlot{entry: e}
+		return result, slot.entry
+	}
+
+	// two keys share this slot, so it becomes a node holding both
+	child := &hamtNode{edit: edit}
+	child, _ = assocEntry(edit, child, shift+vectorBits, slot.entry)
+	child, _ = assocEntry(edit, child, shift+vectorBits, e)
+	result.slots[i] = hamtSlot{node: child}
+	return result, nil
+}
+
+// dissocEntry returns node without key, and the entry it removed, or node
+// itself and nil if key isn't there
+func dissocEntry(edit *editToken, node *hamtNode, shift uint, hash uint64, key HashKey) (*hamtNode, *mapEntry) {
+	if shift >= hashBits {
+		for i, slot := range node.slots {
+			if slot.entry.key == key {
+				result := editableHAMTNode(edit, node)
+				result.slots = append(result.slots[:i], result.slots[i+1:]...)
+				return result, slot.entry
+			}
+		}
+		return node, nil
+	}
+
+	bit, i := slotIndex(node, shift, hash)
+	if node.bitmap&bit == 0 {
+		return node, nil
+	}
+
+	slot := node.slots[i]
+	if slot.node == nil {
+		if slot.entry.key != key {
+			return node, nil
+		}
+		result := editableHAMTNode(edit, node)
+		result.bitmap &^= bit
+		result.slots = append(result.slots[:i], result.slots[i+1:]...)
+		return result, slot.entry
+	}
+
+	child, removed := dissocEntry(edit, slot.node, shift+vectorBits, hash, key)
+	if removed == nil {
+		return node, nil
+	}
+	result := editableHAMTNode(edit, node)
+	switch {
+	case len(child.slots) == 0:
+		result.bitmap &^= bit
+		result.slots = append(result.slots[:i], result.slots[i+1:]...)
+	case len(child.slots) == 1 && child.slots[0].node == nil:
+		// a lone entry moves up into this node
+		result.slots[i] = child.slots[0]
+	default:
+		result.slots[i] = hamtSlot{node: child}
+	}
+	return result, removed
+}
+
+// editableHAMTNode returns node if edit owns it, and otherwise a copy of it
+// that edit owns
+func editableHAMTNode(edit *editToken, node *hamtNode) *hamtNode {
+	if edit != nil && node.edit == edit {
+		return node
+	}
+	return &hamtNode{edit: edit, bitmap: node.bitmap, slots: append([]hamtSlot(nil), node.slots...)}
+}
+
+// TransientMap builds a Map by changing it in place, as TransientList
+// builds a List
+type TransientMap struct {
+	edit  *editToken
+	root  *hamtNode
+	count int
+	order *TransientList
+}
+
+// Transient returns a TransientMap that starts out with the pairs of m,
+// which is left unchanged
+func (m *Map) Transient() *TransientMap {
+	return &TransientMap{edit: &editToken{}, root: m.root, count: m.count, order: m.order.Transient()}
+}
+
+// Get returns the value stored under key
+func (t *TransientMap) Get(key Hashable) (Object, bool) {
+	return (&Map{root: t.root}).Get(key)
+}
+
+// Assoc stores val under key, which keeps its place if it's already there
+func (t *TransientMap) Assoc(key Hashable, val Object) {
+	t.ensureEditable()
+	e := newEntry(key, val, t.order.Len())
+	root, old := assocEntry(t.edit, t.root, 0, e)
+	t.root = root
+	if old == nil {
+		t.count++
+		t.order.Conj(key)
+	}
+}
+
+// Len returns the number of pairs added so far
+func (t *TransientMap) Len() int {
+	return t.count
+}
+
+// Persistent returns the Map built so far. The TransientMap can't be used
+// after that.
+func (t *TransientMap) Persistent() *Map {
+	t.ensureEditable()
+	t.edit = nil
+	return &Map{root: t.root, count: t.count, order: t.order.Persistent()}
+}
+
+func (t *TransientMap) ensureEditable() {
+	if t.edit == nil {
+		panic("transient map used after Persistent")
+	}
+}
@@ -0,0 +1,47 @@
+package object
+
+import "math/big"
+
+// BigInt is an integer too large for an Integer. Arithmetic promotes to
+// one on overflow and demotes back when the result fits, so every integer
+// has exactly one representation. It reports INTEGER_OBJ so lo programs
+// can't tell the two apart.
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+func (b *BigInt) HashKey() HashKey {
+	return HashKey{Type: b.Type(), Text: b.Value.String()}
+}
+
+// Ratio is an exact fraction, such as the result of (/ 1 3). Its
+// denominator is never 1, since that makes an integer instead.
+type Ratio struct {
+	Value *big.Rat
+}
+
+func (r *Ratio) Type() ObjectType { return RATIO_OBJ }
+func (r *Ratio) Inspect() string  { return r.Value.String() }
+
+func (r *Ratio) HashKey() HashKey {
+	return HashKey{Type: r.Type(), Text: r.Value.String()}
+}
+
+// NewInteger returns i as an Integer if it fits in one, or a BigInt
+func NewInteger(i *big.Int) Object {
+	if i.IsInt64() {
+		return &Integer{Value: i.Int64()}
+	}
+	return &BigInt{Value: i}
+}
+
+// NewRatio returns r as an integer if its denominator is 1, or a Ratio
+func NewRatio(r *big.Rat) Object {
+	if r.IsInt() {
+		return NewInteger(new(big.Int).Set(r.Num()))
+	}
+	return &Ratio{Value: r}
+}
@@ -3,7 +3,10 @@ package object
 import (
 	"fmt"
 	"lo/ast"
+	"lo/code"
+	"lo/token"
 	"strings"
+	"sync"
 )
 
 type ObjectType string
@@ -11,12 +14,23 @@ type ObjectType string
 const (
 	INTEGER_OBJ  ObjectType = "INTEGER"
 	FLOAT_OBJ    ObjectType = "FLOAT"
+	RATIO_OBJ    ObjectType = "RATIO"
 	BOOLEAN_OBJ  ObjectType = "BOOLEAN"
 	ERROR_OBJ    ObjectType = "ERROR"
 	FUNCTION_OBJ ObjectType = "FUNCTION"
 	BUILTIN_OBJ  ObjectType = "BUILTIN"
 	LIST_OBJ     ObjectType = "LIST"
 	STRING_OBJ   ObjectType = "STRING"
+	SYMBOL_OBJ   ObjectType = "SYMBOL"
+	FORM_OBJ     ObjectType = "FORM"
+	MACRO_OBJ    ObjectType = "MACRO"
+	MAP_OBJ      ObjectType = "MAP"
+	SET_OBJ      ObjectType = "SET"
+	KEYWORD_OBJ  ObjectType = "KEYWORD"
+	NIL_OBJ      ObjectType = "NIL"
+	PATTERN_OBJ  ObjectType = "PATTERN"
+	ATOM_OBJ     ObjectType = "ATOM"
+	LAZY_SEQ_OBJ ObjectType = "LAZY_SEQ"
 )
 
 type Object interface {
@@ -48,60 +62,344 @@ type Boolean struct {
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
-// Error represents an error object
+// Nil represents the absence of a value. There is only one, consts.Nil.
+type Nil struct{}
+
+func (n *Nil) Type() ObjectType { return NIL_OBJ }
+func (n *Nil) Inspect() string  { return "nil" }
+
+// IsTruthy reports whether obj counts as true in a condition. Only nil and
+// false are falsy; every other value, including 0 and "", is truthy.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Nil:
+		return false
+	case *Boolean:
+		return obj.Value
+	}
+	return true
+}
+
+// Error represents an error object. Errors short-circuit evaluation, and
+// as one propagates out of each function call it records where it was,
+// building up a call stack for the traceback.
 type Error struct {
+	Kind    string
 	Message string
+	Payload Object
+	Trace   []TraceEntry
+
+	// Caught is set once a catch clause has bound the error, turning it
+	// into an ordinary value that no longer short-circuits evaluation
+	Caught bool
+
+	// located is set once the position in the current function is known,
+	// and cleared when the error unwinds out of that function
+	located bool
+}
+
+// Kinds of error raised by the runtime, for catch clauses to match on
+const (
+	NAME_ERROR     = "name-error"
+	TYPE_ERROR     = "type-error"
+	ARITY_ERROR    = "arity-error"
+	SYNTAX_ERROR   = "syntax-error"
+	DIVIDE_BY_ZERO = "divide-by-zero"
+	MATCH_ERROR    = "match-error"
+	INDEX_ERROR    = "index-error"
+	IO_ERROR       = "io-error"
+	DEPTH_ERROR    = "depth-error"
+	THROWN_ERROR   = "error"
+)
+
+// TraceEntry is one frame of an error's call stack: the position of the
+// failing form within a function. Function is empty for top-level code.
+type TraceEntry struct {
+	Function string
+	Token    token.Token
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
-// Function represents a user-defined function object
+// Locate records tok as the position of the error in the function
+// currently executing, unless one has already been recorded
+func (e *Error) Locate(tok token.Token) {
+	if e.located {
+		return
+	}
+	e.Trace = append(e.Trace, TraceEntry{Token: tok})
+	e.located = true
+}
+
+// Unwind marks the error as leaving a call to the named function
+func (e *Error) Unwind(name string) {
+	if e.located {
+		e.Trace[len(e.Trace)-1].Function = name
+	} else {
+		e.Trace = append(e.Trace, TraceEntry{Function: name})
+	}
+	e.located = false
+}
+
+// Token returns the position of the form that raised the error
+func (e *Error) Token() token.Token {
+	if len(e.Trace) == 0 {
+		return token.Token{}
+	}
+	return e.Trace[0].Token
+}
+
+// maxRepeatedEntries is how many of a run of identical entries in a trace
+// Traceback shows before counting the rest
+const maxRepeatedEntries = 3
+
+// Traceback renders the error with its call stack, innermost call first.
+// Only the first few entries of a run of identical ones, as deep recursion
+// leaves, are shown, followed by the number of the rest.
+func (e *Error) Traceback() string {
+	var out strings.Builder
+	out.WriteString(e.Inspect())
+	for i := 0; i < len(e.Trace); {
+		entry := e.Trace[i]
+		n := 1
+		for i+n < len(e.Trace) && e.Trace[i+n] == entry {
+			n++
+		}
+
+		pos := fmt.Sprintf("%s:%d:%d", entry.Token.Filename, entry.Token.Line, entry.Token.Column)
+		for range min(n, maxRepeatedEntries) {
+			if entry.Function == "" {
+				fmt.Fprintf(&out, "\n    at %s", pos)
+			} else {
+				fmt.Fprintf(&out, "\n    at %s (%s)", entry.Function, pos)
+			}
+		}
+		if n > maxRepeatedEntries {
+			fmt.Fprintf(&out, "\n    ... repeated %d more times", n-maxRepeatedEntries)
+		}
+		i += n
+	}
+	return out.String()
+}
+
+// Function represents a user-defined function object. Parameters and
+// Defaults hold the pattern and default of each slot of its Signature. A
+// function with more than one arity holds a Function for each in Arities
+// instead, chosen by the number of arguments it's called with.
+//
+// Env is the environment the function was created in. A function closes
+// over bindings rather than copying their values: it sees a local that is
+// assigned by set! or defined by a def later in the same body. Each call,
+// let, letfn, match clause and loop iteration makes bindings of its own,
+// so closures made in different calls or iterations never share them.
+// Globals are looked up by name when they're used, so redefining one, as
+// the REPL does, changes it for every function that refers to it.
 type Function struct {
 	Name       string
-	Parameters []*ast.Identifier
+	Parameters []*Pattern
+	Defaults   []ast.Expression
+	Signature  *Signature
 	Body       []ast.Expression
 	Env        *Environment
+	Arities    []*Function
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
-	return fmt.Sprintf("(fn %s)", f.Name)
+	return inspectFunction(f.Name, f.signatures())
+}
+
+func (f *Function) signatures() []*Signature {
+	if f.Arities == nil {
+		return []*Signature{f.Signature}
+	}
+	sigs := make([]*Signature, len(f.Arities))
+	for i, a := range f.Arities {
+		sigs[i] = a.Signature
+	}
+	return sigs
+}
+
+// Arity returns the arity of f that a call with n arguments runs
+func (f *Function) Arity(n int) (*Function, *Error) {
+	if f.Arities == nil {
+		return f, nil
+	}
+	i, err := SelectArity(f.Name, f.signatures(), n)
+	if err != nil {
+		return nil, err
+	}
+	return f.Arities[i], nil
+}
+
+// CompiledFunction represents a function body lowered to bytecode, or a
+// function with several arities, each a CompiledFunction of its own
+type CompiledFunction struct {
+	Name         string
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	NumLocals    int
+	Signature    *Signature
+	Arities      []*CompiledFunction
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return inspectFunction(cf.Name, cf.signatures())
+}
+
+func (cf *CompiledFunction) signatures() []*Signature {
+	if cf.Arities == nil {
+		return []*Signature{cf.Signature}
+	}
+	sigs := make([]*Signature, len(cf.Arities))
+	for i, a := range cf.Arities {
+		sigs[i] = a.Signature
+	}
+	return sigs
+}
+
+// Arity returns the arity of cf that a call with n arguments runs
+func (cf *CompiledFunction) Arity(n int) (*CompiledFunction, *Error) {
+	if cf.Arities == nil {
+		return cf, nil
+	}
+	i, err := SelectArity(cf.Name, cf.signatures(), n)
+	if err != nil {
+		return nil, err
+	}
+	return cf.Arities[i], nil
+}
+
+// inspectFunction shows a function as its name and parameter lists
+func inspectFunction(name string, sigs []*Signature) string {
+	var out strings.Builder
+	out.WriteString("(fn " + name)
+	for _, s := range sigs {
+		out.WriteString(" " + s.Source)
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+// Closure pairs a compiled function with the scope it was created in,
+// which it closes over like a Function closes over its Env. It reports
+// FUNCTION_OBJ so lo programs can't tell it apart from a tree-walked
+// Function. Apply calls it in the VM that made it, for the tree-walker to
+// call it from a macro.
+type Closure struct {
+	Fn    *CompiledFunction
+	Env   *Scope
+	Apply Applier
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
 }
 
 // BuiltinFunction represents a built-in function object
 type BuiltinFunction func(args ...Object) Object
 
+// Applier calls a function value in whichever back end is running
+type Applier func(fn Object, args ...Object) Object
+
+// HigherOrderFunction is a builtin that calls functions passed to it
+type HigherOrderFunction func(apply Applier, args ...Object) Object
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Name string
+	Fn   BuiltinFunction
+
+	// HigherOrder is set in place of Fn by builtins that take functions
+	HigherOrder HigherOrderFunction
+}
+
+// Call calls the builtin, handing apply on to higher-order builtins
+func (b *Builtin) Call(apply Applier, args ...Object) Object {
+	if b.HigherOrder != nil {
+		return b.HigherOrder(apply, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
-// List represents a list object
-type List struct {
+// String returns the string representation of the object
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Symbol is an identifier as data, produced by quoting code. Token records
+// where it was read so code built from it keeps its source position.
+type Symbol struct {
+	Name  string
+	Token token.Token
+}
+
+func (s *Symbol) Type() ObjectType { return SYMBOL_OBJ }
+func (s *Symbol) Inspect() string  { return s.Name }
+
+// Keyword is a name that evaluates to itself, written :name. Keywords are
+// interned, so two keywords with the same name are the same object.
+type Keyword struct {
+	Name string
+}
+
+func (k *Keyword) Type() ObjectType { return KEYWORD_OBJ }
+func (k *Keyword) Inspect() string  { return ":" + k.Name }
+
+var keywords = struct {
+	sync.Mutex
+	table map[string]*Keyword
+}{table: map[string]*Keyword{}}
+
+// InternKeyword returns the keyword with the given name
+func InternKeyword(name string) *Keyword {
+	keywords.Lock()
+	defer keywords.Unlock()
+
+	k, ok := keywords.table[name]
+	if !ok {
+		k = &Keyword{Name: name}
+		keywords.table[name] = k
+	}
+	return k
+}
+
+// Form is a parenthesised list as data: quoted code, and the code a macro
+// builds and returns
+type Form struct {
 	Elements []Object
+	Token    token.Token
 }
 
-func (l *List) Type() ObjectType { return LIST_OBJ }
-func (l *List) Inspect() string {
+func (f *Form) Type() ObjectType { return FORM_OBJ }
+func (f *Form) Inspect() string {
 	var out strings.Builder
-	out.WriteString("[")
-	for i, elem := range l.Elements {
+	out.WriteString("(")
+	for i, elem := range f.Elements {
 		out.WriteString(elem.Inspect())
-		if i < len(l.Elements)-1 {
+		if i < len(f.Elements)-1 {
 			out.WriteString(" ")
 		}
 	}
-	out.WriteString("]")
+	out.WriteString(")")
 	return out.String()
 }
 
-// String returns the string representation of the object
-type String struct {
-	Value string
+// Macro is a function from code to code, called on its unevaluated
+// arguments before the program runs
+type Macro struct {
+	Fn *Function
 }
 
-func (s *String) Type() ObjectType { return STRING_OBJ }
-func (s *String) Inspect() string  { return s.Value }
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	return fmt.Sprintf("(macro %s)", m.Fn.Name)
+}
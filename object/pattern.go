@@ -0,0 +1,127 @@
+package object
+
+import (
+	"strings"
+
+	"lo/ast"
+	"lo/token"
+)
+
+type PatternKind int
+
+const (
+	NamePattern PatternKind = iota
+	ListPattern
+	MapPattern
+	// Only match tests values against these
+	WildcardPattern
+	LiteralPattern
+	TypePattern
+)
+
+// Pattern is the target of a binding in a let, a loop or a parameter
+// list: a name, or a list or map pattern that takes a value apart and
+// binds names to its pieces. The patterns of a match clause can also be
+// wildcards, literals and type guards. The compiler keeps patterns as
+// constants for the VM to destructure and match with.
+type Pattern struct {
+	Kind  PatternKind
+	Token token.Token
+
+	// Name binds the whole value. It is the name of a NamePattern, or the
+	// :as name of a list or map pattern.
+	Name *ast.Identifier
+
+	// Elements take the values of a list in order, and Rest the List of
+	// any left over
+	Elements []*Pattern
+	Rest     *Pattern
+
+	// Values take the values stored under Keys in a map. Defaults are the
+	// :or expressions for names bound directly by Values.
+	Keys     []Hashable
+	Values   []*Pattern
+	Defaults map[string]ast.Expression
+
+	// Value is the constant a LiteralPattern matches. A TypePattern
+	// matches values of type TypeName that also match Inner.
+	Value    Object
+	TypeName ObjectType
+	Inner    *Pattern
+}
+
+func (p *Pattern) Type() ObjectType { return PATTERN_OBJ }
+func (p *Pattern) Inspect() string {
+	var parts []string
+	switch p.Kind {
+	case NamePattern:
+		return p.Name.Value
+	case WildcardPattern:
+		return "_"
+	case LiteralPattern:
+		return p.Value.Inspect()
+	case TypePattern:
+		return "(" + string(p.TypeName) + " " + p.Inner.Inspect() + ")"
+	case ListPattern:
+		for _, e := range p.Elements {
+			parts = append(parts, e.Inspect())
+		}
+		if p.Rest != nil {
+			parts = append(parts, "&", p.Rest.Inspect())
+		}
+	case MapPattern:
+		for i, key := range p.Keys {
+			parts = append(parts, p.Values[i].Inspect(), key.Inspect())
+		}
+	}
+	if p.Name != nil {
+		parts = append(parts, ":as", p.Name.Value)
+	}
+
+	if p.Kind == MapPattern {
+		return "{" + strings.Join(parts, " ") + "}"
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Bindings returns the names the pattern binds, in the order their values
+// are destructured, with the :or default of each or nil
+func (p *Pattern) Bindings() ([]*ast.Identifier, []ast.Expression) {
+	var names []*ast.Identifier
+	var defaults []ast.Expression
+
+	var walk func(p *Pattern, def ast.Expression)
+	walk = func(p *Pattern, def ast.Expression) {
+		switch p.Kind {
+		case NamePattern:
+			names = append(names, p.Name)
+			defaults = append(defaults, def)
+			return
+		case TypePattern:
+			walk(p.Inner, nil)
+			return
+		case ListPattern:
+			for _, e := range p.Elements {
+				walk(e, nil)
+			}
+			if p.Rest != nil {
+				walk(p.Rest, nil)
+			}
+		case MapPattern:
+			for _, v := range p.Values {
+				var def ast.Expression
+				if v.Kind == NamePattern {
+					def = p.Defaults[v.Name.Value]
+				}
+				walk(v, def)
+			}
+		}
+		if p.Name != nil {
+			names = append(names, p.Name)
+			defaults = append(defaults, nil)
+		}
+	}
+	walk(p, nil)
+
+	return names, defaults
+}
@@ -0,0 +1,191 @@
+package object
+
+import (
+	"strings"
+	"sync"
+)
+
+// Iterator steps through the elements of a sequence
+type Iterator interface {
+	// Next returns the next element, or nil after the last. If computing
+	// the element fails, Next returns the error instead and the iteration
+	// is over.
+	Next() Object
+}
+
+// Iterable is implemented by the objects that are sequences: lists, forms,
+// strings, whose elements are their characters, maps, whose elements are
+// their [key value] entries, sets, whose elements are their members, nil,
+// which is empty, and lazy sequences
+type Iterable interface {
+	Object
+	Iterator() Iterator
+}
+
+// IteratorFunc is an Iterator that calls itself for each element
+type IteratorFunc func() Object
+
+func (f IteratorFunc) Next() Object { return f() }
+
+type sliceIterator struct {
+	elems []Object
+}
+
+func (it *sliceIterator) Next() Object {
+	if len(it.elems) == 0 {
+		return nil
+	}
+	elem := it.elems[0]
+	it.elems = it.elems[1:]
+	return elem
+}
+
+func (f *Form) Iterator() Iterator { return &sliceIterator{elems: f.Elements} }
+func (n *Nil) Iterator() Iterator  { return &sliceIterator{} }
+
+func (s *String) Iterator() Iterator {
+	runes := []rune(s.Value)
+	return IteratorFunc(func() Object {
+		if len(runes) == 0 {
+			return nil
+		}
+		r := runes[0]
+		runes = runes[1:]
+		return &String{Value: string(r)}
+	})
+}
+
+func (m *Map) Iterator() Iterator {
+	next := m.entries()
+	return IteratorFunc(func() Object {
+		e := next()
+		if e == nil {
+			return nil
+		}
+		return NewList([]Object{e.pair.Key, e.pair.Value})
+	})
+}
+
+// LazySeq is a sequence whose elements are computed when they're first
+// needed, so it can be unbounded. It is a chain of cells, each realized at
+// most once into an element and the LazySeq of the elements after it, so
+// stepping through a LazySeq nothing else holds onto takes constant
+// memory. A cell whose realization needs the cell itself, as in a
+// sequence defined as its own rest, realizes to an error instead of
+// waiting on itself. Go has no cheap way to tell that from a second
+// goroutine realizing the cell at the same time, which gets the same
+// error, so only the cells already realized are safe to share between
+// goroutines.
+type LazySeq struct {
+	mu        sync.Mutex
+	step      func() (Object, *LazySeq)
+	realizing bool
+	first     Object
+	rest      *LazySeq
+}
+
+// NewLazySeq returns a LazySeq that calls step the first time it's
+// realized. step returns the first element and the rest of the sequence,
+// nil for an empty sequence, or an error in place of the first element.
+func NewLazySeq(step func() (Object, *LazySeq)) *LazySeq {
+	return &LazySeq{step: step}
+}
+
+// IteratorSeq returns a LazySeq of the elements it produces, each taken
+// from it when the LazySeq is realized that far
+func IteratorSeq(it Iterator) *LazySeq {
+	return NewLazySeq(func() (Object, *LazySeq) {
+		elem := it.Next()
+		if elem == nil || isFailure(elem) {
+			return elem, nil
+		}
+		return elem, IteratorSeq(it)
+	})
+}
+
+func (s *LazySeq) Type() ObjectType { return LAZY_SEQ_OBJ }
+
+// Inspect realizes the whole sequence and prints it like a form
+func (s *LazySeq) Inspect() string {
+	var out strings.Builder
+	out.WriteString("(")
+	it := s.Iterator()
+	for i := 0; ; i++ {
+		elem := it.Next()
+		if elem == nil {
+			break
+		}
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(elem.Inspect())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+// Realize computes the first element and the rest of the sequence if they
+// haven't been yet, returning them as step does. The lock isn't held while
+// step runs, so a step that realizes its own cell gets an error back, as
+// does any other goroutine realizing the cell before step returns.
+func (s *LazySeq) Realize() (Object, *LazySeq) {
+	s.mu.Lock()
+	step := s.step
+	if step == nil {
+		defer s.mu.Unlock()
+		if s.realizing {
+			return &Error{Kind: DEPTH_ERROR, Message: "lazy sequence needs itself to be realized"}, nil
+		}
+		return raised(s.first), s.rest
+	}
+	s.step = nil
+	s.realizing = true
+	s.mu.Unlock()
+
+	first, rest := step()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.first, s.rest = raised(first), rest
+	s.realizing = false
+	return first, rest
+}
+
+// raised returns a copy of obj if it's an error in flight, so that a cell
+// that failed raises its error afresh each time it's realized, rather than
+// the one that was caught or added to the trace of last time. The copy
+// isn't yet located in the code realizing the cell.
+func raised(obj Object) Object {
+	if !isFailure(obj) {
+		return obj
+	}
+	err := *obj.(*Error)
+	err.Trace = append([]TraceEntry(nil), err.Trace...)
+	if err.located {
+		err.Trace = err.Trace[:len(err.Trace)-1]
+		err.located = false
+	}
+	return &err
+}
+
+func (s *LazySeq) Iterator() Iterator {
+	return IteratorFunc(func() Object {
+		if s == nil {
+			return nil
+		}
+		first, rest := s.Realize()
+		if first == nil || isFailure(first) {
+			s = nil
+		} else {
+			s = rest
+		}
+		return first
+	})
+}
+
+// isFailure reports whether obj is an error in flight rather than an error
+// value, which can be an element like any other
+func isFailure(obj Object) bool {
+	err, ok := obj.(*Error)
+	return ok && !err.Caught
+}
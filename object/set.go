@@ -0,0 +1,101 @@
+package object
+
+import "strings"
+
+// Set is a persistent set, written #{a b c}. Its members are the keys of a
+// Map, so they must be Hashable, and two values are the same member
+// exactly when they'd be the same map key. Like a Map, a Set remembers the
+// order its members were added in, which is the order it prints them in.
+type Set struct {
+	members *Map
+}
+
+func NewSet() *Set {
+	return &Set{members: NewMap()}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out strings.Builder
+	out.WriteString("#{")
+	for i, member := range s.Members() {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(member.Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Contains reports whether elem is a member of the set
+func (s *Set) Contains(elem Hashable) bool {
+	_, ok := s.members.Get(elem)
+	return ok
+}
+
+// Conj returns a set with elem added
+func (s *Set) Conj(elem Hashable) *Set {
+	if s.Contains(elem) {
+		return s
+	}
+	return &Set{members: s.members.Assoc(elem, elem)}
+}
+
+// Disj returns a set without elem
+func (s *Set) Disj(elem Hashable) *Set {
+	if !s.Contains(elem) {
+		return s
+	}
+	return &Set{members: s.members.Dissoc(elem)}
+}
+
+// Len returns the number of members in the set
+func (s *Set) Len() int {
+	return s.members.Len()
+}
+
+// Members returns the set's members in the order they were added
+func (s *Set) Members() []Hashable {
+	members := make([]Hashable, 0, s.Len())
+	for _, pair := range s.members.Pairs() {
+		members = append(members, pair.Key)
+	}
+	return members
+}
+
+func (s *Set) Iterator() Iterator {
+	next := s.members.entries()
+	return IteratorFunc(func() Object {
+		e := next()
+		if e == nil {
+			return nil
+		}
+		return e.pair.Key
+	})
+}
+
+// TransientSet builds a Set by changing it in place, as TransientList
+// builds a List
+type TransientSet struct {
+	members *TransientMap
+}
+
+// Transient returns a TransientSet that starts out with the members of s,
+// which is left unchanged
+func (s *Set) Transient() *TransientSet {
+	return &TransientSet{members: s.members.Transient()}
+}
+
+// Conj adds elem to the set
+func (t *TransientSet) Conj(elem Hashable) {
+	if _, ok := t.members.Get(elem); !ok {
+		t.members.Assoc(elem, elem)
+	}
+}
+
+// Persistent returns the Set built so far. The TransientSet can't be used
+// after that.
+func (t *TransientSet) Persistent() *Set {
+	return &Set{members: t.members.Persistent()}
+}
@@ -0,0 +1,121 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Signature describes how a function binds its arguments: required
+// parameters, then optional ones, then either a rest parameter collecting
+// any remaining arguments into a List or keyword parameters passed as
+// :name value pairs. Each parameter has a slot, in that order. Source is
+// the parameter list as written, for Inspect.
+type Signature struct {
+	Required int
+	Optional int
+	Rest     bool
+	Keys     []*Keyword
+	Source   string
+}
+
+// Len returns the number of slots the parameters occupy
+func (s *Signature) Len() int {
+	n := s.Required + s.Optional + len(s.Keys)
+	if s.Rest {
+		n++
+	}
+	return n
+}
+
+// Bind assigns args to the parameter slots of the function called name.
+// Slots of optional and keyword parameters with no argument are left nil,
+// for the caller to fill with their defaults.
+func (s *Signature) Bind(name string, args []Object) ([]Object, *Error) {
+	positional := s.Required + s.Optional
+	if len(args) < s.Required || (len(args) > positional && !s.Rest && len(s.Keys) == 0) {
+		return nil, &Error{Kind: ARITY_ERROR, Message: fmt.Sprintf("wrong number of arguments to %s, got %d, expected %s", name, len(args), s.expected())}
+	}
+
+	slots := make([]Object, s.Len())
+	n := copy(slots[:positional], args)
+	extra := args[n:]
+
+	if s.Rest {
+		slots[positional] = NewList(extra)
+		return slots, nil
+	}
+
+	if len(extra)%2 != 0 {
+		return nil, &Error{Kind: ARITY_ERROR, Message: fmt.Sprintf("keyword arguments to %s must come in pairs", name)}
+	}
+	for i := 0; i < len(extra); i += 2 {
+		key, ok := extra[i].(*Keyword)
+		if !ok {
+			return nil, &Error{Kind: TYPE_ERROR, Message: fmt.Sprintf("keyword argument names to %s must be KEYWORDs, got %s", name, extra[i].Type())}
+		}
+		slot := s.keySlot(key)
+		if slot < 0 {
+			return nil, &Error{Kind: ARITY_ERROR, Message: fmt.Sprintf("unknown keyword argument %s to %s", key.Inspect(), name)}
+		}
+		slots[slot] = extra[i+1]
+	}
+	return slots, nil
+}
+
+func (s *Signature) keySlot(key *Keyword) int {
+	for i, k := range s.Keys {
+		if k == key {
+			return s.Required + s.Optional + i
+		}
+	}
+	return -1
+}
+
+// Variadic reports whether the signature takes any number of arguments
+// beyond its required ones
+func (s *Signature) Variadic() bool {
+	return s.Rest || len(s.Keys) > 0
+}
+
+// Accepts reports whether the signature takes n arguments
+func (s *Signature) Accepts(n int) bool {
+	return n >= s.Required && (s.Variadic() || n <= s.Required+s.Optional)
+}
+
+// SelectArity returns the index of the signature among the arities of the
+// function called name that a call with n arguments runs: the first fixed
+// one that takes n, or else the variadic one
+func SelectArity(name string, sigs []*Signature, n int) (int, *Error) {
+	for i, s := range sigs {
+		if !s.Variadic() && s.Accepts(n) {
+			return i, nil
+		}
+	}
+	for i, s := range sigs {
+		if s.Variadic() && s.Accepts(n) {
+			return i, nil
+		}
+	}
+
+	expected := make([]string, len(sigs))
+	for i, s := range sigs {
+		expected[i] = s.expected()
+	}
+	last := len(expected) - 1
+	list := expected[last]
+	if last > 0 {
+		list = strings.Join(expected[:last], ", ") + " or " + list
+	}
+	return 0, &Error{Kind: ARITY_ERROR, Message: fmt.Sprintf("wrong number of arguments to %s, got %d, expected %s", name, n, list)}
+}
+
+// expected describes the number of arguments the signature accepts
+func (s *Signature) expected() string {
+	switch {
+	case s.Rest || len(s.Keys) > 0:
+		return fmt.Sprintf("at least %d", s.Required)
+	case s.Optional > 0:
+		return fmt.Sprintf("%d to %d", s.Required, s.Required+s.Optional)
+	}
+	return fmt.Sprint(s.Required)
+}
@@ -0,0 +1,314 @@
+package object
+
+import "strings"
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// editToken marks the nodes a transient owns and may change in place. A
+// node belongs to a transient while its edit is that transient's token.
+// It isn't empty, since pointers to zero-size values needn't be distinct.
+type editToken struct{ _ byte }
+
+// vectorNode is a node of a List's trie. Leaves hold values and the nodes
+// above them hold children.
+type vectorNode struct {
+	edit     *editToken
+	children []*vectorNode
+	values   []Object
+}
+
+// List represents a list object, written [a b c]. It is a persistent
+// vector: a trie with 32-way branching whose leaves hold the elements, plus
+// a tail of up to 32 elements not yet pushed into the trie. Lists are
+// immutable. Conj and Assoc take O(log32 n) time and return a new List that
+// copies only the path to the leaf it changes, sharing the rest of the trie
+// with the List it was made from. Drop returns a List that shares all of
+// the trie, and starts further into it.
+type List struct {
+	count int
+	shift uint
+	root  *vectorNode
+	tail  []Object
+
+	// start is the index in the trie of the first element. Those before
+	// it have been dropped.
+	start int
+}
+
+var emptyVectorNode = &vectorNode{}
+
+// NewList returns a List of elems
+func NewList(elems []Object) *List {
+	if len(elems) <= vectorWidth {
+		return &List{count: len(elems), shift: vectorBits, root: emptyVectorNode, tail: append([]Object{}, elems...)}
+	}
+	t := (&List{}).Transient()
+	for _, elem := range elems {
+		t.Conj(elem)
+	}
+	return t.Persistent()
+}
+
+func (l *List) Type() ObjectType { return LIST_OBJ }
+func (l *List) Inspect() string {
+	var out strings.Builder
+	out.WriteString("[")
+	it := l.Iterator()
+	for i := 0; i < l.Len(); i++ {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(it.Next().Inspect())
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+// Len returns the number of elements in the list
+func (l *List) Len() int {
+	return l.count - l.start
+}
+
+// Elements returns a new slice of the list's elements
+func (l *List) Elements() []Object {
+	elems := make([]Object, 0, l.Len())
+	it := l.Iterator()
+	for elem := it.Next(); elem != nil; elem = it.Next() {
+		elems = append(elems, elem)
+	}
+	return elems
+}
+
+// Nth returns the element at index i, which must be in range
+func (l *List) Nth(i int) Object {
+	i += l.start
+	return l.leafFor(i)[i&vectorMask]
+}
+
+// Drop returns a list without the first n elements, which must be no more
+// than its length. It takes constant time, sharing the whole trie with l.
+func (l *List) Drop(n int) *List {
+	if n == l.Len() {
+		return NewList(nil)
+	}
+	dropped := *l
+	dropped.start += n
+	return &dropped
+}
+
+// Conj returns a list with elem added to the end
+func (l *List) Conj(elem Object) *List {
+	if l.count-l.tailOffset() < vectorWidth {
+		tail := make([]Object, len(l.tail), len(l.tail)+1)
+		copy(tail, l.tail)
+		return &List{count: l.count + 1, shift: l.rootShift(), root: l.rootNode(), tail: append(tail, elem), start: l.start}
+	}
+
+	root, shift := l.pushTail(nil)
+	return &List{count: l.count + 1, shift: shift, root: root, tail: []Object{elem}, start: l.start}
+}
+
+// Assoc returns a list with the element at index i replaced by elem, or
+// with elem added to the end if i is the list's length
+func (l *List) Assoc(i int, elem Object) *List {
+	if i == l.Len() {
+		return l.Conj(elem)
+	}
+	i += l.start
+	if i >= l.tailOffset() {
+		tail := append([]Object{}, l.tail...)
+		tail[i&vectorMask] = elem
+		return &List{count: l.count, shift: l.rootShift(), root: l.rootNode(), tail: tail, start: l.start}
+	}
+	return &List{count: l.count, shift: l.shift, root: assocNode(nil, l.shift, l.root, i, elem), tail: l.tail, start: l.start}
+}
+
+// Iterator steps through the list a leaf at a time
+func (l *List) Iterator() Iterator {
+	i := l.start
+	var leaf []Object
+	return IteratorFunc(func() Object {
+		if i >= l.count {
+			return nil
+		}
+		if leaf == nil || i&vectorMask == 0 {
+			leaf = l.leafFor(i)
+		}
+		elem := leaf[i&vectorMask]
+		i++
+		return elem
+	})
+}
+
+// tailOffset is the index of the first element in the tail
+func (l *List) tailOffset() int {
+	if l.count < vectorWidth {
+		return 0
+	}
+	return ((l.count - 1) >> vectorBits) << vectorBits
+}
+
+// rootNode returns the root of the trie, which the zero List lacks
+func (l *List) rootNode() *vectorNode {
+	if l.root == nil {
+		return emptyVectorNode
+	}
+	return l.root
+}
+
+func (l *List) rootShift() uint {
+	if l.shift == 0 {
+		return vectorBits
+	}
+	return l.shift
+}
+
+// leafFor returns the leaf, or the tail, holding the element at index i
+func (l *List) leafFor(i int) []Object {
+	if i >= l.tailOffset() {
+		return l.tail
+	}
+	node := l.root
+	for level := l.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+// pushTail moves the full tail into the trie, returning the new root and
+// shift. Nodes owned by edit are changed in place.
+func (l *List) pushTail(edit *editToken) (*vectorNode, uint) {
+	leaf := &vectorNode{edit: edit, values: l.tail}
+	root, shift := l.rootNode(), l.rootShift()
+
+	// the trie is full, so it grows a level
+	if (l.count >> vectorBits) > (1 << shift) {
+		children := []*vectorNode{root, newPath(edit, shift, leaf)}
+		return &vectorNode{edit: edit, children: children}, shift + vectorBits
+	}
+	return pushTailNode(edit, l.count, shift, root, leaf), shift
+}
+
+func pushTailNode(edit *editToken, count int, level uint, parent, leaf *vectorNode) *vectorNode {
+	node := editableNode(edit, parent)
+	i := ((count - 1) >> level) & vectorMask
+
+	var child *vectorNode
+	switch {
+	case level == vectorBits:
+		child = leaf
+	case i < len(node.children):
+		child = pushTailNode(edit, count, level-vectorBits, node.children[i], leaf)
+	default:
+		child = newPath(edit, level-vectorBits, leaf)
+	}
+
+	if i < len(node.children) {
+		node.children[i] = child
+	} else {
+		node.children = append(node.children, child)
+	}
+	return node
+}
+
+// newPath returns a chain of nodes from the given level down to leaf
+func newPath(edit *editToken, level uint, leaf *vectorNode) *vectorNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode{edit: edit, children: []*vectorNode{newPath(edit, level-vectorBits, leaf)}}
+}
+
+func assocNode(edit *editToken, level uint, node *vectorNode, i int, elem Object) *vectorNode {
+	node = editableNode(edit, node)
+	if level == 0 {
+		node.values[i&vectorMask] = elem
+		return node
+	}
+	j := (i >> level) & vectorMask
+	node.children[j] = assocNode(edit, level-vectorBits, node.children[j], i, elem)
+	return node
+}
+
+// editableNode returns node if edit owns it, and otherwise a copy of it
+// that edit owns
+func editableNode(edit *editToken, node *vectorNode) *vectorNode {
+	if edit != nil && node.edit == edit {
+		return node
+	}
+	return &vectorNode{
+		edit:     edit,
+		children: append([]*vectorNode(nil), node.children...),
+		values:   append([]Object(nil), node.values...),
+	}
+}
+
+// TransientList builds a List by changing it in place, for when a List is
+// built up an element at a time and the versions in between aren't needed.
+// Persistent ends its use and returns the List.
+type TransientList struct {
+	edit *editToken
+	list List
+}
+
+// Transient returns a TransientList that starts out with the elements of
+// l, which is left unchanged
+func (l *List) Transient() *TransientList {
+	t := &TransientList{edit: &editToken{}, list: *l}
+	t.list.shift = l.rootShift()
+	t.list.root = l.rootNode()
+	t.list.tail = append(make([]Object, 0, vectorWidth), l.tail...)
+	return t
+}
+
+// Len returns the number of elements added so far
+func (t *TransientList) Len() int {
+	return t.list.Len()
+}
+
+// Conj adds elem to the end
+func (t *TransientList) Conj(elem Object) {
+	t.ensureEditable()
+	l := &t.list
+	if l.count-l.tailOffset() < vectorWidth {
+		l.tail = append(l.tail, elem)
+		l.count++
+		return
+	}
+
+	l.root, l.shift = l.pushTail(t.edit)
+	l.tail = append(make([]Object, 0, vectorWidth), elem)
+	l.count++
+}
+
+// Assoc replaces the element at index i, which must be in range
+func (t *TransientList) Assoc(i int, elem Object) {
+	t.ensureEditable()
+	l := &t.list
+	i += l.start
+	if i >= l.tailOffset() {
+		l.tail[i&vectorMask] = elem
+		return
+	}
+	l.root = assocNode(t.edit, l.shift, l.root, i, elem)
+}
+
+// Persistent returns the List built so far. The TransientList can't be
+// used after that.
+func (t *TransientList) Persistent() *List {
+	t.ensureEditable()
+	t.edit = nil
+	l := t.list
+	l.tail = append([]Object{}, l.tail...)
+	return &l
+}
+
+func (t *TransientList) ensureEditable() {
+	if t.edit == nil {
+		panic("transient list used after Persistent")
+	}
+}
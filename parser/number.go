@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+	"lo/ast"
+	"lo/token"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// bases maps the prefix of each non-decimal integer literal to its base
+var bases = map[string]struct {
+	base int
+	name string
+}{
+	"0x": {16, "hexadecimal"},
+	"0o": {8, "octal"},
+	"0b": {2, "binary"},
+}
+
+// parseNumber parses the literal of a number token. Integers can be
+// written in decimal or, after 0x, 0o or 0b, in hexadecimal, octal or
+// binary; floats in decimal with a fraction, an exponent or both; and
+// ratios as two decimal integers separated by a /. Underscores can
+// separate digits.
+func (p *Parser) parseNumber() ast.Expression {
+	tok := p.curToken
+	exp, offset, msg := readNumber(tok)
+	if msg != "" {
+		p.Errors = append(p.Errors, ParseError{Msg: msg, Line: tok.Line, Column: tok.Column + offset})
+		return nil
+	}
+	return exp
+}
+
+// numberReader steps through the literal of a number token, collecting
+// its digits without their separators
+type numberReader struct {
+	tok    token.Token
+	lit    string
+	pos    int
+	digits strings.Builder
+}
+
+// readNumber returns the literal node tok denotes, or an error message and
+// the offset in its literal of the character the error is about
+func readNumber(tok token.Token) (ast.Expression, int, string) {
+	lit := tok.Literal
+	r := &numberReader{tok: tok, lit: lit}
+	if r.peek() == '-' || r.peek() == '+' {
+		r.digits.WriteByte(lit[0])
+		r.pos++
+	}
+
+	if len(lit) >= r.pos+2 {
+		if b, ok := bases[strings.ToLower(lit[r.pos:r.pos+2])]; ok {
+			r.pos += 2
+			if msg := r.readDigits(b.base); msg != "" {
+				return nil, r.pos, msg
+			}
+			if r.pos < len(lit) {
+				return nil, r.pos, fmt.Sprintf("invalid digit %s in %s literal", r.current(), b.name)
+			}
+			return r.integer(b.base)
+		}
+	}
+
+	if msg := r.readDigits(10); msg != "" {
+		return nil, r.pos, msg
+	}
+	if r.peek() == '/' {
+		return r.ratio()
+	}
+
+	isFloat := false
+	if r.peek() == '.' {
+		isFloat = true
+		r.advance()
+		if msg := r.readDigits(10); msg != "" {
+			return nil, r.pos, msg
+		}
+	}
+	if r.peek() == 'e' || r.peek() == 'E' {
+		isFloat = true
+		r.advance()
+		if r.peek() == '-' || r.peek() == '+' {
+			r.advance()
+		}
+		if msg := r.readDigits(10); msg != "" {
+			return nil, r.pos, msg
+		}
+	}
+	if r.pos < len(lit) {
+		return nil, r.pos, fmt.Sprintf("unexpected %s in number", r.current())
+	}
+
+	if !isFloat {
+		return r.integer(10)
+	}
+	value, err := strconv.ParseFloat(r.digits.String(), 64)
+	if err != nil {
+		return nil, 0, "float out of range: " + lit
+	}
+	return &ast.FloatLiteral{Token: r.tok, Value: value}, 0, ""
+}
+
+// readDigits reads one or more digits in base, each pair of which can be
+// separated by an underscore
+func (r *numberReader) readDigits(base int) string {
+	start := r.pos
+	for r.pos < len(r.lit) {
+		ch := r.lit[r.pos]
+		if ch == '_' {
+			if r.pos == start || r.pos+1 == len(r.lit) || !isDigitIn(r.lit[r.pos+1], base) {
+				return "digit separator _ must be between digits"
+			}
+			r.pos++
+			continue
+		}
+		if !isDigitIn(ch, base) {
+			break
+		}
+		r.digits.WriteByte(ch)
+		r.pos++
+	}
+
+	if r.pos == start {
+		if r.pos == len(r.lit) {
+			return "expected a digit at the end of " + r.lit
+		}
+		return fmt.Sprintf("expected a digit, got %s", r.current())
+	}
+	return ""
+}
+
+// integer returns the node for the digits read so far
+func (r *numberReader) integer(base int) (ast.Expression, int, string) {
+	value, ok := new(big.Int).SetString(r.digits.String(), base)
+	if !ok {
+		return nil, 0, "malformed number: " + r.lit
+	}
+	if value.IsInt64() {
+		return &ast.IntLiteral{Token: r.tok, Value: value.Int64()}, 0, ""
+	}
+	return &ast.BigIntLiteral{Token: r.tok, Value: value}, 0, ""
+}
+
+// ratio reads the denominator of a ratio whose numerator has been read
+func (r *numberReader) ratio() (ast.Expression, int, string) {
+	num, _ := new(big.Int).SetString(r.digits.String(), 10)
+	r.digits.Reset()
+	r.pos++ // Skip the /
+
+	start := r.pos
+	if msg := r.readDigits(10); msg != "" {
+		return nil, r.pos, msg
+	}
+	if r.pos < len(r.lit) {
+		return nil, r.pos, fmt.Sprintf("unexpected %s in ratio", r.current())
+	}
+
+	den, _ := new(big.Int).SetString(r.digits.String(), 10)
+	if den.Sign() == 0 {
+		return nil, start, "ratio with zero denominator: " + r.lit
+	}
+	return &ast.RatioLiteral{Token: r.tok, Value: new(big.Rat).SetFrac(num, den)}, 0, ""
+}
+
+func (r *numberReader) peek() byte {
+	if r.pos < len(r.lit) {
+		return r.lit[r.pos]
+	}
+	return 0
+}
+
+func (r *numberReader) advance() {
+	r.digits.WriteByte(r.lit[r.pos])
+	r.pos++
+}
+
+// current quotes the character being read
+func (r *numberReader) current() string {
+	ch, _ := utf8.DecodeRuneInString(r.lit[r.pos:])
+	return strconv.QuoteRune(ch)
+}
+
+func isDigitIn(ch byte, base int) bool {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch-'0') < base
+	case 'a' <= ch && ch <= 'f':
+		return base == 16
+	case 'A' <= ch && ch <= 'F':
+		return base == 16
+	}
+	return false
+}
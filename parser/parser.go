@@ -4,7 +4,6 @@ import (
 	"lo/ast"
 	"lo/lexer"
 	"lo/token"
-	"strconv"
 	"strings"
 )
 
@@ -58,10 +57,18 @@ func (p *Parser) parseExpression() ast.Expression {
 		return p.parseNumber()
 	case token.String:
 		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	case token.Keyword:
+		return p.parseKeyword()
 	case token.OpenParen:
 		return p.parseList()
 	case token.OpenBracket:
 		return p.parseListLiteral()
+	case token.OpenBrace:
+		return p.parseMapLiteral()
+	case token.OpenSet:
+		return p.parseSetLiteral()
+	case token.Quote, token.Quasiquote, token.Unquote, token.UnquoteSplicing, token.Deref:
+		return p.parseReaderMacro()
 	default:
 		return nil
 	}
@@ -71,22 +78,13 @@ func (p *Parser) parseIdentifier() *ast.Identifier {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
-func (p *Parser) parseNumber() ast.Expression {
-	if strings.Contains(p.curToken.Literal, ".") {
-		value, err := strconv.Atoi(p.curToken.Literal)
-		if err != nil {
-			p.Errors = append(p.Errors, ParseError{Msg: "Could not parse float", Line: p.curToken.Line, Column: p.curToken.Column})
-			return nil
-		}
-		return &ast.FloatLiteral{Token: p.curToken, Value: float64(value)}
-	} else {
-		value, err := strconv.Atoi(p.curToken.Literal)
-		if err != nil {
-			p.Errors = append(p.Errors, ParseError{Msg: "Could not parse int", Line: p.curToken.Line, Column: p.curToken.Column})
-			return nil
-		}
-		return &ast.IntLiteral{Token: p.curToken, Value: int64(value)}
+func (p *Parser) parseKeyword() ast.Expression {
+	name := strings.TrimPrefix(p.curToken.Literal, ":")
+	if name == "" {
+		p.Errors = append(p.Errors, ParseError{Msg: "keyword must have a name", Line: p.curToken.Line, Column: p.curToken.Column})
+		return nil
 	}
+	return &ast.KeywordLiteral{Token: p.curToken, Value: name}
 }
 
 func (p *Parser) parseList() *ast.ListExpression {
@@ -101,6 +99,9 @@ func (p *Parser) parseList() *ast.ListExpression {
 		}
 	}
 	p.nextToken()
+	if p.curTokenIs(token.EOF) {
+		p.unclosed(list.Token)
+	}
 
 	return list
 }
@@ -118,10 +119,99 @@ func (p *Parser) parseListLiteral() *ast.ListLiteral {
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.unclosed(list.Token)
+	}
 
 	return list
 }
 
+func (p *Parser) parseMapLiteral() ast.Expression {
+	m := &ast.MapLiteral{Token: p.curToken}
+	exps := []ast.Expression{}
+
+	p.nextToken() // Skip '{'
+
+	for !p.curTokenIs(token.CloseBrace) && !p.curTokenIs(token.EOF) {
+		expr := p.parseExpression()
+		if expr != nil {
+			exps = append(exps, expr)
+		}
+		p.nextToken()
+	}
+	if p.curTokenIs(token.EOF) {
+		p.unclosed(m.Token)
+	} else if len(exps)%2 != 0 {
+		p.Errors = append(p.Errors, ParseError{Msg: "map literal must contain an even number of forms", Line: m.Token.Line, Column: m.Token.Column})
+		return nil
+	}
+
+	for i := 0; i+1 < len(exps); i += 2 {
+		m.Keys = append(m.Keys, exps[i])
+		m.Values = append(m.Values, exps[i+1])
+	}
+	return m
+}
+
+func (p *Parser) parseSetLiteral() *ast.SetLiteral {
+	set := &ast.SetLiteral{Token: p.curToken}
+	set.Expressions = []ast.Expression{}
+
+	p.nextToken() // Skip '#{'
+
+	for !p.curTokenIs(token.CloseBrace) && !p.curTokenIs(token.EOF) {
+		expr := p.parseExpression()
+		if expr != nil {
+			set.Expressions = append(set.Expressions, expr)
+		}
+		p.nextToken()
+	}
+	if p.curTokenIs(token.EOF) {
+		p.unclosed(set.Token)
+	}
+
+	return set
+}
+
+// unclosed reports that the input ended before the delimiter opened by tok
+// was closed
+func (p *Parser) unclosed(tok token.Token) {
+	p.Errors = append(p.Errors, ParseError{Msg: "unclosed " + tok.Literal, Line: tok.Line, Column: tok.Column})
+}
+
+// readerMacros maps each quoting prefix to the form it abbreviates
+var readerMacros = map[token.TokenType]string{
+	token.Quote:           "quote",
+	token.Quasiquote:      "quasiquote",
+	token.Unquote:         "unquote",
+	token.UnquoteSplicing: "unquote-splicing",
+	token.Deref:           "deref",
+}
+
+// parseReaderMacro reads 'x as (quote x), and likewise `x, ~x, ~@x and @x
+func (p *Parser) parseReaderMacro() ast.Expression {
+	tok := p.curToken
+	nameTok := tok
+	nameTok.Type = token.Ident
+	nameTok.Literal = readerMacros[tok.Type]
+	name := &ast.Identifier{Token: nameTok, Value: nameTok.Literal}
+
+	// a closing delimiter is left for the form the prefix is in
+	var expr ast.Expression
+	switch p.peekToken.Type {
+	case token.CloseParen, token.CloseBracket, token.CloseBrace, token.EOF:
+	default:
+		p.nextToken()
+		expr = p.parseExpression()
+	}
+	if expr == nil {
+		p.Errors = append(p.Errors, ParseError{Msg: "expected an expression after " + tok.Literal, Line: tok.Line, Column: tok.Column})
+		return nil
+	}
+
+	return &ast.ListExpression{Token: tok, Expressions: []ast.Expression{name, expr}}
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"lo/ast"
 	"lo/lexer"
+	"strings"
 	"testing"
 )
 
@@ -98,6 +99,141 @@ func TestListLiteralParse(t *testing.T) {
 	testIntLiteral(t, listExpr.Expressions[1], 2)
 }
 
+func TestMapLiteralParse(t *testing.T) {
+	input := "{1 2 3 {4 5}}"
+	l := lexer.New(input, "test")
+	p := New(l)
+
+	program := p.Parse()
+
+	if len(program.Expressions) != 1 {
+		t.Fatalf("program.Expressions does not contain 1 expression. got=%d", len(program.Expressions))
+	}
+
+	mapLit, ok := program.Expressions[0].(*ast.MapLiteral)
+	if !ok {
+		t.Fatalf("expr not *ast.MapLiteral. got=%T", program.Expressions[0])
+	}
+
+	if len(mapLit.Keys) != 2 || len(mapLit.Values) != 2 {
+		t.Fatalf("map literal does not contain 2 pairs. got=%d keys, %d values", len(mapLit.Keys), len(mapLit.Values))
+	}
+
+	testIntLiteral(t, mapLit.Keys[0], 1)
+	testIntLiteral(t, mapLit.Values[0], 2)
+	testIntLiteral(t, mapLit.Keys[1], 3)
+	if _, ok := mapLit.Values[1].(*ast.MapLiteral); !ok {
+		t.Fatalf("nested value not *ast.MapLiteral. got=%T", mapLit.Values[1])
+	}
+}
+
+func TestSetLiteralParse(t *testing.T) {
+	input := "#{1 2 #{3}}"
+	l := lexer.New(input, "test")
+	p := New(l)
+
+	program := p.Parse()
+
+	if len(program.Expressions) != 1 {
+		t.Fatalf("program.Expressions does not contain 1 expression. got=%d", len(program.Expressions))
+	}
+
+	setLit, ok := program.Expressions[0].(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("expr not *ast.SetLiteral. got=%T", program.Expressions[0])
+	}
+
+	if len(setLit.Expressions) != 3 {
+		t.Fatalf("set literal does not contain 3 elements. got=%d", len(setLit.Expressions))
+	}
+
+	testIntLiteral(t, setLit.Expressions[0], 1)
+	testIntLiteral(t, setLit.Expressions[1], 2)
+	if _, ok := setLit.Expressions[2].(*ast.SetLiteral); !ok {
+		t.Fatalf("nested element not *ast.SetLiteral. got=%T", setLit.Expressions[2])
+	}
+}
+
+func TestOddMapLiteral(t *testing.T) {
+	l := lexer.New("(f {1 2 3})", "test")
+	p := New(l)
+	p.Parse()
+
+	if len(p.Errors) != 1 {
+		t.Fatalf("expected 1 parse error. got=%d", len(p.Errors))
+	}
+
+	if p.Errors[0].Column != 4 {
+		t.Errorf("wrong error column. got=%d, want=4", p.Errors[0].Column)
+	}
+}
+
+func TestUnclosedDelimiters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		node     string
+	}{
+		{"(f 1", []string{"1:1: unclosed ("}, "*ast.ListExpression"},
+		{"[1 2", []string{"1:1: unclosed ["}, "*ast.ListLiteral"},
+		{"{1 2", []string{"1:1: unclosed {"}, "*ast.MapLiteral"},
+		{"{1", []string{"1:1: unclosed {"}, "*ast.MapLiteral"},
+		{"{:a 1 :b", []string{"1:1: unclosed {"}, "*ast.MapLiteral"},
+		{"#{1", []string{"1:1: unclosed #{"}, "*ast.SetLiteral"},
+		{"(defn f []\n  {:a #{1", []string{"2:7: unclosed #{", "2:3: unclosed {", "1:1: unclosed ("}, "*ast.ListExpression"},
+		{"(f {:a 1", []string{"1:4: unclosed {", "1:1: unclosed ("}, "*ast.ListExpression"},
+		{"(f ')", []string{"1:4: expected an expression after '"}, "*ast.ListExpression"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input, "test"))
+		program := p.Parse()
+
+		got := []string{}
+		for _, err := range p.Errors {
+			got = append(got, fmt.Sprintf("%d:%d: %s", err.Line, err.Column, err.Msg))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+
+		// the partial form is still parsed
+		if len(program.Expressions) != 1 {
+			t.Errorf("%q: expected 1 expression. got=%d", tt.input, len(program.Expressions))
+			continue
+		}
+		if got := fmt.Sprintf("%T", program.Expressions[0]); got != tt.node {
+			t.Errorf("wrong expression for %q. got=%s, want=%s", tt.input, got, tt.node)
+		}
+	}
+
+	p := New(lexer.New("'", "test"))
+	p.Parse()
+	if len(p.Errors) != 1 || p.Errors[0].Msg != "expected an expression after '" {
+		t.Errorf("wrong errors for a lone quote. got=%v", p.Errors)
+	}
+}
+
+func TestKeywordParse(t *testing.T) {
+	l := lexer.New(":status-code", "test")
+	p := New(l)
+
+	program := p.Parse()
+
+	if len(program.Expressions) != 1 {
+		t.Fatalf("program.Expressions does not contain 1 expression. got=%d", len(program.Expressions))
+	}
+
+	kw, ok := program.Expressions[0].(*ast.KeywordLiteral)
+	if !ok {
+		t.Fatalf("expr not *ast.KeywordLiteral. got=%T", program.Expressions[0])
+	}
+
+	if kw.Value != "status-code" {
+		t.Errorf("kw.Value not status-code. got=%s", kw.Value)
+	}
+}
+
 func TestDefnParse(t *testing.T) {
 	input := "(defn add [a b] (+ a b))"
 	l := lexer.New(input, "test")
@@ -134,6 +270,163 @@ func TestDefnParse(t *testing.T) {
 
 }
 
+func TestQuoteParse(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+	}{
+		{"'a", "quote"},
+		{"`a", "quasiquote"},
+		{"~a", "unquote"},
+		{"~@a", "unquote-splicing"},
+		{"@a", "deref"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input, "test")
+		p := New(l)
+
+		program := p.Parse()
+
+		if len(program.Expressions) != 1 {
+			t.Fatalf("program.Expressions does not contain 1 expression. got=%d", len(program.Expressions))
+		}
+
+		listExpr, ok := program.Expressions[0].(*ast.ListExpression)
+		if !ok {
+			t.Fatalf("expr not *ast.ListExpression. got=%T", program.Expressions[0])
+		}
+
+		if len(listExpr.Expressions) != 2 {
+			t.Fatalf("listExpr.Expressions does not contain 2 expressions. got=%d", len(listExpr.Expressions))
+		}
+
+		testIdent(t, listExpr.Expressions[0], tt.name)
+		testIdent(t, listExpr.Expressions[1], "a")
+	}
+}
+
+func TestQuoteWithoutExpression(t *testing.T) {
+	l := lexer.New("(a ')", "test")
+	p := New(l)
+	p.Parse()
+
+	if len(p.Errors) != 1 {
+		t.Fatalf("expected 1 parse error. got=%d", len(p.Errors))
+	}
+
+	if p.Errors[0].Column != 4 {
+		t.Errorf("wrong error column. got=%d, want=4", p.Errors[0].Column)
+	}
+}
+
+func TestNumberParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"42", "int 42"},
+		{"-42", "int -42"},
+		{"+7", "int 7"},
+		{"1_000_000", "int 1000000"},
+		{"0xff", "int 255"},
+		{"0XFF", "int 255"},
+		{"-0x10", "int -16"},
+		{"0o17", "int 15"},
+		{"0b1010", "int 10"},
+		{"0b1111_0000", "int 240"},
+		{"007", "int 7"},
+		{"9223372036854775807", "int 9223372036854775807"},
+		{"-9223372036854775808", "int -9223372036854775808"},
+		{"9223372036854775808", "big 9223372036854775808"},
+		{"0xffffffffffffffff", "big 18446744073709551615"},
+		{"1.5", "float 1.5"},
+		{"-0.25", "float -0.25"},
+		{"1_000.000_5", "float 1000.0005"},
+		{"1e-9", "float 1e-09"},
+		{"2.5E3", "float 2500"},
+		{"1e+2", "float 100"},
+		{"1/3", "ratio 1/3"},
+		{"-2/4", "ratio -1/2"},
+		{"4/2", "ratio 2/1"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input, "test"))
+		program := p.Parse()
+
+		if len(p.Errors) != 0 {
+			t.Errorf("%s: unexpected parse error: %s", tt.input, p.Errors[0].Msg)
+			continue
+		}
+
+		var got string
+		switch exp := program.Expressions[0].(type) {
+		case *ast.IntLiteral:
+			got = fmt.Sprintf("int %d", exp.Value)
+		case *ast.BigIntLiteral:
+			got = fmt.Sprintf("big %s", exp.Value)
+		case *ast.FloatLiteral:
+			got = fmt.Sprintf("float %g", exp.Value)
+		case *ast.RatioLiteral:
+			got = fmt.Sprintf("ratio %s", exp.Value)
+		default:
+			got = fmt.Sprintf("%T", exp)
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong literal for %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+		if program.Expressions[0].TokenLiteral() != tt.input {
+			t.Errorf("wrong token literal for %q. got=%s", tt.input, program.Expressions[0].TokenLiteral())
+		}
+	}
+}
+
+func TestNumberParseErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		msg    string
+		column int
+	}{
+		{"(f 1.2.3)", `unexpected '.' in number`, 7},
+		{"(f 12abc)", `unexpected 'a' in number`, 6},
+		{"(f 1.)", "expected a digit at the end of 1.", 6},
+		{"(f 1.e5)", "expected a digit, got 'e'", 6},
+		{"(f 1e)", "expected a digit at the end of 1e", 6},
+		{"(f 0x)", "expected a digit at the end of 0x", 6},
+		{"(f 0xfg)", "invalid digit 'g' in hexadecimal literal", 7},
+		{"(f 0b102)", "invalid digit '2' in binary literal", 8},
+		{"(f 0o8)", "expected a digit, got '8'", 6},
+		{"(f 1__0)", "digit separator _ must be between digits", 5},
+		{"(f 1_)", "digit separator _ must be between digits", 5},
+		{"(f 1_.5)", "digit separator _ must be between digits", 5},
+		{"(f 0x_f)", "digit separator _ must be between digits", 6},
+		{"(f 1/0)", "ratio with zero denominator: 1/0", 6},
+		{"(f 1/3/4)", `unexpected '/' in ratio`, 7},
+		{"(f 1/)", "expected a digit at the end of 1/", 6},
+		{"(f 1/2.5)", `unexpected '.' in ratio`, 7},
+		{"(f 1e999)", "float out of range: 1e999", 4},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input, "test"))
+		p.Parse()
+
+		if len(p.Errors) != 1 {
+			t.Errorf("%s: expected 1 parse error. got=%d", tt.input, len(p.Errors))
+			continue
+		}
+
+		if p.Errors[0].Msg != tt.msg {
+			t.Errorf("wrong error for %q. got=%q, want=%q", tt.input, p.Errors[0].Msg, tt.msg)
+		}
+		if p.Errors[0].Column != tt.column {
+			t.Errorf("wrong error column for %q. got=%d, want=%d", tt.input, p.Errors[0].Column, tt.column)
+		}
+	}
+}
+
 // Helpers
 func testIdent(t *testing.T, expr ast.Expression, value string) {
 	t.Helper()
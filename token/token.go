@@ -3,16 +3,24 @@ package token
 type TokenType string
 
 const (
-	Ident        TokenType = "IDENT"
-	Illegal      TokenType = "ILLEGAL"
-	EOF          TokenType = "EOF"
-	Number       TokenType = "NUMBER"
-	String       TokenType = "STRING"
-	OpenParen    TokenType = "LPAREN"
-	CloseParen   TokenType = "RPAREN"
-	OpenBracket  TokenType = "LBRACKET"
-	CloseBracket TokenType = "RBRACKET"
-	Quote        TokenType = "QUOTE"
+	Ident           TokenType = "IDENT"
+	Illegal         TokenType = "ILLEGAL"
+	EOF             TokenType = "EOF"
+	Number          TokenType = "NUMBER"
+	String          TokenType = "STRING"
+	Keyword         TokenType = "KEYWORD"
+	OpenParen       TokenType = "LPAREN"
+	CloseParen      TokenType = "RPAREN"
+	OpenBracket     TokenType = "LBRACKET"
+	CloseBracket    TokenType = "RBRACKET"
+	OpenBrace       TokenType = "LBRACE"
+	CloseBrace      TokenType = "RBRACE"
+	OpenSet         TokenType = "LSET"
+	Quote           TokenType = "QUOTE"
+	Quasiquote      TokenType = "QUASIQUOTE"
+	Unquote         TokenType = "UNQUOTE"
+	UnquoteSplicing TokenType = "UNQUOTE_SPLICING"
+	Deref           TokenType = "DEREF"
 )
 
 type Token struct {
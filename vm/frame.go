@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"lo/code"
+	"lo/object"
+)
+
+// Frame is the activation record of one closure call, running the arity
+// of the closure's function chosen for it
+type Frame struct {
+	fn          *object.CompiledFunction
+	ip          int
+	basePointer int
+	env         *object.Scope
+}
+
+func NewFrame(fn *object.CompiledFunction, basePointer int, env *object.Scope) *Frame {
+	return &Frame{fn: fn, ip: -1, basePointer: basePointer, env: env}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.fn.Instructions
+}
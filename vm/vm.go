@@ -0,0 +1,606 @@
+package vm
+
+import (
+	"fmt"
+	"lo/code"
+	"lo/compiler"
+	"lo/consts"
+	"lo/eval"
+	"lo/object"
+)
+
+const initialStackSize = 256
+
+type VM struct {
+	constants []object.Object
+	globals   *object.Environment
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames   []*Frame
+	handlers []handler
+	boundary boundary
+
+	// applier is apply, made once for the closures the VM makes
+	applier object.Applier
+
+	// running is set while Run is executing the main function. A closure
+	// can be called after that, from a macro or a lazy sequence.
+	running bool
+}
+
+// boundary marks where the current call into the VM from Go began. An
+// error raised inside it is never caught by a try outside it; it is
+// returned to the Go caller instead.
+type boundary struct {
+	frames   int
+	handlers int
+	sp       int
+}
+
+// handler records the state to restore when an error is raised inside a
+// try, and where its catch clauses start
+type handler struct {
+	catchIP    int
+	frameCount int
+	sp         int
+	env        *object.Scope
+}
+
+// New creates a VM that runs bytecode against globals, the same
+// Environment the tree-walking evaluator uses for top-level bindings
+func New(bytecode *compiler.Bytecode, globals *object.Environment) *VM {
+	mainFn := &object.CompiledFunction{Name: "main", Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainFrame := NewFrame(mainFn, 0, nil)
+
+	vm := &VM{
+		constants: bytecode.Constants,
+		globals:   globals,
+		stack:     make([]object.Object, initialStackSize),
+		frames:    []*Frame{mainFrame},
+		boundary:  boundary{frames: 1},
+	}
+	vm.applier = vm.apply
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last top-level expression
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames = append(vm.frames, f)
+}
+
+func (vm *VM) popFrame() *Frame {
+	f := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	return f
+}
+
+func (vm *VM) Run() error {
+	vm.running = true
+	defer func() { vm.running = false }()
+	return vm.run(0)
+}
+
+// run executes instructions until the frame count drops to base, or the
+// main frame runs out of instructions
+func (vm *VM) run(base int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for len(vm.frames) > base && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+
+		case code.OpTrue:
+			vm.push(&consts.TrueBool)
+
+		case code.OpFalse:
+			vm.push(&consts.FalseBool)
+
+		case code.OpNull:
+			vm.push(&consts.Nil)
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpIfFalse:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !object.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpGetGlobal:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			val, ok := vm.globals.Get(name)
+			if !ok {
+				if !vm.raise(&object.Error{Kind: object.NAME_ERROR, Message: "identifier not found: " + name}) {
+					return nil
+				}
+				break
+			}
+			vm.push(val)
+
+		case code.OpSetGlobal:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			vm.globals.Set(name, vm.pop())
+
+		case code.OpAssignGlobal:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			if !vm.globals.Assign(name, vm.pop()) {
+				vm.pop()
+				if !vm.raise(eval.Unassignable(name)) {
+					return nil
+				}
+			}
+
+		case code.OpGetLocal:
+			depth := code.ReadUint8(ins[ip+1:])
+			slot := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+
+			val := vm.currentFrame().env.At(int(depth)).Slots[slot]
+			if val == nil {
+				frame := vm.currentFrame()
+				name := frame.fn.SourceMap.Lookup(frame.ip).Literal
+				if !vm.raise(&object.Error{Kind: object.NAME_ERROR, Message: "identifier not found: " + name}) {
+					return nil
+				}
+				break
+			}
+			vm.push(val)
+
+		case code.OpSetLocal:
+			depth := code.ReadUint8(ins[ip+1:])
+			slot := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+
+			vm.currentFrame().env.At(int(depth)).Slots[slot] = vm.pop()
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.push(eval.Builtins[builtinIndex])
+
+		case code.OpList:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			vm.push(object.NewList(elements))
+
+		case code.OpMap:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, 0, numElements/2)
+			values := make([]object.Object, 0, numElements/2)
+			for i := vm.sp - numElements; i < vm.sp; i += 2 {
+				keys = append(keys, vm.stack[i])
+				values = append(values, vm.stack[i+1])
+			}
+			vm.sp = vm.sp - numElements
+
+			m := eval.BuildMap(keys, values)
+			if err, ok := m.(*object.Error); ok {
+				if !vm.raise(err) {
+					return nil
+				}
+				break
+			}
+			vm.push(m)
+
+		case code.OpSet:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			s := eval.BuildSet(elements)
+			if err, ok := s.(*object.Error); ok {
+				if !vm.raise(err) {
+					return nil
+				}
+				break
+			}
+			vm.push(s)
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if err := vm.executeCall(numArgs); err != nil && !vm.raise(err) {
+				return nil
+			}
+
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var err *object.Error
+			if cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure); ok {
+				err = vm.tailCallClosure(cl, numArgs)
+			} else {
+				err = vm.executeCall(numArgs)
+			}
+			if err != nil && !vm.raise(err) {
+				return nil
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			vm.push(returnValue)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			fn := vm.constants[constIndex].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: fn, Env: vm.currentFrame().env, Apply: vm.applier})
+
+		case code.OpJumpIfBound:
+			slot := code.ReadUint16(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			if vm.currentFrame().env.Slots[slot] != nil {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpError:
+			errIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			template := vm.constants[errIndex].(*object.Error)
+			if !vm.raise(&object.Error{Kind: template.Kind, Message: template.Message}) {
+				return nil
+			}
+
+		case code.OpPushScope:
+			size := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.currentFrame().env = object.NewScope(size, vm.currentFrame().env)
+
+		case code.OpPopScope:
+			vm.currentFrame().env = vm.currentFrame().env.Outer
+
+		case code.OpTry:
+			catchIP := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				catchIP:    catchIP,
+				frameCount: len(vm.frames),
+				sp:         vm.sp,
+				env:        vm.currentFrame().env,
+			})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpCatch:
+			kindIndex := code.ReadUint16(ins[ip+1:])
+			next := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			err := vm.stack[vm.sp-1].(*object.Error)
+			kind := vm.constants[kindIndex].(*object.String).Value
+			if kind == "" || kind == err.Kind {
+				err.Caught = true
+			} else {
+				vm.currentFrame().ip = next - 1
+			}
+
+		case code.OpThrow:
+			if !vm.raise(vm.pop().(*object.Error)) {
+				return nil
+			}
+
+		case code.OpMacroexpand:
+			once := code.ReadUint8(ins[ip+1:]) == 1
+			vm.currentFrame().ip++
+
+			result := eval.Macroexpand(vm.pop(), vm.globals, once)
+			if err, ok := result.(*object.Error); ok && !err.Caught {
+				if !vm.raise(err) {
+					return nil
+				}
+				break
+			}
+			vm.push(result)
+
+		case code.OpDestructure:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vals, err := eval.Destructure(vm.constants[patternIndex].(*object.Pattern), vm.pop())
+			if err != nil {
+				if !vm.raise(err) {
+					return nil
+				}
+				break
+			}
+			for _, val := range vals {
+				vm.push(val)
+			}
+
+		case code.OpMatch:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			next := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			vals, ok, err := eval.Match(vm.constants[patternIndex].(*object.Pattern), vm.stack[vm.sp-1])
+			if err != nil {
+				if !vm.raise(err) {
+					return nil
+				}
+				break
+			}
+			if !ok {
+				vm.currentFrame().ip = next - 1
+				break
+			}
+			for _, val := range vals {
+				vm.push(val)
+			}
+
+		case code.OpNoMatch:
+			if !vm.raise(eval.NoMatch(vm.pop())) {
+				return nil
+			}
+
+		case code.OpNoCase:
+			if !vm.raise(eval.NoCase(vm.pop())) {
+				return nil
+			}
+
+		case code.OpCase:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			next := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			clause := eval.CaseClause{Constants: vm.constants[constIndex].(*object.List)}
+			if !clause.Matches(vm.stack[vm.sp-1]) {
+				vm.currentFrame().ip = next - 1
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+// executeCall calls the callee below the arguments on the stack. An
+// uncaught error returned by a builtin is returned to be raised rather than
+// pushed.
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	var result object.Object
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		result = callee.Call(vm.apply, vm.popArgs(numArgs)...)
+	case *object.Keyword:
+		result = eval.CallKeyword(callee, vm.popArgs(numArgs))
+	default:
+		return &object.Error{Kind: object.TYPE_ERROR, Message: "first element is not a function"}
+	}
+
+	if err, ok := result.(*object.Error); ok && !err.Caught {
+		return err
+	}
+	vm.push(result)
+	return nil
+}
+
+// popArgs pops the arguments of a call handled in Go, and its callee
+func (vm *VM) popArgs(numArgs int) []object.Object {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+	return args
+}
+
+// apply is the Applier the VM hands to higher-order builtins. It runs a
+// call to fn to completion inside a new boundary and returns its result.
+func (vm *VM) apply(fn object.Object, args ...object.Object) object.Object {
+	switch fn.(type) {
+	case *object.Closure, *object.Builtin, *object.Keyword:
+	default:
+		return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("not a function, got %s", typeName(fn))}
+	}
+
+	outer := vm.boundary
+	defer func() { vm.boundary = outer }()
+	vm.boundary = boundary{frames: len(vm.frames), handlers: len(vm.handlers), sp: vm.sp}
+
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.executeCall(len(args)); err != nil {
+		return err
+	}
+
+	if err := vm.run(vm.boundary.frames); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	// A call that returned leaves its result on the stack, and one that
+	// raised an error leaves the error as the last popped element
+	if vm.sp > vm.boundary.sp {
+		vm.pop()
+	}
+	return vm.LastPoppedStackElem()
+}
+
+// raise unwinds to the innermost try with err on the stack, recording the
+// position of the current instruction in each frame the error leaves. With
+// no try inside the current boundary to catch it, raise reports false and
+// leaves the error as the result of the call that began the boundary. A
+// main function that has finished running isn't where the error is.
+func (vm *VM) raise(err *object.Error) bool {
+	frameCount := vm.boundary.frames
+	if len(vm.handlers) > vm.boundary.handlers {
+		frameCount = vm.handlers[len(vm.handlers)-1].frameCount
+	}
+
+	for {
+		frame := vm.currentFrame()
+		if vm.running || len(vm.frames) > 1 {
+			err.Locate(frame.fn.SourceMap.Lookup(frame.ip))
+		}
+		if len(vm.frames) == frameCount {
+			break
+		}
+
+		vm.popFrame()
+		err.Unwind(frame.fn.Name)
+	}
+
+	if len(vm.handlers) == vm.boundary.handlers {
+		vm.sp = vm.boundary.sp
+		vm.push(err)
+		vm.pop()
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	frame := vm.currentFrame()
+	frame.env = h.env
+	frame.ip = h.catchIP - 1
+	vm.sp = h.sp
+	vm.push(err)
+	return true
+}
+
+// callClosure pushes a frame for a call to cl, unless there are already
+// as many calls in progress as eval.MaxCallDepth allows
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if len(vm.frames) > eval.MaxCallDepth {
+		return eval.TooDeep()
+	}
+
+	fn, env, err := vm.bindArguments(cl, numArgs)
+	if err != nil {
+		return err
+	}
+
+	vm.pushFrame(NewFrame(fn, vm.sp-numArgs, env))
+	return nil
+}
+
+// tailCallClosure reuses the current frame for the call, so a chain of
+// tail calls runs in constant frame and stack space
+func (vm *VM) tailCallClosure(cl *object.Closure, numArgs int) *object.Error {
+	fn, env, err := vm.bindArguments(cl, numArgs)
+	if err != nil {
+		return err
+	}
+
+	frame := vm.currentFrame()
+	vm.sp = frame.basePointer
+
+	frame.fn = fn
+	frame.env = env
+	frame.ip = -1
+	return nil
+}
+
+// bindArguments chooses the arity of cl that takes the arguments on top of
+// the stack, and makes the scope a call to it runs in, with the arguments
+// bound to its parameters
+func (vm *VM) bindArguments(cl *object.Closure, numArgs int) (*object.CompiledFunction, *object.Scope, *object.Error) {
+	fn, err := cl.Fn.Arity(numArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	slots, err := fn.Signature.Bind(fn.Name, vm.stack[vm.sp-numArgs:vm.sp])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := object.NewScope(fn.NumLocals, cl.Env)
+	copy(env.Slots, slots)
+	return fn, env, nil
+}
+
+func typeName(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return "NIL"
+	}
+	return obj.Type()
+}
+
+func (vm *VM) push(o object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
@@ -0,0 +1,269 @@
+package vm
+
+import (
+	"lo/ast"
+	"lo/compiler"
+	"lo/consts"
+	"lo/lexer"
+	"lo/object"
+	"lo/parser"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"(+ 1 2)", 3},
+		{"(- (* 2 5) 3)", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"(if true 10 20)", 10},
+		{"(if false 10 20)", 20},
+		{"(if [] 10 20)", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalDefinitions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(def one 1) one", 1},
+		{"(def one 1) (def two (+ one one)) two", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"(defn five [] 5) (five)", 5},
+		{"(defn id [x] x) (id 4)", 4},
+		{"(defn sum [a b] (def c (+ a b)) c) (+ (sum 1 2) (sum 3 4))", 10},
+		{"(defn twice [f x] (f (f x))) (twice (\\ [n] (* n 3)) 2)", 18},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"(defn adder [a] (\\ [b] (+ a b))) ((adder 1) 2)", 3},
+		{"(defn f [] (def g (\\ [] x)) (def x 3) (g)) (f)", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTailCallsReuseFrames(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("done?", &object.Builtin{Name: "done?", Fn: func(args ...object.Object) object.Object {
+		if args[0].(*object.Integer).Value >= 100000 {
+			return &consts.TrueBool
+		}
+		return &consts.FalseBool
+	}})
+
+	input := "(defn up [n] (if (done? n) n (up (+ n 1)))) (up 0)"
+	program := parse(input)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), env)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testIntegerObject(t, vm.LastPoppedStackElem(), 100000)
+	if cap(vm.frames) > 2 {
+		t.Errorf("tail calls grew the frame stack. cap=%d", cap(vm.frames))
+	}
+	if len(vm.stack) > initialStackSize {
+		t.Errorf("tail calls grew the value stack. len=%d", len(vm.stack))
+	}
+}
+
+func TestLoopsReuseScopes(t *testing.T) {
+	input := "(loop [i 0] (let [j (+ i 1)] (if (< j 100000) (recur j) j)))"
+	program := parse(input)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), object.NewEnvironment())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testIntegerObject(t, vm.LastPoppedStackElem(), 100000)
+	if len(vm.stack) > initialStackSize {
+		t.Errorf("recur grew the value stack. len=%d", len(vm.stack))
+	}
+	if env := vm.currentFrame().env; env != nil {
+		t.Errorf("loop left a scope behind. got=%v", env)
+	}
+}
+
+func TestRaisedErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"(def x 1) (y) (def x 2)", &object.Error{Message: "identifier not found: y"}},
+		{"(defn f [] (1)) (+ 1 (f))", &object.Error{Message: "first element is not a function"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCatchUnwindsFrames(t *testing.T) {
+	input := "(defn f [n] (+ n (g))) (defn h [] (try (f 1) (catch e 2))) (+ 1 (h))"
+	program := parse(input)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), object.NewEnvironment())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testIntegerObject(t, vm.LastPoppedStackElem(), 3)
+	if len(vm.frames) != 1 {
+		t.Errorf("frames left after catch. got=%d", len(vm.frames))
+	}
+	if len(vm.handlers) != 0 {
+		t.Errorf("handlers left after catch. got=%d", len(vm.handlers))
+	}
+	if vm.sp != 0 {
+		t.Errorf("values left on the stack after catch. sp=%d", vm.sp)
+	}
+}
+
+func TestBuiltinCallbacksRestoreState(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(defn f [x] (* x 2)) (get (update {1 2} 1 f) 1)", 4},
+		{"(defn f [x] (foo)) (try (update {1 2} 1 f) (catch e 5))", 5},
+		{"(defn f [x] (try (foo) (catch e x))) (get (update {1 7} 1 f) 1)", 7},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode(), object.NewEnvironment())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testIntegerObject(t, vm.LastPoppedStackElem(), tt.expected)
+		if len(vm.frames) != 1 || len(vm.handlers) != 0 || vm.sp != 0 {
+			t.Errorf("state left behind by %q. frames=%d handlers=%d sp=%d", tt.input, len(vm.frames), len(vm.handlers), vm.sp)
+		}
+		if vm.boundary != (boundary{frames: 1}) {
+			t.Errorf("boundary not restored by %q. got=%+v", tt.input, vm.boundary)
+		}
+	}
+}
+
+func TestErrorsStopExecution(t *testing.T) {
+	env := object.NewEnvironment()
+	run(t, "(def x 1) (undefined) (def x 2)", env, []object.Object{})
+
+	x, _ := env.Get("x")
+	testIntegerObject(t, x, 1)
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	env := object.NewEnvironment()
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, input := range []string{"(def x 2)", "(defn double [n] (* n x))", "(double 21)"} {
+		result, constants = run(t, input, env, constants)
+	}
+	testIntegerObject(t, result, 42)
+}
+
+// Helpers
+
+func run(t *testing.T, input string, env *object.Environment, constants []object.Object) (object.Object, []object.Object) {
+	t.Helper()
+
+	program := parse(input)
+
+	comp := compiler.NewWithState(constants)
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	vm := New(bytecode, env)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return vm.LastPoppedStackElem(), bytecode.Constants
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input, "test")
+	p := parser.New(l)
+	return p.Parse()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result, _ := run(t, tt.input, object.NewEnvironment(), []object.Object{})
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, result, int64(expected))
+		case *object.Error:
+			err, ok := result.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", result, result)
+				continue
+			}
+			if err.Message != expected.Message {
+				t.Errorf("wrong error message. got=%q, want=%q", err.Message, expected.Message)
+			}
+		}
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}